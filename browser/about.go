@@ -0,0 +1,46 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// AboutPage generates the gemtext of an about: page, like about:feeds.
+type AboutPage func(ctx context.Context, u *url.URL) (string, error)
+
+var (
+	aboutMu    sync.RWMutex
+	aboutPages = make(map[string]AboutPage)
+)
+
+// RegisterAbout makes about:name serve the page generated by page.
+func RegisterAbout(name string, page AboutPage) {
+	aboutMu.Lock()
+	defer aboutMu.Unlock()
+	aboutPages[name] = page
+}
+
+// FetchAbout generates an about: page. They are never cached since they are
+// made fresh from local state.
+func FetchAbout(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	name := u.Opaque
+	if name == "" {
+		name = strings.TrimPrefix(u.Path, "/")
+	}
+
+	aboutMu.RLock()
+	page, ok := aboutPages[name]
+	aboutMu.RUnlock()
+	if !ok {
+		return Response{}, fmt.Errorf("there is no page %s", u)
+	}
+
+	body, err := page(ctx, u)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Status: "20 text/gemini", Body: body, URL: u}, nil
+}
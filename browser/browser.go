@@ -1,15 +1,63 @@
 package browser
 
 import (
-	"bufio"
+	"context"
 	"net/url"
+	"regexp"
 	"slices"
-	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/config"
+	"github.com/krbreyn/gemcat/gemtxt"
+	"github.com/krbreyn/gemcat/tofu"
 )
 
 type Browser struct {
 	S State
 	D Data
+
+	// CertPrompt is asked what to do when a known host's certificate changes.
+	CertPrompt tofu.PromptFunc
+	// InputPrompt is asked for input a server needs, like a search query.
+	InputPrompt func(prompt string) (input string, ok bool)
+	// OnWait is told about waits for hosts that asked to slow down.
+	OnWait func(host string, left, total time.Duration)
+	Conf   config.Config
+	// Handlers fetches URLs by their scheme. DefaultRegistry is used if nil.
+	Handlers *Registry
+}
+
+func (b *Browser) handlers() *Registry {
+	if b.Handlers == nil {
+		return DefaultRegistry
+	}
+	return b.Handlers
+}
+
+// Fetch fetches u with the browser's handlers.
+func (b *Browser) Fetch(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	return b.handlers().Fetch(ctx, u, opts)
+}
+
+// CanFetch reports whether there is a handler for u's scheme. Other URLs
+// have to be opened with OpenExternal.
+func (b *Browser) CanFetch(u *url.URL) bool {
+	_, ok := b.handlers().Handler(u.Scheme)
+	return ok
+}
+
+func (b *Browser) FetchOpts() FetchOpts {
+	return FetchOpts{
+		CertPrompt:  b.CertPrompt,
+		Policy:      b.Conf.VerifyPolicy,
+		Input:       b.InputPrompt,
+		DownloadDir: b.Conf.DownloadDir,
+		// Someone is waiting on the other end, so a host asking to slow down
+		// is retried once, if it doesn't ask for too long.
+		SlowDownRetries: 1,
+		MaxWait:         time.Minute,
+		OnWait:          b.OnWait,
+	}
 }
 
 // TODO
@@ -25,12 +73,17 @@ func (b *Browser) GotoURL(url *url.URL, doCache bool) error {
 		b.D.History = append(b.D.History, u)
 	}
 
-	_, body, err := FetchGemini(url, true)
+	opts := b.FetchOpts()
+	opts.NoCache = !doCache
+	resp, err := b.handlers().Fetch(context.Background(), url, opts)
 	if err != nil {
 		return err
 	}
+	if resp.URL != nil {
+		u = resp.URL.String()
+	}
 
-	links := ParseLinks(body)
+	links := ParseLinks(resp.Body)
 
 	if len(b.S.Stack) != 0 {
 		b.S.Pos++
@@ -38,8 +91,10 @@ func (b *Browser) GotoURL(url *url.URL, doCache bool) error {
 
 	p := Page{
 		URL:     u,
-		Content: body,
+		Content: resp.Body,
+		Mime:    resp.Mime(),
 		Links:   links,
+		TLS:     resp.TLS,
 	}
 
 	if b.S.Pos == len(b.S.Stack) {
@@ -116,30 +171,39 @@ func DataFromJson(b []byte) (Data, error) {
 type Page struct {
 	URL     string
 	Content string
-	Links   []Link
+	// Mime is the type of Content, see Response.Mime.
+	Mime  string
+	Links []Link
+	TLS   *TLSInfo
+	// Find is the active search on this page, if any.
+	Find *Find
+}
+
+type Find struct {
+	Pattern *regexp.Regexp
+	Matches []gemtxt.Match
+	Pos     int
 }
 
 type Link struct {
-	No  int
-	URL string
+	No    int
+	URL   string
+	Label string
+	// Prompt is set for spartan's =: lines, which ask for input to send to
+	// the URL.
+	Prompt bool
 }
 
 func ParseLinks(body string) []Link {
-	scanner := bufio.NewScanner(strings.NewReader(body))
-
-	var i int
 	var links []Link
 
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if strings.HasPrefix(line, "=>") {
-			split := strings.Fields(line)
-			url := split[1]
-
+	for _, line := range gemtxt.Parse(body) {
+		if line.Type == gemtxt.LinkLine || line.Type == gemtxt.PromptLine {
 			links = append(links, Link{
-				No:  i,
-				URL: url,
+				No:     line.LinkNo,
+				URL:    line.URL,
+				Label:  line.Label,
+				Prompt: line.Type == gemtxt.PromptLine,
 			})
 		}
 	}
@@ -0,0 +1,201 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krbreyn/gemcat/geminitest"
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+var ctx = context.Background()
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestGotoURL(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "# Home\n=> /a.gmi A\n=> gemini://example.org B\n")
+	s.Page("/a.gmi", "# A\n")
+
+	b := &Browser{}
+	err := b.GotoURL(mustParse(t, s.URL("/")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := b.S.CurrPage()
+	if p.URL != s.URL("/") {
+		t.Errorf("got url %q", p.URL)
+	}
+	if len(p.Links) != 2 || p.Links[1].No != 1 || p.Links[1].URL != "gemini://example.org" {
+		t.Errorf("got links %+v", p.Links)
+	}
+	if p.TLS == nil || p.TLS.Policy != tofu.PolicyTOFU {
+		t.Errorf("got tls info %+v", p.TLS)
+	}
+
+	err = b.GotoURL(mustParse(t, s.URL("/a.gmi")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.S.Pos != 1 || len(b.S.Stack) != 2 || len(b.D.History) != 2 {
+		t.Errorf("got pos %d, stack %d, history %d", b.S.Pos, len(b.S.Stack), len(b.D.History))
+	}
+}
+
+func TestFetchGeminiRedirect(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Redirect("/old", "/older")
+	s.Redirect("/older", "/new")
+	s.Page("/new", "moved here\n")
+	s.Redirect("/loop", "/loop")
+
+	var chain []string
+	opts := FetchOpts{NoCache: true, OnRedirect: func(from, to *url.URL) {
+		chain = append(chain, from.Path+" "+to.Path)
+	}}
+	resp, err := FetchGemini(ctx, mustParse(t, s.URL("/old")), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "moved here\n" {
+		t.Errorf("got body %q", resp.Body)
+	}
+	if want := []string{"/old /older", "/older /new"}; !slices.Equal(chain, want) {
+		t.Errorf("got redirects %q, want %q", chain, want)
+	}
+
+	_, err = FetchGemini(ctx, mustParse(t, s.URL("/loop")), FetchOpts{NoCache: true})
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("got error %v for a redirect loop", err)
+	}
+}
+
+func TestFetchGeminiErrors(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Handle("/slow", geminitest.Route{Status: 20, Meta: "text/gemini", Delay: time.Second})
+	s.Handle("/private", geminitest.Route{Status: 60, Meta: "client certificate required"})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/missing", "51 not found"},
+		{"/private", "60 client certificate required"},
+		{"/slow", "failed to read response"},
+	}
+
+	for _, tt := range tests {
+		opts := FetchOpts{NoCache: true, Timeout: 200 * time.Millisecond}
+		_, err := FetchGemini(ctx, mustParse(t, s.URL(tt.path)), opts)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.path, err, tt.want)
+		}
+	}
+}
+
+func TestFetchGeminiCache(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "cached\n")
+	u := mustParse(t, s.URL("/"))
+
+	for range 2 {
+		resp, err := FetchGemini(ctx, u, FetchOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "cached\n" {
+			t.Errorf("got body %q", resp.Body)
+		}
+	}
+
+	if n := len(s.Requests()); n != 1 {
+		t.Errorf("server got %d requests, want 1", n)
+	}
+}
+
+func TestFetchGeminiCertRotation(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "hello\n")
+	u := mustParse(t, s.URL("/"))
+
+	_, err := FetchGemini(ctx, u, FetchOpts{NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RotateCert(false)
+
+	_, err = FetchGemini(ctx, u, FetchOpts{NoCache: true})
+	var cerr *CertError
+	if !errors.As(err, &cerr) || !strings.Contains(err.Error(), "mismatch") {
+		t.Fatalf("got error %v, want mismatch", err)
+	}
+
+	var asked int
+	prompt := func(d tofu.Decision) tofu.PromptFunc {
+		return func(c tofu.CertChange) tofu.Decision {
+			asked++
+			if c.NewFingerprint != tofu.CertFingerprint(s.Certificate()) {
+				t.Errorf("prompt got fingerprint %s", c.NewFingerprint)
+			}
+			return d
+		}
+	}
+
+	_, err = FetchGemini(ctx, u, FetchOpts{NoCache: true, CertPrompt: prompt(tofu.TrustOnce)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FetchGemini(ctx, u, FetchOpts{NoCache: true, CertPrompt: prompt(tofu.TrustAlways)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FetchGemini(ctx, u, FetchOpts{NoCache: true, CertPrompt: prompt(tofu.Abort)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if asked != 2 {
+		t.Errorf("prompted %d times, want 2", asked)
+	}
+}
+
+func TestFetchGeminiSPKI(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "hello\n")
+	u := mustParse(t, s.URL("/"))
+
+	spki := FetchOpts{
+		NoCache: true,
+		Policy:  func(string) tofu.Policy { return tofu.PolicySPKI },
+	}
+
+	_, err := FetchGemini(ctx, u, spki)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RotateCert(true)
+	_, err = FetchGemini(ctx, u, spki)
+	if err != nil {
+		t.Fatalf("same key was not accepted: %v", err)
+	}
+
+	s.RotateCert(false)
+	_, err = FetchGemini(ctx, u, spki)
+	if err == nil {
+		t.Fatal("new key was accepted")
+	}
+}
@@ -2,10 +2,13 @@ package browser
 
 import (
 	"bufio"
+	"cmp"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net"
 	"net/url"
 	"strconv"
@@ -16,94 +19,306 @@ import (
 	"github.com/krbreyn/gemcat/tofu"
 )
 
-func FetchGemini(url *url.URL, doCache bool) (status, body string, err error) {
+type FetchOpts struct {
+	// NoCache makes a fetch skip the cache lookup. What is fetched is still
+	// cached.
+	NoCache bool
+	// CertPrompt is asked what to do when a known host's certificate changes.
+	CertPrompt tofu.PromptFunc
+	// Policy returns the certificate verification policy for a host. If nil,
+	// tofu.DefaultPolicy is used for every host.
+	Policy func(host string) tofu.Policy
+	// Timeout bounds the connection and the response separately. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+	// Input is asked for input the server needs, like a search query. ok is
+	// false if the user cancelled.
+	Input func(prompt string) (input string, ok bool)
+	// DownloadDir is where files that aren't pages are saved. Defaults to
+	// DownloadDir().
+	DownloadDir string
+	// Delay is the least time left between requests to the same host, for
+	// automated fetches that shouldn't hammer small capsules.
+	Delay time.Duration
+	// SlowDownRetries is how many times a request answered with 44 SLOW DOWN
+	// is made again once the wait the server asked for is over.
+	SlowDownRetries int
+	// MaxWait is the longest a fetch waits for a host that asked to slow
+	// down before giving up with a SlowDownError. 0 waits as long as asked.
+	MaxWait time.Duration
+	// OnWait is called every second while a fetch waits for a host, e.g. to
+	// show a countdown.
+	OnWait func(host string, left, total time.Duration)
+	// OnRedirect is called with each redirect that is followed.
+	OnRedirect func(from, to *url.URL)
+}
 
-ifRedirect:
-	if url.Scheme != "gemini" {
-		return "", "", fmt.Errorf("only gemini connections are handled, got %s", url.String())
+const DefaultTimeout = 7 * time.Second
+
+// MaxRedirects is how many redirects in a row are followed before a fetch
+// gives up, as the spec recommends.
+const MaxRedirects = 5
+
+type Response struct {
+	Status string
+	Body   string
+	TLS    *TLSInfo
+	// URL is where the body came from, which may differ from the requested
+	// URL after a redirect or once a search query is added.
+	URL *url.URL
+	// Download is the file the response was saved to, if it wasn't a page.
+	Download string
+}
+
+// Mime is the response's mime type, or "" for downloads. Cache hits don't
+// say, so theirs is guessed from the URL, and pages converted to gemtext,
+// like gopher menus, are text/gemini.
+func (r Response) Mime() string {
+	if r.Download != "" {
+		return ""
+	}
+	fields := strings.Fields(r.Status)
+	if len(fields) > 1 && strings.Contains(fields[1], "/") {
+		mime, _, _ := strings.Cut(fields[1], ";")
+		return mime
+	}
+	if strings.HasSuffix(r.Status, "[cache hit]") && r.URL != nil {
+		return MimeType(r.URL.Path)
 	}
+	return "text/gemini"
+}
 
-	host, path := url.Host, url.Path
+// IsGemtext reports whether the mime type in the response's status is
+// text/gemini. Cache hits have no mime type, so they never are.
+func (r Response) IsGemtext() bool {
+	fields := strings.Fields(r.Status)
+	return len(fields) > 1 && strings.HasPrefix(fields[1], "text/gemini")
+}
 
-	tlsDialer := &tls.Dialer{
-		NetDialer: &net.Dialer{
-			Timeout: 7 * time.Second,
-		},
-		Config: &tls.Config{
-			InsecureSkipVerify: true,
-			VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-				return tofu.HandleTOFU(rawCerts, host)
-			},
-		},
+// StatusError is a response that was neither a success nor a redirect.
+type StatusError struct {
+	Code int
+	Meta string
+	// URL is what was requested, after any redirects.
+	URL *url.URL
+}
+
+func (e *StatusError) Error() string {
+	if e.Meta == "" {
+		return fmt.Sprintf("status was not 2x but was %d", e.Code)
+	}
+	return fmt.Sprintf("status was not 2x but was %d %s", e.Code, e.Meta)
+}
+
+// CertError is a server certificate that failed verification.
+type CertError struct {
+	Host string
+	Err  error
+}
+
+func (e *CertError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CertError) Unwrap() error {
+	return e.Err
+}
+
+// TLSInfo describes the connection a page was fetched over. Pages loaded from
+// the cache have none.
+type TLSInfo struct {
+	Version     string
+	CipherSuite string
+	Policy      tofu.Policy
+	Certs       []*x509.Certificate
+}
+
+func newTLSInfo(state tls.ConnectionState, policy tofu.Policy) *TLSInfo {
+	return &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		Policy:      policy,
+		Certs:       state.PeerCertificates,
+	}
+}
+
+// FetchGemini fetches a gemini URL, following redirects. A 44 SLOW DOWN
+// keeps every fetch away from the host for as long as it asked, and is
+// retried up to opts.SlowDownRetries times.
+func FetchGemini(ctx context.Context, url *url.URL, opts FetchOpts) (Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := fetchGemini(ctx, url, opts)
+
+		var serr *StatusError
+		if !errors.As(err, &serr) || serr.Code != 44 {
+			return resp, err
+		}
+		wait, ok := ParseSlowDown(serr.Meta)
+		if !ok {
+			wait = DefaultSlowDown
+		}
+		Limiter.Hold(serr.URL.Hostname(), wait)
+		if attempt >= opts.SlowDownRetries {
+			return resp, err
+		}
+	}
+}
+
+func fetchGemini(ctx context.Context, url *url.URL, opts FetchOpts) (resp Response, err error) {
+	redirects := 0
+
+ifRedirect:
+	if url.Scheme != "gemini" {
+		return resp, fmt.Errorf("only gemini connections are handled, got %s", url.String())
 	}
 
-	if doCache {
+	timeout := cmp.Or(opts.Timeout, DefaultTimeout)
+
+	if !opts.NoCache {
 		isStale, err := data.IsCacheStale(url, time.Hour*24)
 		if err != nil {
-			return "", "", fmt.Errorf("cache error: %w\n", err)
+			return resp, fmt.Errorf("cache error: %w\n", err)
 		}
 
 		if !isStale {
 			content, err := data.LoadFromCache(url)
 			if err != nil {
-				return "", "", fmt.Errorf("cache error: %w\n", err)
+				return resp, fmt.Errorf("cache error: %w\n", err)
 			} else {
 				// fmt.Println("cache hit")
-				return "20 [cache hit]", string(content), nil
+				return Response{Status: "20 [cache hit]", Body: string(content), URL: url}, nil
 			}
 		}
 	}
 
-	addr := net.JoinHostPort(host, "1965")
-	conn, err := tlsDialer.Dial("tcp", addr)
+	conn, tlsInfo, err := dialGemini(ctx, url, opts, timeout)
 	if err != nil {
-		return "", "", fmt.Errorf("TLS connection failed: %v", err)
+		return resp, err
 	}
 	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	resp.TLS = tlsInfo
 
-	fmt.Fprintf(conn, "gemini://%s/%s\r\n", host, path)
+	conn.SetDeadline(time.Now().Add(timeout))
+	req := *url
+	req.Fragment = ""
+	fmt.Fprintf(conn, "%s\r\n", req.String())
 
 	reader := bufio.NewReader(conn)
-	status, err = reader.ReadString('\n')
-	if err != nil {
-		log.Fatal("Failed to read response:", err)
-	}
-
-	status_no, err := strconv.Atoi(strings.Fields(status)[0])
+	status, status_no, meta, err := readHeader(reader)
 	if err != nil {
-		return status, "", fmt.Errorf("weird status err: %v", err)
+		return resp, err
 	}
 
 	// TODO integrate this function with browser to update history properly
 	if status_no >= 30 && status_no <= 39 {
-		url, err = url.Parse(strings.Fields(status)[1])
+		if meta == "" {
+			return resp, errors.New("redirect without a url")
+		}
+		to, err := url.Parse(meta)
 		if err != nil {
-			return status, "", fmt.Errorf("redirect url parse error: %w", err)
+			return resp, fmt.Errorf("redirect url parse error: %w", err)
 		}
+		redirects++
+		if redirects > MaxRedirects {
+			return resp, fmt.Errorf("more than %d redirects, last to %s", MaxRedirects, to)
+		}
+		if opts.OnRedirect != nil {
+			opts.OnRedirect(url, to)
+		}
+		url = to
 		// TODO use an OutputObject?
 		// fmt.Printf("Redirect: %s\r\n", new_url.String())
 		goto ifRedirect
 	}
 
-	if status_no < 20 && status_no > 29 {
-		return status, "", fmt.Errorf("status was not 2x but was %d", status_no)
+	if status_no < 20 || status_no > 29 {
+		return resp, &StatusError{Code: status_no, Meta: meta, URL: url}
 	}
 
-	var b strings.Builder
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			break
-		}
-		b.WriteString(line)
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return resp, fmt.Errorf("failed to read body: %w", err)
 	}
 
-	content := b.String()
+	content := string(body)
 
 	err = data.CacheGemFile(url, []byte(content))
 	if err != nil {
-		return "", "", fmt.Errorf("cache err: %w", err)
+		return resp, fmt.Errorf("cache err: %w", err)
+	}
+
+	resp.Status = status
+	resp.Body = content
+	resp.URL = url
+	return resp, nil
+}
+
+// dialGemini connects to u's host once the rate limiter allows it, and
+// verifies its certificate. u may be gemini or titan.
+func dialGemini(ctx context.Context, u *url.URL, opts FetchOpts, timeout time.Duration) (*tls.Conn, *TLSInfo, error) {
+	host := u.Hostname()
+	err := Limiter.Wait(ctx, host, opts.Delay, opts.MaxWait, waitFunc(host, opts.OnWait))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsDialer := &tls.Dialer{
+		NetDialer: &net.Dialer{
+			Timeout: timeout,
+		},
+		Config: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "1965"
+	}
+
+	addr := net.JoinHostPort(host, port)
+	conn, err := tlsDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("TLS connection failed: %w", err)
 	}
+	tlsConn := conn.(*tls.Conn)
 
-	return status, content, nil
+	policy := tofu.DefaultPolicy
+	if opts.Policy != nil {
+		policy = opts.Policy(host)
+	}
+
+	// Certificates are checked after the handshake rather than in
+	// VerifyPeerCertificate so that prompting the user doesn't eat into the
+	// dial timeout.
+	state := tlsConn.ConnectionState()
+	err = tofu.Verify(state, u.Host, policy, opts.CertPrompt)
+	if err != nil {
+		conn.Close()
+		return nil, nil, &CertError{Host: u.Host, Err: err}
+	}
+	return tlsConn, newTLSInfo(state, policy), nil
+}
+
+// readHeader reads a response header, returning the whole line, its status
+// code and its meta.
+func readHeader(r *bufio.Reader) (status string, code int, meta string, err error) {
+	status, err = r.ReadString('\n')
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	fields := strings.Fields(status)
+	if len(fields) == 0 {
+		return "", 0, "", errors.New("empty status line")
+	}
+
+	code, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return "", 0, "", fmt.Errorf("weird status err: %v", err)
+	}
+	meta = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(status), fields[0]))
+	return status, code, meta, nil
 }
@@ -0,0 +1,139 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IndexFile is shown in place of a directory's listing when the directory
+// has one, like a mirror's directories do.
+const IndexFile = "index.gmi"
+
+// FetchFile reads a local file:// URL. Gemtext and other text files are
+// pages, and directories are listed as gemtext. Their URLs end in a slash so
+// that relative links from them resolve inside them.
+func FetchFile(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return Response{}, fmt.Errorf("can't read files on %s", u.Host)
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	name := filepath.FromSlash(p)
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if info.IsDir() {
+		dir := &url.URL{Scheme: "file", Path: strings.TrimSuffix(p, "/") + "/"}
+		index, err := os.ReadFile(filepath.Join(name, IndexFile))
+		if err == nil {
+			return Response{Status: "20 text/gemini", Body: string(index), URL: dir}, nil
+		}
+		body, err := listDir(name, dir.Path)
+		if err != nil {
+			return Response{}, err
+		}
+		return Response{Status: "20 text/gemini", Body: body, URL: dir}, nil
+	}
+
+	mimeType := MimeType(name)
+	if !strings.HasPrefix(mimeType, "text/") {
+		return Response{}, fmt.Errorf("%s is %s, not a page", name, mimeType)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Status: "20 " + mimeType, Body: string(content), URL: u}, nil
+}
+
+// MimeType guesses a local file's type by its extension, taking files
+// without one to be plain text.
+func MimeType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	switch ext {
+	case ".gmi", ".gemini":
+		return "text/gemini"
+	case "":
+		return "text/plain"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// listDir makes a gemtext listing of a directory, subdirectories first.
+// Hidden files are left out.
+func listDir(name, urlPath string) (string, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", urlPath)
+	if urlPath != "/" {
+		sb.WriteString("=> ../ ..\n")
+	}
+
+	var files []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		link := (&url.URL{Path: e.Name()}).String()
+		// A name with a colon would otherwise be taken as a scheme.
+		if strings.Contains(e.Name(), ":") {
+			link = "./" + link
+		}
+		if e.IsDir() {
+			fmt.Fprintf(&sb, "=> %s/ %s/\n", link, e.Name())
+			continue
+		}
+		files = append(files, fmt.Sprintf("=> %s %s\n", link, e.Name()))
+	}
+	for _, f := range files {
+		sb.WriteString(f)
+	}
+	return sb.String(), nil
+}
+
+// isLocalPath reports whether s is a path to a local file rather than a host.
+func isLocalPath(s string) bool {
+	return s == "." || s == ".." || s == "~" ||
+		strings.HasPrefix(s, "/") || strings.HasPrefix(s, "./") ||
+		strings.HasPrefix(s, "../") || strings.HasPrefix(s, "~/")
+}
+
+// fileURL turns a local path into an absolute file:// URL.
+func fileURL(s string) (*url.URL, error) {
+	name := s
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.Join(home, s[1:])
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := filepath.ToSlash(abs)
+	// Abs drops the trailing slash of a directory, which is worth keeping.
+	if strings.HasSuffix(s, "/") && p != "/" {
+		p += "/"
+	}
+	return &url.URL{Scheme: "file", Path: p}, nil
+}
@@ -0,0 +1,124 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func TestFetchFile(t *testing.T) {
+	geminitest.SetTempDirs(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"notes.gmi":           "# Notes\n=> mirror/ Mirror\n",
+		"todo":                "buy milk\n",
+		"a b.gmi":             "spaces\n",
+		".hidden":             "secret\n",
+		"img.png":             "\x89PNG",
+		"mirror/index.gmi":    "# Mirror\n=> log/post.gmi Post\n",
+		"mirror/log/post.gmi": "# Post\n=> ../index.gmi Home\n",
+	}
+	for name, body := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		if err := os.WriteFile(full, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "empty"), 0755)
+
+	u, err := ParseURL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Fetch(ctx, u, FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := "file://" + filepath.ToSlash(dir) + "/"
+	if resp.URL.String() != root {
+		t.Errorf("got url %s, want %s", resp.URL, root)
+	}
+	want := "# " + filepath.ToSlash(dir) + "/\n\n" +
+		"=> ../ ..\n" +
+		"=> empty/ empty/\n" +
+		"=> mirror/ mirror/\n" +
+		"=> a%20b.gmi a b.gmi\n" +
+		"=> img.png img.png\n" +
+		"=> notes.gmi notes.gmi\n" +
+		"=> todo todo\n"
+	if resp.Body != want {
+		t.Errorf("got listing:\n%s\nwant:\n%s", resp.Body, want)
+	}
+
+	// Links between local files resolve, and a directory with an index
+	// shows it instead of a listing.
+	b := &Browser{}
+	steps := []struct{ link, url, body string }{
+		{root + "notes.gmi", root + "notes.gmi", files["notes.gmi"]},
+		{"mirror/", root + "mirror/", files["mirror/index.gmi"]},
+		{"log/post.gmi", root + "mirror/log/post.gmi", files["mirror/log/post.gmi"]},
+		{"../index.gmi", root + "mirror/index.gmi", files["mirror/index.gmi"]},
+		{"../a%20b.gmi", root + "a%20b.gmi", "spaces\n"},
+		{"todo", root + "todo", "buy milk\n"},
+	}
+	for _, step := range steps {
+		next := mustParse(t, step.link)
+		if cur := b.S.CurrURL(); cur != "" {
+			next = mustParse(t, cur).ResolveReference(next)
+		}
+		err := b.GotoURL(next, true)
+		if err != nil {
+			t.Fatalf("%s: %v", step.link, err)
+		}
+		page := b.S.CurrPage()
+		if page.URL != step.url || page.Content != step.body {
+			t.Errorf("%s: got %s %q, want %s %q", step.link, page.URL, page.Content, step.url, step.body)
+		}
+	}
+
+	for _, bad := range []string{root + "img.png", root + "missing.gmi", "file://example.org/notes.gmi"} {
+		_, err := Fetch(ctx, mustParse(t, bad), FetchOpts{})
+		if err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestParseURLLocal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in, want string
+	}{
+		{"/tmp/a.gmi", "file:///tmp/a.gmi"},
+		{"/tmp/dir/", "file:///tmp/dir/"},
+		{"/", "file:///"},
+		{"./a.gmi", "file://" + filepath.ToSlash(wd) + "/a.gmi"},
+		{"..", "file://" + filepath.ToSlash(filepath.Dir(wd))},
+		{"~/notes/", "file://" + filepath.ToSlash(home) + "/notes/"},
+		{"file:///tmp/a.gmi", "file:///tmp/a.gmi"},
+	}
+	for _, tt := range tests {
+		u, err := ParseURL(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if u.String() != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.in, u, tt.want)
+		}
+	}
+
+	if u, _ := ParseURL("notes.gmi"); !strings.HasPrefix(u.String(), "gemini://") {
+		t.Errorf("a bare name was taken as a file: %s", u)
+	}
+}
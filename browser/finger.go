@@ -0,0 +1,97 @@
+package browser
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FetchFinger asks a finger server (RFC 1288) about the user in a
+// finger://host/user or finger://user@host URL, or for the list of users
+// if there isn't one. The answer is shown as preformatted text, and isn't
+// cached since it's usually about what someone is up to right now.
+func FetchFinger(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	if u.Scheme != "finger" {
+		return Response{}, fmt.Errorf("not a finger url: %s", u.String())
+	}
+	user := strings.TrimPrefix(u.Path, "/")
+	if user == "" && u.User != nil {
+		user = u.User.Username()
+	}
+	if strings.ContainsAny(user, "\r\n") {
+		return Response{}, fmt.Errorf("bad finger user %q", user)
+	}
+
+	var body []byte
+	err := plainRequest(ctx, u, "79", user, opts, func(r io.Reader) error {
+		var err error
+		body, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		return Response{}, err
+	}
+	return Response{Status: "finger", Body: preformatted(textLines(string(body))), URL: u}, nil
+}
+
+// plainRequest sends a line to u's host over plain TCP, like gopher, finger
+// and nex do, and hands the response to read. Reading fails once the server
+// has gone quiet for the timeout.
+func plainRequest(ctx context.Context, u *url.URL, defaultPort, line string, opts FetchOpts, read func(r io.Reader) error) error {
+	timeout := cmp.Or(opts.Timeout, DefaultTimeout)
+
+	host := u.Hostname()
+	err := Limiter.Wait(ctx, host, opts.Delay, opts.MaxWait, waitFunc(host, opts.OnWait))
+	if err != nil {
+		return err
+	}
+
+	port := cmp.Or(u.Port(), defaultPort)
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err = fmt.Fprintf(conn, "%s\r\n", line)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	err = read(idleReader{conn: conn, timeout: timeout})
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	return nil
+}
+
+// textLines splits text into lines without their line endings, dropping the
+// empty one after a final newline.
+func textLines(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// preformatted wraps lines in a gemtext preformatted block.
+func preformatted(lines []string) string {
+	var sb strings.Builder
+	sb.WriteString("```\n")
+	for _, line := range lines {
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("```\n")
+	return sb.String()
+}
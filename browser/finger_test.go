@@ -0,0 +1,36 @@
+package browser
+
+import (
+	"testing"
+)
+
+func TestFetchFinger(t *testing.T) {
+	addr := newGopherServer(t, map[string]string{
+		"":    "Login  Name\r\nada    Ada Lovelace\r\n",
+		"ada": "Plan:\r\n```\r\n  Computing engines.\r\n",
+	})
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"finger://" + addr, "```\nLogin  Name\nada    Ada Lovelace\n```\n"},
+		{"finger://" + addr + "/ada", "```\nPlan:\n```\n  Computing engines.\n```\n"},
+		{"finger://ada@" + addr, "```\nPlan:\n```\n  Computing engines.\n```\n"},
+	}
+	for _, tt := range tests {
+		resp, err := FetchFinger(ctx, mustParse(t, tt.url), FetchOpts{})
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if resp.Body != tt.want || resp.Status != "finger" {
+			t.Errorf("%s: got %q %q, want %q", tt.url, resp.Status, resp.Body, tt.want)
+		}
+	}
+
+	_, err := FetchFinger(ctx, mustParse(t, "finger://"+addr+"/a%0Db"), FetchOpts{})
+	if err == nil {
+		t.Error("a user with a line break was sent")
+	}
+}
@@ -0,0 +1,332 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/data"
+)
+
+// Gopher item types from RFC 1436, plus the common 'i' and 'h' extensions.
+const (
+	GopherText   = '0'
+	GopherMenu   = '1'
+	GopherError  = '3'
+	GopherSearch = '7'
+	GopherTelnet = '8'
+	GopherTN3270 = 'T'
+	GopherInfo   = 'i'
+	GopherHTML   = 'h'
+)
+
+// gopherTarget splits a gopher URL (RFC 4266) into its item type, selector
+// and search query. URLs without a type are menus.
+func gopherTarget(u *url.URL) (itemType byte, selector, query string) {
+	p := u.Path
+	if len(p) < 2 {
+		return GopherMenu, "", ""
+	}
+
+	itemType = p[1]
+	selector = p[2:]
+	if i := strings.IndexByte(selector, '\t'); i != -1 {
+		selector, query = selector[:i], selector[i+1:]
+		// Anything after a second tab is for gopher+, which isn't supported.
+		if j := strings.IndexByte(query, '\t'); j != -1 {
+			query = query[:j]
+		}
+	}
+
+	if u.RawQuery != "" {
+		raw, err := url.QueryUnescape(u.RawQuery)
+		if err != nil {
+			raw = u.RawQuery
+		}
+		if itemType == GopherSearch && query == "" {
+			query = raw
+		} else {
+			selector += "?" + raw
+		}
+	}
+
+	return itemType, selector, query
+}
+
+func gopherURL(itemType byte, selector, host, port string) string {
+	if port != "" && port != "70" {
+		host = net.JoinHostPort(host, port)
+	}
+	u := url.URL{
+		Scheme: "gopher",
+		Host:   host,
+		Path:   "/" + string(itemType) + selector,
+	}
+	return u.String()
+}
+
+// isGopherBinary reports whether an item type is downloaded rather than
+// shown.
+func isGopherBinary(itemType byte) bool {
+	switch itemType {
+	case GopherText, GopherMenu, GopherError, GopherSearch, GopherInfo, GopherHTML,
+		GopherTelnet, GopherTN3270:
+		return false
+	}
+	return true
+}
+
+// FetchGopher fetches a gopher URL. Menus and search results are converted
+// to gemtext and text files are wrapped in a preformatted block, so both
+// work with link numbers like any gemini page. Anything else is saved to
+// the download dir.
+func FetchGopher(ctx context.Context, u *url.URL, opts FetchOpts) (resp Response, err error) {
+	if u.Scheme != "gopher" {
+		return resp, fmt.Errorf("not a gopher url: %s", u.String())
+	}
+
+	itemType, selector, query := gopherTarget(u)
+	switch itemType {
+	case GopherInfo, GopherError, GopherTelnet, GopherTN3270:
+		return resp, fmt.Errorf("gopher item type '%c' can't be fetched", itemType)
+	}
+
+	// Search results can change at any time, and downloads aren't pages.
+	doCache := itemType != GopherSearch && !isGopherBinary(itemType)
+
+	if itemType == GopherSearch {
+		if query == "" {
+			if opts.Input == nil {
+				return resp, errors.New("search needs a query")
+			}
+			q, ok := opts.Input("search: ")
+			if !ok {
+				return resp, errors.New("search cancelled")
+			}
+			query = q
+
+			searched := *u
+			searched.Path = "/" + string(GopherSearch) + selector + "\t" + query
+			searched.RawPath = ""
+			searched.RawQuery = ""
+			u = &searched
+		}
+	}
+	if doCache && !opts.NoCache {
+		isStale, err := data.IsCacheStale(u, time.Hour*24)
+		if err != nil {
+			return resp, fmt.Errorf("cache error: %w\n", err)
+		}
+
+		if !isStale {
+			content, err := data.LoadFromCache(u)
+			if err != nil {
+				return resp, fmt.Errorf("cache error: %w\n", err)
+			}
+			return Response{Status: "20 [cache hit]", Body: string(content), URL: u}, nil
+		}
+	}
+
+	req := selector
+	if itemType == GopherSearch {
+		req += "\t" + query
+	}
+	resp.URL = u
+
+	var body []byte
+	err = plainRequest(ctx, u, "70", req, opts, func(r io.Reader) error {
+		if isGopherBinary(itemType) {
+			path, n, err := saveDownload(r, opts.DownloadDir, selector)
+			if err != nil {
+				return err
+			}
+			resp.Status = "gopher download"
+			resp.Download = path
+			resp.Body = fmt.Sprintf("# Download\n\nSaved %d bytes from %s to:\n```\n%s\n```\n", n, u, path)
+			return nil
+		}
+		var err error
+		body, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil || isGopherBinary(itemType) {
+		return resp, err
+	}
+
+	var content string
+	if itemType == GopherText {
+		resp.Status = "gopher text"
+		content = gopherTextToGemtext(string(body))
+	} else {
+		resp.Status = "gopher menu"
+		content = GophermapToGemtext(string(body))
+	}
+
+	if doCache {
+		err = data.CacheGemFile(u, []byte(content))
+		if err != nil {
+			return resp, fmt.Errorf("cache err: %w", err)
+		}
+	}
+
+	resp.Body = content
+	return resp, nil
+}
+
+// idleReader fails once the connection has been idle for longer than
+// timeout, rather than bounding how long the whole response may take.
+type idleReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
+
+// gopherLines splits a gopher response into lines, stopping at the lone "."
+// that ends it and undoing the doubling of leading dots.
+func gopherLines(body string) []string {
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "." {
+			break
+		}
+		if strings.HasPrefix(line, "..") {
+			line = line[1:]
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func gopherTextToGemtext(body string) string {
+	return preformatted(gopherLines(body))
+}
+
+// GophermapToGemtext converts a gopher menu to gemtext. Items become links,
+// and runs of info lines become preformatted blocks since they are often
+// laid out with spaces.
+func GophermapToGemtext(menu string) string {
+	var sb strings.Builder
+	inPre := false
+
+	setPre := func(pre bool) {
+		if pre != inPre {
+			sb.WriteString("```\n")
+			inPre = pre
+		}
+	}
+
+	for _, line := range gopherLines(menu) {
+		// A line starting with a tab has no item type to go by.
+		if line == "" || line[0] == '\t' {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		itemType, display := line[0], fields[0][1:]
+		selector, host, port := fields[1], fields[2], fields[3]
+
+		if itemType == GopherInfo {
+			setPre(true)
+			sb.WriteString(display + "\n")
+			continue
+		}
+		setPre(false)
+
+		switch {
+		case itemType == GopherError:
+			fmt.Fprintf(&sb, "error: %s\n", display)
+		case itemType == GopherHTML && strings.HasPrefix(selector, "URL:"):
+			fmt.Fprintf(&sb, "=> %s %s\n", selector[len("URL:"):], display)
+		case itemType == GopherTelnet || itemType == GopherTN3270:
+			u := url.URL{Scheme: "telnet", Host: net.JoinHostPort(host, port)}
+			fmt.Fprintf(&sb, "=> %s %s (telnet)\n", u.String(), display)
+		case itemType == GopherSearch:
+			fmt.Fprintf(&sb, "=> %s %s (search)\n", gopherURL(itemType, selector, host, port), display)
+		case isGopherBinary(itemType):
+			fmt.Fprintf(&sb, "=> %s %s (download)\n", gopherURL(itemType, selector, host, port), display)
+		default:
+			fmt.Fprintf(&sb, "=> %s %s\n", gopherURL(itemType, selector, host, port), display)
+		}
+	}
+	setPre(false)
+
+	return sb.String()
+}
+
+// DownloadDir is where downloads go when no dir is configured:
+// $XDG_DOWNLOAD_DIR, ~/Downloads if it exists, or else the working dir.
+func DownloadDir() string {
+	if dir := os.Getenv("XDG_DOWNLOAD_DIR"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		dir := filepath.Join(home, "Downloads")
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return "."
+}
+
+// saveDownload writes r to a new file in dir named after the selector,
+// never overwriting an existing file.
+func saveDownload(r io.Reader, dir, selector string) (string, int64, error) {
+	if dir == "" {
+		dir = DownloadDir()
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create download dir: %w", err)
+	}
+
+	name := path.Base(strings.ReplaceAll(selector, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "download"
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	var f *os.File
+	for i := 0; ; i++ {
+		p := filepath.Join(dir, name)
+		if i > 0 {
+			p = filepath.Join(dir, base+"."+strconv.Itoa(i)+ext)
+		}
+		f, err = os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", 0, fmt.Errorf("failed to create download: %w", err)
+		}
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, fmt.Errorf("download failed: %w", err)
+	}
+	return f.Name(), n, nil
+}
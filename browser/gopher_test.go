@@ -0,0 +1,156 @@
+package browser
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+// newGopherServer serves the responses in routes, keyed by the request line
+// without its CRLF. The server's address is substituted for "HOST\tPORT".
+func newGopherServer(t *testing.T, routes map[string]string) string {
+	t.Helper()
+
+	geminitest.SetTempDirs(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := bufio.NewReader(conn).ReadString('\n')
+				if err != nil {
+					return
+				}
+				resp, ok := routes[strings.TrimSuffix(req, "\r\n")]
+				if !ok {
+					resp = "3not found\t\terror.host\t1\r\n.\r\n"
+				}
+				conn.Write([]byte(strings.ReplaceAll(resp, "HOST\tPORT", host+"\t"+port)))
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestGophermapToGemtext(t *testing.T) {
+	menu := "iWelcome\t\tnull.host\t1\r\n" +
+		"i  ~~~ \t\tnull.host\t1\r\n" +
+		"1Docs\t/docs\texample.org\t70\r\n" +
+		"0About me\t/about.txt\texample.org\t7070\r\n" +
+		"7Search\t/search\texample.org\t70\r\n" +
+		"9Archive\t/files/a b.zip\texample.org\t70\r\n" +
+		"hWeb\tURL:https://example.com/\texample.org\t70\r\n" +
+		"3Oops\t\terror.host\t1\r\n" +
+		"\tsel\thost\t70\r\n" +
+		".\r\n" +
+		"1After the end\t/\texample.org\t70\r\n"
+
+	want := "```\n" +
+		"Welcome\n" +
+		"  ~~~ \n" +
+		"```\n" +
+		"=> gopher://example.org/1/docs Docs\n" +
+		"=> gopher://example.org:7070/0/about.txt About me\n" +
+		"=> gopher://example.org/7/search Search (search)\n" +
+		"=> gopher://example.org/9/files/a%20b.zip Archive (download)\n" +
+		"=> https://example.com/ Web\n" +
+		"error: Oops\n"
+
+	if got := GophermapToGemtext(menu); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFetchGopher(t *testing.T) {
+	addr := newGopherServer(t, map[string]string{
+		"":            "iHello\t\tnull.host\t1\r\n0Read me\t/readme\tHOST\tPORT\r\n7Find\t/find\tHOST\tPORT\r\n.\r\n",
+		"/readme":     "=> not a link\r\n..dotted\r\n.\r\n",
+		"/find\tcats": "1Cats\t/cats\tHOST\tPORT\r\n.\r\n",
+		"/file.bin":   "\x00\x01binary",
+	})
+
+	b := &Browser{}
+	err := b.GotoURL(mustParse(t, "gopher://"+addr), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := b.S.CurrPage().Links
+	if len(links) != 2 || links[0].URL != "gopher://"+addr+"/0/readme" {
+		t.Fatalf("got links %+v", links)
+	}
+
+	err = b.GotoURL(mustParse(t, links[0].URL), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.S.CurrPage().Content; got != "```\n=> not a link\n.dotted\n```\n" {
+		t.Errorf("got text page %q", got)
+	}
+	if len(b.S.CurrPage().Links) != 0 {
+		t.Error("a text file had links")
+	}
+
+	err = b.GotoURL(mustParse(t, links[1].URL), true)
+	if err == nil {
+		t.Error("a search without a way to ask for a query succeeded")
+	}
+
+	var prompts []string
+	b.InputPrompt = func(prompt string) (string, bool) {
+		prompts = append(prompts, prompt)
+		return "cats", true
+	}
+	err = b.GotoURL(mustParse(t, links[1].URL), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 1 {
+		t.Errorf("got prompts %q", prompts)
+	}
+	p := b.S.CurrPage()
+	if p.URL != "gopher://"+addr+"/7/find%09cats" || len(p.Links) != 1 {
+		t.Errorf("got search page %s with links %+v", p.URL, p.Links)
+	}
+
+	// The query is in the URL now, so going there again shouldn't ask.
+	err = b.GotoURL(mustParse(t, p.URL), true)
+	if err != nil || len(prompts) != 1 {
+		t.Errorf("revisiting a search: %v, prompts %q", err, prompts)
+	}
+
+	resp, err := FetchGopher(ctx, mustParse(t, "gopher://"+addr+"/9/file.bin"), FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(resp.Download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "\x00\x01binary" || filepath.Base(resp.Download) != "file.bin" {
+		t.Errorf("downloaded %q to %s", content, resp.Download)
+	}
+
+	resp, err = FetchGopher(ctx, mustParse(t, "gopher://"+addr+"/9/file.bin"), FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(resp.Download) != "file.1.bin" {
+		t.Errorf("second download went to %s", resp.Download)
+	}
+}
@@ -0,0 +1,246 @@
+package browser
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/data"
+)
+
+// GuppyRetransmit is how long a guppy request waits for an answer before
+// it is sent again. UDP packets can get lost on the way either way.
+var GuppyRetransmit = 2 * time.Second
+
+// guppyMaxRequest is the longest request the guppy spec allows, CRLF
+// included.
+const guppyMaxRequest = 2048
+
+// FetchGuppy fetches a guppy URL over UDP, following redirects and asking
+// opts.Input for input when the server wants some. The answer comes in
+// sequence-numbered packets that are acknowledged one by one and put back
+// in order. Only pages without a query are cached.
+func FetchGuppy(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	redirects := 0
+	for {
+		resp, to, err := fetchGuppy(ctx, u, opts)
+		var serr *StatusError
+		switch {
+		case errors.As(err, &serr) && serr.Code == 1 && u.RawQuery == "" && opts.Input != nil:
+			input, ok := opts.Input(cmp.Or(serr.Meta, "input") + ": ")
+			if !ok {
+				return resp, errors.New("input cancelled")
+			}
+			q := *u
+			q.RawQuery = url.QueryEscape(input)
+			u = &q
+		case err != nil || to == nil:
+			return resp, err
+		default:
+			redirects++
+			if redirects > MaxRedirects {
+				return resp, fmt.Errorf("more than %d redirects, last to %s", MaxRedirects, to)
+			}
+			if opts.OnRedirect != nil {
+				opts.OnRedirect(u, to)
+			}
+			u = to
+		}
+	}
+}
+
+// fetchGuppy makes a single request, returning where it redirects to if it
+// does.
+func fetchGuppy(ctx context.Context, u *url.URL, opts FetchOpts) (Response, *url.URL, error) {
+	if u.Scheme != "guppy" {
+		return Response{}, nil, fmt.Errorf("only guppy connections are handled, got %s", u)
+	}
+	req := *u
+	req.Fragment = ""
+	req.RawFragment = ""
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	line := req.String() + "\r\n"
+	if len(line) > guppyMaxRequest {
+		return Response{}, nil, fmt.Errorf("request is longer than %d bytes", guppyMaxRequest)
+	}
+
+	doCache := u.RawQuery == ""
+	if doCache && !opts.NoCache {
+		isStale, err := data.IsCacheStale(u, time.Hour*24)
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("cache error: %w\n", err)
+		}
+
+		if !isStale {
+			content, err := data.LoadFromCache(u)
+			if err != nil {
+				return Response{}, nil, fmt.Errorf("cache error: %w\n", err)
+			}
+			return Response{Status: "guppy [cache hit]", Body: string(content), URL: u}, nil, nil
+		}
+	}
+
+	timeout := cmp.Or(opts.Timeout, DefaultTimeout)
+
+	host := u.Hostname()
+	err := Limiter.Wait(ctx, host, opts.Delay, opts.MaxWait, waitFunc(host, opts.OnWait))
+	if err != nil {
+		return Response{}, nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(host, cmp.Or(u.Port(), "6775")))
+	if err != nil {
+		return Response{}, nil, fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var a guppyAssembler
+	buf := make([]byte, 65535)
+	lastHeard := time.Now()
+	send := true
+	for {
+		// The request is sent again until the first packet of the answer
+		// arrives. After that it's up to the server to resend packets
+		// whose acks got lost.
+		if send {
+			_, err = conn.Write([]byte(line))
+			if err != nil {
+				return Response{}, nil, fmt.Errorf("failed to send request: %w", err)
+			}
+		}
+
+		conn.SetReadDeadline(time.Now().Add(min(GuppyRetransmit, timeout)))
+		n, err := conn.Read(buf)
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() && ctx.Err() == nil {
+			if time.Since(lastHeard) >= timeout {
+				return Response{}, nil, fmt.Errorf("timed out after %s without an answer", timeout)
+			}
+			send = a.mime == ""
+			continue
+		}
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		lastHeard = time.Now()
+		send = false
+
+		p, err := parseGuppyPacket(buf[:n])
+		if err != nil {
+			return Response{}, nil, err
+		}
+		switch {
+		case p.seq == 1 || p.seq == 4:
+			return Response{}, nil, &StatusError{Code: p.seq, Meta: p.meta, URL: u}
+		case p.seq == 3:
+			to, err := u.Parse(p.meta)
+			if err != nil {
+				return Response{}, nil, fmt.Errorf("redirect url parse error: %w", err)
+			}
+			return Response{}, to, nil
+		case p.seq < 6:
+			return Response{}, nil, fmt.Errorf("unknown guppy status %d", p.seq)
+		}
+
+		// Every packet is acknowledged, even one seen before, since its
+		// ack may be the one that got lost.
+		_, err = fmt.Fprintf(conn, "%d\r\n", p.seq)
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("failed to acknowledge packet: %w", err)
+		}
+		a.add(p)
+		if a.done() {
+			break
+		}
+	}
+
+	content := a.content()
+	if doCache {
+		err = data.CacheGemFile(u, content)
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("cache err: %w", err)
+		}
+	}
+	return Response{Status: "guppy " + a.mime, Body: string(content), URL: u}, nil, nil
+}
+
+// guppyPacket is one packet of a guppy response. seq is the status for
+// input prompts, redirects and errors, which are single packets.
+type guppyPacket struct {
+	seq int
+	// meta is the mime type of the first packet of a page, and the prompt,
+	// URL or error of the others.
+	meta string
+	data []byte
+}
+
+func parseGuppyPacket(b []byte) (guppyPacket, error) {
+	header, body, ok := bytes.Cut(b, []byte("\r\n"))
+	if !ok {
+		return guppyPacket{}, errors.New("guppy packet without a header")
+	}
+	num, meta, _ := strings.Cut(string(header), " ")
+	seq, err := strconv.Atoi(num)
+	if err != nil || seq < 0 {
+		return guppyPacket{}, fmt.Errorf("bad guppy packet header %q", header)
+	}
+	return guppyPacket{seq: seq, meta: meta, data: body}, nil
+}
+
+// guppyAssembler puts a page's packets back in order. Packets can arrive
+// in any order and more than once. The first one has the mime type and the
+// last one has no data.
+type guppyAssembler struct {
+	mime   string
+	first  int
+	last   int
+	chunks map[int][]byte
+}
+
+func (a *guppyAssembler) add(p guppyPacket) {
+	if a.chunks == nil {
+		a.chunks = make(map[int][]byte)
+	}
+	// The data is in the read buffer, which gets reused.
+	a.chunks[p.seq] = bytes.Clone(p.data)
+	switch {
+	case p.meta != "":
+		a.mime = p.meta
+		a.first = p.seq
+	case len(p.data) == 0:
+		a.last = p.seq
+	}
+}
+
+// done reports whether every packet from the first to the last is in.
+func (a *guppyAssembler) done() bool {
+	if a.mime == "" || a.last == 0 {
+		return false
+	}
+	for seq := a.first; seq < a.last; seq++ {
+		if _, ok := a.chunks[seq]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *guppyAssembler) content() []byte {
+	var b bytes.Buffer
+	for seq := a.first; seq < a.last; seq++ {
+		b.Write(a.chunks[seq])
+	}
+	return b.Bytes()
+}
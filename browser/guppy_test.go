@@ -0,0 +1,224 @@
+package browser
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+type guppyRoute struct {
+	// Status is a whole single-packet answer, like "3 /new".
+	Status string
+	Mime   string
+	Body   string
+}
+
+// guppyChunk is how much of a body the stand-in server puts in a packet,
+// small enough that every page takes a few.
+const guppyChunk = 8
+
+// newGuppyServer serves routes, keyed by path and query, over UDP like a
+// server on a bad network would. The first request it gets is lost, the
+// packets of each answer are sent in reverse order and the second one is
+// lost the first time. Packets are sent again until they are acknowledged.
+// It returns the server's address and how many requests got through.
+func newGuppyServer(t *testing.T, routes map[string]guppyRoute) (addr string, requests func() int) {
+	t.Helper()
+
+	geminitest.SetTempDirs(t)
+	retransmit := GuppyRetransmit
+	GuppyRetransmit = 50 * time.Millisecond
+	t.Cleanup(func() { GuppyRetransmit = retransmit })
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		pc.Close()
+	})
+
+	var mu sync.Mutex
+	var client net.Addr
+	pending := make(map[int][]byte)
+	seen := 0
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			mu.Lock()
+			for _, p := range pending {
+				pc.WriteTo(p, client)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			line := strings.TrimSuffix(string(buf[:n]), "\r\n")
+
+			mu.Lock()
+			if seq, err := strconv.Atoi(line); err == nil {
+				delete(pending, seq)
+				mu.Unlock()
+				continue
+			}
+			seen++
+			if seen == 1 {
+				mu.Unlock()
+				continue
+			}
+
+			client = from
+			u, err := url.Parse(line)
+			key := u.Path
+			if err == nil && u.RawQuery != "" {
+				key += "?" + u.RawQuery
+			}
+			route, ok := routes[key]
+			if !ok {
+				route.Status = "4 not found"
+			}
+			if route.Status != "" {
+				pc.WriteTo([]byte(route.Status+"\r\n"), from)
+				mu.Unlock()
+				continue
+			}
+
+			seq := 100
+			packets := [][]byte{[]byte(strconv.Itoa(seq) + " " + route.Mime + "\r\n")}
+			for body := route.Body; ; {
+				chunk := body[:min(guppyChunk, len(body))]
+				body = body[len(chunk):]
+				packets[len(packets)-1] = append(packets[len(packets)-1], chunk...)
+				seq++
+				packets = append(packets, []byte(strconv.Itoa(seq)+"\r\n"))
+				if chunk == "" {
+					break
+				}
+			}
+			clear(pending)
+			for i := len(packets) - 1; i >= 0; i-- {
+				pending[100+i] = packets[i]
+				if i != 1 {
+					pc.WriteTo(packets[i], from)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return pc.LocalAddr().String(), func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+}
+
+func TestFetchGuppy(t *testing.T) {
+	home := "# Guppy\n=> /old Old page\n=> /hello Say hello\n"
+	addr, requests := newGuppyServer(t, map[string]guppyRoute{
+		"/":                   {Mime: "text/gemini", Body: home},
+		"/old":                {Status: "3 /new"},
+		"/new":                {Mime: "text/plain", Body: "new"},
+		"/empty":              {Mime: "text/gemini"},
+		"/hello":              {Status: "1 Your name"},
+		"/hello?Ada+Lovelace": {Mime: "text/gemini", Body: "# Hello Ada Lovelace\n"},
+		"/broken":             {Status: "4 it broke"},
+	})
+
+	b := &Browser{}
+	err := b.GotoURL(mustParse(t, "guppy://"+addr), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := b.S.CurrPage()
+	if p.Content != home || len(p.Links) != 2 {
+		t.Errorf("got page %q with links %+v", p.Content, p.Links)
+	}
+	if n := requests(); n != 2 {
+		t.Errorf("the server got %d requests, want the lost one and its retransmission", n)
+	}
+
+	resp, err := FetchGuppy(ctx, mustParse(t, "guppy://"+addr+"/"), FetchOpts{})
+	if err != nil || resp.Status != "guppy [cache hit]" || requests() != 2 {
+		t.Errorf("got %q, %v the second time", resp.Status, err)
+	}
+
+	resp, err = FetchGuppy(ctx, mustParse(t, "guppy://"+addr+"/empty"), FetchOpts{})
+	if err != nil || resp.Status != "guppy text/gemini" || resp.Body != "" {
+		t.Errorf("got %q %q, %v for an empty page", resp.Status, resp.Body, err)
+	}
+
+	var redirects []string
+	resp, err = FetchGuppy(ctx, mustParse(t, "guppy://"+addr+"/old"), FetchOpts{
+		OnRedirect: func(from, to *url.URL) { redirects = append(redirects, to.String()) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.URL.String() != "guppy://"+addr+"/new" || resp.Body != "new" || len(redirects) != 1 {
+		t.Errorf("redirected to %s with %q, via %q", resp.URL, resp.Body, redirects)
+	}
+
+	_, err = FetchGuppy(ctx, mustParse(t, "guppy://"+addr+"/hello"), FetchOpts{})
+	var serr *StatusError
+	if !errors.As(err, &serr) || serr.Code != 1 {
+		t.Errorf("got %v without a way to ask for input", err)
+	}
+	var prompts []string
+	resp, err = FetchGuppy(ctx, mustParse(t, "guppy://"+addr+"/hello"), FetchOpts{
+		Input: func(prompt string) (string, bool) {
+			prompts = append(prompts, prompt)
+			return "Ada Lovelace", true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "# Hello Ada Lovelace\n" || len(prompts) != 1 || prompts[0] != "Your name: " {
+		t.Errorf("got %q after prompts %q", resp.Body, prompts)
+	}
+
+	_, err = FetchGuppy(ctx, mustParse(t, "guppy://"+addr+"/broken"), FetchOpts{})
+	if !errors.As(err, &serr) || serr.Code != 4 || serr.Meta != "it broke" {
+		t.Errorf("got %v, want a status 4 error", err)
+	}
+}
+
+func TestFetchGuppyTimeout(t *testing.T) {
+	geminitest.SetTempDirs(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	start := time.Now()
+	_, err = FetchGuppy(ctx, mustParse(t, "guppy://"+pc.LocalAddr().String()+"/"), FetchOpts{Timeout: 200 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got %v from a server that never answers", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("gave up after %s", d)
+	}
+}
@@ -0,0 +1,171 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Handler fetches the URLs of the schemes it is registered for.
+type Handler interface {
+	Fetch(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error)
+}
+
+// HandlerFunc lets a plain function like FetchGemini be a Handler.
+type HandlerFunc func(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error)
+
+func (f HandlerFunc) Fetch(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	return f(ctx, u, opts)
+}
+
+// Registry maps URL schemes to the handlers that fetch them.
+type Registry struct {
+	handlers map[string]Handler
+}
+
+// NewRegistry returns a registry with every protocol gemcat speaks.
+func NewRegistry() *Registry {
+	r := &Registry{handlers: make(map[string]Handler)}
+	r.Register("gemini", HandlerFunc(FetchGemini))
+	r.Register("gopher", HandlerFunc(FetchGopher))
+	r.Register("spartan", HandlerFunc(FetchSpartan))
+	r.Register("finger", HandlerFunc(FetchFinger))
+	r.Register("nex", HandlerFunc(FetchNex))
+	r.Register("guppy", HandlerFunc(FetchGuppy))
+	r.Register("about", HandlerFunc(FetchAbout))
+	r.Register("file", HandlerFunc(FetchFile))
+	return r
+}
+
+// DefaultRegistry is used by browsers without their own registry.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) Register(scheme string, h Handler) {
+	r.handlers[strings.ToLower(scheme)] = h
+}
+
+func (r *Registry) Handler(scheme string) (Handler, bool) {
+	h, ok := r.handlers[strings.ToLower(scheme)]
+	return h, ok
+}
+
+func (r *Registry) Schemes() []string {
+	return slices.Sorted(maps.Keys(r.handlers))
+}
+
+type UnsupportedSchemeError struct {
+	Scheme string
+}
+
+func (e *UnsupportedSchemeError) Error() string {
+	return fmt.Sprintf("%s urls can't be fetched", e.Scheme)
+}
+
+// Fetch fetches u with the handler for its scheme.
+func (r *Registry) Fetch(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	h, ok := r.Handler(u.Scheme)
+	if !ok {
+		return Response{}, &UnsupportedSchemeError{Scheme: u.Scheme}
+	}
+	return h.Fetch(ctx, u, opts)
+}
+
+// Fetch fetches u with DefaultRegistry.
+func Fetch(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	return DefaultRegistry.Fetch(ctx, u, opts)
+}
+
+// ParseURL parses a URL given by the user, taking it to be gemini unless it
+// names its scheme. "host:port" is not taken as a scheme, and paths starting
+// with /, ./, ../ or ~/ are local files.
+func ParseURL(s string) (*url.URL, error) {
+	if isLocalPath(s) {
+		return fileURL(s)
+	}
+	if !hasScheme(s) {
+		s = "gemini://" + s
+	}
+	return url.Parse(s)
+}
+
+func hasScheme(s string) bool {
+	if strings.Contains(s, "://") {
+		return true
+	}
+	scheme, rest, ok := strings.Cut(s, ":")
+	if !ok || scheme == "" || rest == "" || unicode.IsDigit(rune(rest[0])) {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
+
+// ScopePrefix is the directory of u. Crawls that start at u stay under it.
+func ScopePrefix(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	if strings.HasSuffix(u.Path, "/") {
+		return u.Path
+	}
+	dir := path.Dir(u.Path)
+	if dir == "/" {
+		return dir
+	}
+	return dir + "/"
+}
+
+// WithoutFragment returns a copy of u without its fragment, so that links to
+// different parts of a page count as the same page.
+func WithoutFragment(u *url.URL) *url.URL {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	return &c
+}
+
+// DefaultOpener is the command URLs are opened with when no handler is
+// configured for their scheme.
+func DefaultOpener() string {
+	if runtime.GOOS == "darwin" {
+		return "open"
+	}
+	return "xdg-open"
+}
+
+// OpenExternal hands u to the program configured for its scheme, or to the
+// DefaultOpener, and waits for it to exit. It returns the command that was
+// run.
+func (b *Browser) OpenExternal(u *url.URL) (string, error) {
+	command := b.Conf.OpenCommand(u.Scheme)
+	if command == "" {
+		command = DefaultOpener()
+	}
+
+	// The URL is passed as an argument rather than pasted into the command,
+	// so it can't be used to run anything.
+	script := command
+	if strings.Contains(script, "%s") {
+		script = strings.ReplaceAll(script, "%s", `"$1"`)
+	} else {
+		script += ` "$1"`
+	}
+
+	cmd := exec.Command("sh", "-c", script, "gemcat", u.String())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return command, fmt.Errorf("%s: %w", command, err)
+	}
+	return command, nil
+}
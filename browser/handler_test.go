@@ -0,0 +1,146 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/krbreyn/gemcat/config"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"example.org", "gemini://example.org"},
+		{"example.org/a b", "gemini://example.org/a%20b"},
+		{"example.org:1965/path", "gemini://example.org:1965/path"},
+		{"localhost:1965", "gemini://localhost:1965"},
+		{"gemini://example.org/", "gemini://example.org/"},
+		{"gopher://example.org/1/", "gopher://example.org/1/"},
+		{"https://example.org/", "https://example.org/"},
+		{"mailto:me@example.org", "mailto:me@example.org"},
+	}
+
+	for _, tt := range tests {
+		u, err := ParseURL(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if u.String() != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.in, u, tt.want)
+		}
+	}
+}
+
+func TestScopePrefix(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"gemini://example.org", "/"},
+		{"gemini://example.org/", "/"},
+		{"gemini://example.org/page.gmi", "/"},
+		{"gemini://example.org/log/", "/log/"},
+		{"gemini://example.org/log/post.gmi#top", "/log/"},
+	}
+
+	for _, tt := range tests {
+		u := mustParse(t, tt.in)
+		if got := ScopePrefix(u); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+		if c := WithoutFragment(u); c.Fragment != "" || u.String() != tt.in {
+			t.Errorf("%q: WithoutFragment got %s and changed u to %s", tt.in, c, u)
+		}
+	}
+}
+
+func TestResponseMime(t *testing.T) {
+	if !(Response{Status: "20 text/gemini; lang=en\r\n"}).IsGemtext() || (Response{Status: "20 [cache hit]"}).IsGemtext() {
+		t.Error("IsGemtext got the statuses wrong")
+	}
+
+	mimes := []struct {
+		resp Response
+		want string
+	}{
+		{Response{Status: "20 text/plain; charset=utf-8\r\n"}, "text/plain"},
+		{Response{Status: "20 [cache hit]", URL: mustParse(t, "gemini://a.org/pic.png")}, "image/png"},
+		{Response{Status: "gopher menu"}, "text/gemini"},
+		{Response{Status: "gopher download", Download: "/tmp/x"}, ""},
+	}
+	for _, tt := range mimes {
+		if got := tt.resp.Mime(); got != tt.want {
+			t.Errorf("%q: got mime %q, want %q", tt.resp.Status, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	geminitest.SetTempDirs(t)
+
+	r := NewRegistry()
+	r.Register("test", HandlerFunc(func(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+		return Response{Body: "# " + u.Opaque + "\n=> test:other\n"}, nil
+	}))
+
+	b := &Browser{Handlers: r}
+	if !b.CanFetch(mustParse(t, "TEST:x")) || b.CanFetch(mustParse(t, "https://example.org")) {
+		t.Error("CanFetch got the schemes wrong")
+	}
+
+	err := b.GotoURL(mustParse(t, "test:page"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := b.S.CurrPage()
+	if p.Content != "# page\n=> test:other\n" || len(p.Links) != 1 {
+		t.Errorf("got page %+v", p)
+	}
+
+	err = b.GotoURL(mustParse(t, "https://example.org/"), true)
+	var serr *UnsupportedSchemeError
+	if !errors.As(err, &serr) || serr.Scheme != "https" {
+		t.Errorf("got %v, want an UnsupportedSchemeError", err)
+	}
+}
+
+func TestOpenExternal(t *testing.T) {
+	dir := t.TempDir()
+	b := &Browser{Conf: config.Config{Openers: map[string]string{
+		"mailto": "echo mail %s > " + filepath.Join(dir, "mailto"),
+		"*":      "echo > " + filepath.Join(dir, "other"),
+	}}}
+
+	tests := []struct {
+		url, file, want string
+	}{
+		{"mailto:me@example.org", "mailto", "mail mailto:me@example.org\n"},
+		{"https://example.org/?a=1&b=$(false)", "other", "https://example.org/?a=1&b=$(false)\n"},
+	}
+
+	for _, tt := range tests {
+		_, err := b.OpenExternal(mustParse(t, tt.url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	b.Conf.Openers["*"] = "false"
+	if _, err := b.OpenExternal(mustParse(t, "https://example.org/")); err == nil {
+		t.Error("a failing opener didn't return an error")
+	}
+}
@@ -0,0 +1,105 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/data"
+)
+
+// FetchNex fetches a nex URL. Paths ending in a slash are directories, whose
+// => lines are links like gemtext's and whose other lines are kept as they
+// are laid out. Text files are preformatted and anything else is saved to
+// the download dir.
+func FetchNex(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	if u.Scheme != "nex" {
+		return Response{}, fmt.Errorf("not a nex url: %s", u.String())
+	}
+	// The root has to end in a slash for relative links from it to work.
+	if u.Path == "" {
+		root := *u
+		root.Path = "/"
+		u = &root
+	}
+	isDir := strings.HasSuffix(u.Path, "/")
+	mimeType := MimeType(u.Path)
+	isText := isDir || strings.HasPrefix(mimeType, "text/")
+
+	if isText && !opts.NoCache {
+		isStale, err := data.IsCacheStale(u, time.Hour*24)
+		if err != nil {
+			return Response{}, fmt.Errorf("cache error: %w\n", err)
+		}
+
+		if !isStale {
+			content, err := data.LoadFromCache(u)
+			if err != nil {
+				return Response{}, fmt.Errorf("cache error: %w\n", err)
+			}
+			return Response{Status: "20 [cache hit]", Body: string(content), URL: u}, nil
+		}
+	}
+
+	resp := Response{URL: u}
+	var body []byte
+	selector := strings.TrimPrefix(u.Path, "/")
+	err := plainRequest(ctx, u, "1900", selector, opts, func(r io.Reader) error {
+		if !isText {
+			path, n, err := saveDownload(r, opts.DownloadDir, selector)
+			if err != nil {
+				return err
+			}
+			resp.Status = "nex download"
+			resp.Download = path
+			resp.Body = fmt.Sprintf("# Download\n\nSaved %d bytes from %s to:\n```\n%s\n```\n", n, u, path)
+			return nil
+		}
+		var err error
+		body, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil || !isText {
+		return resp, err
+	}
+
+	if isDir {
+		resp.Status = "nex directory"
+		resp.Body = NexDirToGemtext(string(body))
+	} else {
+		resp.Status = "nex text"
+		resp.Body = preformatted(textLines(string(body)))
+	}
+
+	err = data.CacheGemFile(u, []byte(resp.Body))
+	if err != nil {
+		return resp, fmt.Errorf("cache err: %w", err)
+	}
+	return resp, nil
+}
+
+// NexDirToGemtext converts a nex directory listing to gemtext. Its => lines
+// are already gemtext links, and runs of other lines become preformatted
+// blocks so that they look the way they were laid out.
+func NexDirToGemtext(listing string) string {
+	var sb strings.Builder
+	inPre := false
+
+	for _, line := range textLines(listing) {
+		isLink := strings.HasPrefix(line, "=>")
+		// Blank lines don't start or end a block.
+		if line != "" && isLink == inPre {
+			sb.WriteString("```\n")
+			inPre = !inPre
+		}
+		sb.WriteString(line + "\n")
+	}
+	if inPre {
+		sb.WriteString("```\n")
+	}
+
+	return sb.String()
+}
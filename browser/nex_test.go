@@ -0,0 +1,86 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNexDirToGemtext(t *testing.T) {
+	listing := "  Welcome\r\n" +
+		"# not a heading\r\n" +
+		"\r\n" +
+		"=> docs/ Docs\r\n" +
+		"=> about.txt\r\n" +
+		"\r\n" +
+		"* still laid out\r\n"
+
+	want := "```\n" +
+		"  Welcome\n" +
+		"# not a heading\n" +
+		"\n" +
+		"```\n" +
+		"=> docs/ Docs\n" +
+		"=> about.txt\n" +
+		"\n" +
+		"```\n" +
+		"* still laid out\n" +
+		"```\n"
+
+	if got := NexDirToGemtext(listing); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFetchNex(t *testing.T) {
+	addr := newGopherServer(t, map[string]string{
+		"":                "Hello\n=> docs/ Docs\n=> pic.png A picture\n",
+		"docs/":           "=> ../ Up\n=> readme.txt\n",
+		"docs/readme.txt": "Read me\n",
+		"pic.png":         "\x89PNG",
+	})
+
+	b := &Browser{}
+	err := b.GotoURL(mustParse(t, "nex://"+addr), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := b.S.CurrPage()
+	if p.URL != "nex://"+addr+"/" || len(p.Links) != 2 {
+		t.Fatalf("got page %s with links %+v", p.URL, p.Links)
+	}
+
+	resp, err := FetchNex(ctx, mustParse(t, "nex://"+addr+"/docs/"), FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "nex directory" || resp.Body != "=> ../ Up\n=> readme.txt\n" {
+		t.Errorf("got directory %q %q", resp.Status, resp.Body)
+	}
+
+	resp, err = FetchNex(ctx, mustParse(t, "nex://"+addr+"/docs/readme.txt"), FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "nex text" || resp.Body != "```\nRead me\n```\n" {
+		t.Errorf("got text %q %q", resp.Status, resp.Body)
+	}
+
+	resp, err = FetchNex(ctx, mustParse(t, "nex://"+addr+"/docs/readme.txt"), FetchOpts{})
+	if err != nil || resp.Status != "20 [cache hit]" {
+		t.Errorf("got %q, %v the second time", resp.Status, err)
+	}
+
+	dir := t.TempDir()
+	resp, err = FetchNex(ctx, mustParse(t, "nex://"+addr+"/pic.png"), FetchOpts{DownloadDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(resp.Download)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "\x89PNG" || filepath.Dir(resp.Download) != dir {
+		t.Errorf("downloaded %q to %s", content, resp.Download)
+	}
+}
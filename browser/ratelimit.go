@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSlowDown is how long a host is left alone after a 44 SLOW DOWN that
+// doesn't say how long to wait.
+const DefaultSlowDown = 5 * time.Second
+
+// ParseSlowDown parses the number of seconds a 44 SLOW DOWN asks to wait for.
+// ok is false if the meta isn't a number of seconds.
+func ParseSlowDown(meta string) (wait time.Duration, ok bool) {
+	secs, err := strconv.Atoi(strings.TrimSpace(meta))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// SlowDownError is returned when a host has asked to be left alone for
+// longer than a fetch is willing to wait.
+type SlowDownError struct {
+	Host string
+	Left time.Duration
+}
+
+func (e *SlowDownError) Error() string {
+	return fmt.Sprintf("%s asked to slow down, try again in %s", e.Host, e.Left.Round(time.Second))
+}
+
+// RateLimiter keeps track of when each host may next be sent a request.
+type RateLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// Limiter is shared by every fetch in the process, so that a host that asked
+// to slow down is left alone by everything.
+var Limiter = &RateLimiter{}
+
+// Hold keeps requests away from host for d.
+func (l *RateLimiter) Hold(host string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next == nil {
+		l.next = make(map[string]time.Time)
+	}
+	if until := time.Now().Add(d); until.After(l.next[host]) {
+		l.next[host] = until
+	}
+}
+
+// Wait blocks until a request may be made to host, then keeps the next one
+// at least delay after it. If the wait would be longer than maxWait it fails
+// straight away instead, unless maxWait is 0. tick, if set, is called every
+// second while waiting with the time left and the whole wait.
+func (l *RateLimiter) Wait(ctx context.Context, host string, delay, maxWait time.Duration, tick func(left, total time.Duration)) error {
+	l.mu.Lock()
+	if l.next == nil {
+		l.next = make(map[string]time.Time)
+	}
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	total := at.Sub(now)
+	if maxWait > 0 && total > maxWait {
+		l.mu.Unlock()
+		return &SlowDownError{Host: host, Left: total}
+	}
+	// The slot is taken before waiting so that requests waiting together
+	// are spaced out too.
+	l.next[host] = at.Add(delay)
+	l.mu.Unlock()
+
+	if total <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timer := time.NewTimer(total)
+	defer timer.Stop()
+
+	for {
+		if tick != nil {
+			tick(max(time.Until(at), 0), total)
+		}
+		select {
+		case <-timer.C:
+			if tick != nil {
+				tick(0, total)
+			}
+			return nil
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitFunc adapts an OnWait to a Wait tick for host.
+func waitFunc(host string, onWait func(host string, left, total time.Duration)) func(left, total time.Duration) {
+	if onWait == nil {
+		return nil
+	}
+	return func(left, total time.Duration) { onWait(host, left, total) }
+}
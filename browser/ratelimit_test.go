@@ -0,0 +1,120 @@
+package browser
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+// freshLimiter keeps a test's holds from leaking into other tests.
+func freshLimiter(t *testing.T) {
+	old := Limiter
+	Limiter = &RateLimiter{}
+	t.Cleanup(func() { Limiter = old })
+}
+
+func TestParseSlowDown(t *testing.T) {
+	tests := []struct {
+		meta string
+		want time.Duration
+		ok   bool
+	}{
+		{"30", 30 * time.Second, true},
+		{" 0 ", 0, true},
+		{"-1", 0, false},
+		{"slow down!", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseSlowDown(test.meta)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ParseSlowDown(%q) = %v, %v, want %v, %v", test.meta, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := &RateLimiter{}
+
+	start := time.Now()
+	for range 3 {
+		err := l.Wait(ctx, "example.org", 50*time.Millisecond, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took := time.Since(start); took < 100*time.Millisecond {
+		t.Errorf("three requests with a 50ms delay took %v", took)
+	}
+
+	start = time.Now()
+	err := l.Wait(ctx, "other.org", 0, 0, nil)
+	if err != nil || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("another host was held back: %v", err)
+	}
+
+	l.Hold("example.org", time.Hour)
+	var serr *SlowDownError
+	err = l.Wait(ctx, "example.org", 0, time.Minute, nil)
+	if !errors.As(err, &serr) || serr.Host != "example.org" || serr.Left < 59*time.Minute {
+		t.Errorf("waiting on a held host gave %v", err)
+	}
+}
+
+func TestFetchGeminiSlowDown(t *testing.T) {
+	freshLimiter(t)
+	s := geminitest.NewTestServer(t)
+
+	var requests atomic.Int32
+	s.Handle("/busy", geminitest.Route{Func: func(r *geminitest.Request) geminitest.Route {
+		if requests.Add(1) == 1 {
+			return geminitest.Route{Status: 44, Meta: "1"}
+		}
+		return geminitest.Route{Status: 20, Meta: "text/gemini", Body: "# Finally\n"}
+	}})
+	s.Handle("/busier", geminitest.Route{Status: 44, Meta: "3600"})
+
+	var ticks []time.Duration
+	opts := FetchOpts{
+		NoCache:         true,
+		SlowDownRetries: 1,
+		OnWait: func(host string, left, total time.Duration) {
+			if host != "127.0.0.1" || total < 900*time.Millisecond {
+				t.Errorf("waiting for %s for %v", host, total)
+			}
+			ticks = append(ticks, left)
+		},
+	}
+
+	start := time.Now()
+	resp, err := FetchGemini(ctx, mustParse(t, s.URL("/busy")), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "# Finally\n" || requests.Load() != 2 {
+		t.Errorf("got %q after %d requests", resp.Body, requests.Load())
+	}
+	if time.Since(start) < 900*time.Millisecond {
+		t.Errorf("retried after %v", time.Since(start))
+	}
+	if len(ticks) < 2 || ticks[len(ticks)-1] != 0 {
+		t.Errorf("got countdown %v", ticks)
+	}
+
+	opts.OnWait = nil
+	opts.MaxWait = time.Minute
+	_, err = FetchGemini(ctx, mustParse(t, s.URL("/busier")), opts)
+	var serr *SlowDownError
+	if !errors.As(err, &serr) {
+		t.Fatalf("got %v, want a SlowDownError", err)
+	}
+
+	// Everything else on the host is held back too.
+	_, err = FetchGemini(ctx, mustParse(t, s.URL("/busy")), opts)
+	if !errors.As(err, &serr) || requests.Load() != 2 {
+		t.Errorf("got %v after %d requests", err, requests.Load())
+	}
+}
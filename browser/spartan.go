@@ -0,0 +1,131 @@
+package browser
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/data"
+)
+
+// FetchSpartan fetches a spartan URL over plain TCP, following redirects.
+// A query in the URL is sent as the request's body, which is how the input
+// asked for by a =: line is sent. Only pages without one are cached.
+func FetchSpartan(ctx context.Context, u *url.URL, opts FetchOpts) (Response, error) {
+	for redirects := 0; ; redirects++ {
+		resp, to, err := fetchSpartan(ctx, u, opts)
+		if err != nil || to == nil {
+			return resp, err
+		}
+		if redirects >= MaxRedirects {
+			return resp, fmt.Errorf("more than %d redirects, last to %s", MaxRedirects, to)
+		}
+		if opts.OnRedirect != nil {
+			opts.OnRedirect(u, to)
+		}
+		u = to
+	}
+}
+
+// fetchSpartan makes a single request, returning where it redirects to if
+// it does.
+func fetchSpartan(ctx context.Context, u *url.URL, opts FetchOpts) (Response, *url.URL, error) {
+	if u.Scheme != "spartan" {
+		return Response{}, nil, fmt.Errorf("only spartan connections are handled, got %s", u)
+	}
+	body, err := url.QueryUnescape(u.RawQuery)
+	if err != nil {
+		return Response{}, nil, fmt.Errorf("bad query: %w", err)
+	}
+
+	doCache := u.RawQuery == ""
+	if doCache && !opts.NoCache {
+		isStale, err := data.IsCacheStale(u, time.Hour*24)
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("cache error: %w\n", err)
+		}
+
+		if !isStale {
+			content, err := data.LoadFromCache(u)
+			if err != nil {
+				return Response{}, nil, fmt.Errorf("cache error: %w\n", err)
+			}
+			return Response{Status: "2 [cache hit]", Body: string(content), URL: u}, nil, nil
+		}
+	}
+
+	timeout := cmp.Or(opts.Timeout, DefaultTimeout)
+
+	host := u.Hostname()
+	err = Limiter.Wait(ctx, host, opts.Delay, opts.MaxWait, waitFunc(host, opts.OnWait))
+	if err != nil {
+		return Response{}, nil, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "300"
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return Response{}, nil, fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	_, err = fmt.Fprintf(conn, "%s %s %d\r\n%s", host, path, len(body), body)
+	if err != nil {
+		return Response{}, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	status, code, meta, err := readHeader(reader)
+	if err != nil {
+		return Response{}, nil, err
+	}
+
+	switch code {
+	case 2:
+	case 3:
+		// Redirects are to a path on the same host, and the input has
+		// already been sent.
+		to, err := u.Parse(meta)
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("redirect url parse error: %w", err)
+		}
+		to.RawQuery = ""
+		return Response{}, to, nil
+	case 4, 5:
+		return Response{}, nil, &StatusError{Code: code, Meta: meta, URL: u}
+	default:
+		return Response{}, nil, fmt.Errorf("unknown spartan status %s", strconv.Quote(strings.TrimSpace(status)))
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return Response{}, nil, fmt.Errorf("failed to read body: %w", err)
+	}
+
+	if doCache {
+		err = data.CacheGemFile(u, content)
+		if err != nil {
+			return Response{}, nil, fmt.Errorf("cache err: %w", err)
+		}
+	}
+	return Response{Status: strings.TrimSpace(status), Body: string(content), URL: u}, nil, nil
+}
@@ -0,0 +1,153 @@
+package browser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+// newSpartanServer serves the responses in routes, keyed by the requested
+// path. A request with a body is answered with it, after the route's
+// response. Every request line is recorded in reqs.
+func newSpartanServer(t *testing.T, routes map[string]string) (addr string, reqs func() []string) {
+	t.Helper()
+
+	geminitest.SetTempDirs(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var mu sync.Mutex
+	var seen []string
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				req, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				req = strings.TrimSuffix(req, "\r\n")
+				mu.Lock()
+				seen = append(seen, req)
+				mu.Unlock()
+
+				fields := strings.Fields(req)
+				if len(fields) != 3 {
+					io.WriteString(conn, "4 bad request\r\n")
+					return
+				}
+				n, _ := strconv.Atoi(fields[2])
+				body := make([]byte, n)
+				if _, err := io.ReadFull(r, body); err != nil {
+					return
+				}
+				resp, ok := routes[fields[1]]
+				if !ok {
+					resp = "4 not found\r\n"
+				}
+				io.WriteString(conn, resp+string(body))
+			}()
+		}
+	}()
+
+	return l.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func TestFetchSpartan(t *testing.T) {
+	addr, reqs := newSpartanServer(t, map[string]string{
+		"/":       "2 text/gemini\r\n# Home\n=: /echo Say something\n=> /old Old page\n",
+		"/echo":   "2 text/plain\r\nyou said: ",
+		"/old":    "3 /new\r\n",
+		"/new":    "2 text/gemini\r\n# New\n",
+		"/loop":   "3 /loop\r\n",
+		"/broken": "5 it broke\r\n",
+	})
+	host, _, _ := net.SplitHostPort(addr)
+
+	b := &Browser{}
+	err := b.GotoURL(mustParse(t, "spartan://"+addr), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := b.S.CurrPage().Links
+	if len(links) != 2 || !links[0].Prompt || links[1].Prompt || links[0].Label != "Say something" {
+		t.Fatalf("got links %+v", links)
+	}
+
+	resp, err := FetchSpartan(ctx, mustParse(t, "spartan://"+addr+"/echo?hello+there%21"), FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "2 text/plain" || resp.Body != "you said: hello there!" {
+		t.Errorf("got %q: %q", resp.Status, resp.Body)
+	}
+
+	var redirects []string
+	resp, err = FetchSpartan(ctx, mustParse(t, "spartan://"+addr+"/old"), FetchOpts{
+		OnRedirect: func(from, to *url.URL) { redirects = append(redirects, to.String()) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.URL.String() != "spartan://"+addr+"/new" || len(redirects) != 1 {
+		t.Errorf("redirected to %s, via %q", resp.URL, redirects)
+	}
+
+	_, err = FetchSpartan(ctx, mustParse(t, "spartan://"+addr+"/loop"), FetchOpts{})
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("got %v for a redirect loop", err)
+	}
+
+	_, err = FetchSpartan(ctx, mustParse(t, "spartan://"+addr+"/broken"), FetchOpts{})
+	var serr *StatusError
+	if !errors.As(err, &serr) || serr.Code != 5 || serr.Meta != "it broke" {
+		t.Errorf("got %v, want a status 5 error", err)
+	}
+
+	want := []string{
+		host + " / 0",
+		host + " /echo 12",
+		host + " /old 0",
+		host + " /new 0",
+	}
+	got := reqs()
+	if len(got) < len(want) {
+		t.Fatalf("got requests %q", got)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("request %d: got %q, want %q", i, got[i], w)
+		}
+	}
+
+	// Pages without input are cached.
+	before := len(reqs())
+	resp, err = FetchSpartan(ctx, mustParse(t, "spartan://"+addr+"/new"), FetchOpts{})
+	if err != nil || resp.Status != "2 [cache hit]" || len(reqs()) != before {
+		t.Errorf("got %q, %v for a cached page", resp.Status, err)
+	}
+	_, err = FetchSpartan(ctx, mustParse(t, "spartan://"+addr+"/echo?again"), FetchOpts{})
+	if err != nil || len(reqs()) != before+1 {
+		t.Errorf("input was served from the cache: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package browser
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upload is what is sent to a titan:// URL.
+type Upload struct {
+	Body []byte
+	// Mime defaults to text/gemini.
+	Mime string
+	// Token is the server's password for uploads, if it wants one.
+	Token string
+}
+
+// TitanURL is the titan:// URL that uploads to the page at a gemini URL.
+func TitanURL(u *url.URL) *url.URL {
+	t := *u
+	t.Scheme = "titan"
+	t.Fragment = ""
+	t.RawFragment = ""
+	return &t
+}
+
+// titanRequest is u with the upload's parameters on the end of its path.
+func titanRequest(u *url.URL, up Upload) string {
+	req := *u
+	req.Fragment = ""
+	req.RawFragment = ""
+	req.RawQuery = ""
+	// Any parameters already on the URL are replaced.
+	req.Path, _, _ = strings.Cut(req.Path, ";")
+	req.RawPath = ""
+
+	params := ";size=" + strconv.Itoa(len(up.Body)) + ";mime=" + cmp.Or(up.Mime, "text/gemini")
+	if up.Token != "" {
+		params += ";token=" + url.PathEscape(up.Token)
+	}
+	return req.String() + params
+}
+
+// Titan uploads to a titan:// URL over the same TLS connection and
+// certificate checks as a gemini fetch. Servers usually answer a successful
+// upload with a redirect to the new page, which is fetched without the
+// cache. A 44 SLOW DOWN holds the host back but an upload isn't retried.
+func Titan(ctx context.Context, u *url.URL, up Upload, opts FetchOpts) (Response, error) {
+	if u.Scheme != "titan" {
+		return Response{}, fmt.Errorf("only titan uploads are handled, got %s", u)
+	}
+	timeout := cmp.Or(opts.Timeout, DefaultTimeout)
+
+	conn, tlsInfo, err := dialGemini(ctx, u, opts, timeout)
+	if err != nil {
+		return Response{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Bodies can be big, so the deadline only starts once it is sent.
+	_, err = io.Copy(conn, io.MultiReader(strings.NewReader(titanRequest(u, up)+"\r\n"), bytes.NewReader(up.Body)))
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to upload: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	reader := bufio.NewReader(conn)
+	status, code, meta, err := readHeader(reader)
+	if err != nil {
+		return Response{}, err
+	}
+
+	switch {
+	case code >= 30 && code <= 39:
+		if meta == "" {
+			return Response{}, errors.New("redirect without a url")
+		}
+		// The new page is fetched over gemini, so a relative redirect is
+		// resolved against the page rather than the titan URL.
+		to, err := (&url.URL{Scheme: "gemini", Host: u.Host, Path: u.Path, RawPath: u.RawPath}).Parse(meta)
+		if err != nil {
+			return Response{}, fmt.Errorf("redirect url parse error: %w", err)
+		}
+		if to.Scheme == "titan" {
+			to.Scheme = "gemini"
+		}
+		if opts.OnRedirect != nil {
+			opts.OnRedirect(u, to)
+		}
+		opts.NoCache = true
+		return FetchGemini(ctx, to, opts)
+	case code == 44:
+		wait, ok := ParseSlowDown(meta)
+		if !ok {
+			wait = DefaultSlowDown
+		}
+		Limiter.Hold(u.Hostname(), wait)
+		return Response{}, &StatusError{Code: code, Meta: meta, URL: u}
+	case code < 20 || code > 29:
+		return Response{}, &StatusError{Code: code, Meta: meta, URL: u}
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to read body: %w", err)
+	}
+	return Response{Status: status, Body: string(body), TLS: tlsInfo, URL: u}, nil
+}
@@ -0,0 +1,85 @@
+package browser
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func TestTitan(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	var mu sync.Mutex
+	page := "# Old\n"
+	var params map[string]string
+	s.Handle("/wiki/page.gmi", geminitest.Route{Func: func(r *geminitest.Request) geminitest.Route {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Scheme != "titan" {
+			return geminitest.Route{Status: 20, Meta: "text/gemini", Body: page}
+		}
+		if r.Params["token"] != "s3cret;" {
+			return geminitest.Route{Status: 61, Meta: "bad token"}
+		}
+		params = r.Params
+		page = string(r.Body)
+		return geminitest.Route{Status: 30, Meta: s.URL("/wiki/page.gmi")}
+	}})
+	s.Handle("/wiki/rel.gmi", geminitest.Route{Func: func(r *geminitest.Request) geminitest.Route {
+		if r.URL.Scheme == "titan" {
+			return geminitest.Route{Status: 30, Meta: "rel.gmi"}
+		}
+		return geminitest.Route{Status: 20, Meta: "text/gemini", Body: "# Relative\n"}
+	}})
+	s.Handle("/raw", geminitest.Route{Status: 20, Meta: "text/plain", Body: "thanks"})
+
+	u := TitanURL(mustParse(t, s.URL("/wiki/page.gmi#top")))
+	if u.Scheme != "titan" || u.Fragment != "" {
+		t.Fatalf("got titan url %s", u)
+	}
+
+	_, err := Titan(ctx, u, Upload{Body: []byte("# New\n")}, FetchOpts{})
+	if err == nil {
+		t.Fatal("uploading without the token succeeded")
+	}
+
+	var redirects int
+	opts := FetchOpts{OnRedirect: func(from, to *url.URL) { redirects++ }}
+	resp, err := Titan(ctx, u, Upload{Body: []byte("# New\n"), Token: "s3cret;"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "# New\n" || resp.URL.String() != s.URL("/wiki/page.gmi") || redirects != 1 {
+		t.Errorf("got %s %q after %d redirects", resp.URL, resp.Body, redirects)
+	}
+	if params["size"] != "6" || params["mime"] != "text/gemini" {
+		t.Errorf("got params %v", params)
+	}
+
+	// Servers usually redirect to the page with a relative URL.
+	resp, err = Titan(ctx, TitanURL(mustParse(t, s.URL("/wiki/rel.gmi"))), Upload{Body: []byte("x")}, FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "# Relative\n" || resp.URL.String() != s.URL("/wiki/rel.gmi") {
+		t.Errorf("got %s %q after a relative redirect", resp.URL, resp.Body)
+	}
+
+	resp, err = Titan(ctx, TitanURL(mustParse(t, s.URL("/raw;size=99"))), Upload{Body: []byte("x"), Mime: "text/plain"}, FetchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "thanks" {
+		t.Errorf("got body %q", resp.Body)
+	}
+	reqs := s.Requests()
+	if raw := reqs[len(reqs)-1].Raw; raw != "titan://"+s.Addr+"/raw;size=1;mime=text/plain" {
+		t.Errorf("got request %q", raw)
+	}
+
+	_, err = Titan(ctx, mustParse(t, s.URL("/raw")), Upload{}, FetchOpts{})
+	if err == nil {
+		t.Error("uploading to a gemini url succeeded")
+	}
+}
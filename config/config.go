@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+const app_dir = "gemcat"
+const config_file = "config.json"
+
+const (
+	PagerAuto   = "auto"
+	PagerAlways = "always"
+	PagerOff    = "off"
+)
+
+const (
+	EditModeEmacs = "emacs"
+	EditModeVi    = "vi"
+)
+
+type Config struct {
+	// DefaultVerify is the verification policy used for hosts without their
+	// own entry in Verify, e.g. "tofu" or "ca+spki".
+	DefaultVerify string            `json:"default_verify,omitempty"`
+	Verify        map[string]string `json:"verify,omitempty"`
+	// Pager is when the CLI pages long pages, one of PagerAuto (when they
+	// don't fit the terminal, the default), PagerAlways or PagerOff.
+	Pager string `json:"pager,omitempty"`
+	// EditMode is the CLI's line editing bindings, EditModeEmacs (the
+	// default) or EditModeVi.
+	EditMode string `json:"edit_mode,omitempty"`
+	// Aliases maps a name to the line of shell input it runs.
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// DownloadDir is where files that aren't pages are saved.
+	DownloadDir string `json:"download_dir,omitempty"`
+	// Openers maps the schemes gemcat can't fetch itself, like https or
+	// mailto, to the command that opens them. %s in the command is replaced
+	// by the URL, otherwise the URL is added to the end. "*" is used for
+	// schemes without their own entry.
+	Openers map[string]string `json:"openers,omitempty"`
+	// FeedWorkers is how many subscriptions are refreshed at once, and
+	// FeedHostLimit how many of those may be on the same host.
+	FeedWorkers   int `json:"feed_workers,omitempty"`
+	FeedHostLimit int `json:"feed_host_limit,omitempty"`
+	// FeedMaxAge is how many minutes old the cached copy of a subscription
+	// may be for a refresh to use it rather than fetch it again. 0 always
+	// fetches.
+	FeedMaxAge int `json:"feed_max_age,omitempty"`
+	// PoliteDelayMs is how many milliseconds automated fetches, like feed
+	// refreshes, leave between requests to the same host. 0 uses
+	// DefaultPoliteDelay and a negative number none at all.
+	PoliteDelayMs int `json:"polite_delay_ms,omitempty"`
+}
+
+const DefaultPoliteDelay = 500 * time.Millisecond
+
+func (c Config) PoliteDelay() time.Duration {
+	switch {
+	case c.PoliteDelayMs < 0:
+		return 0
+	case c.PoliteDelayMs == 0:
+		return DefaultPoliteDelay
+	}
+	return time.Duration(c.PoliteDelayMs) * time.Millisecond
+}
+
+func GetConfigDir() string {
+	base_config_dir := os.Getenv("XDG_CONFIG_HOME")
+	if base_config_dir == "" {
+		base_config_dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+
+	return filepath.Join(base_config_dir, app_dir)
+}
+
+func configPath() string {
+	return filepath.Join(GetConfigDir(), config_file)
+}
+
+// Load reads the config file, returning an empty config if there isn't one.
+func Load() (Config, error) {
+	var c Config
+
+	data, err := os.ReadFile(configPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return c, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return c, nil
+}
+
+// OpenCommand returns the command configured to open URLs of scheme, or ""
+// if there is none.
+func (c Config) OpenCommand(scheme string) string {
+	if cmd, ok := c.Openers[scheme]; ok {
+		return cmd
+	}
+	return c.Openers["*"]
+}
+
+func (c Config) Save() error {
+	err := os.MkdirAll(GetConfigDir(), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(configPath(), append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyPolicy returns the certificate verification policy for host, falling
+// back to tofu.DefaultPolicy if nothing valid is configured.
+func (c Config) VerifyPolicy(host string) tofu.Policy {
+	if s, ok := c.Verify[host]; ok {
+		if p, err := tofu.ParsePolicy(s); err == nil {
+			return p
+		}
+	}
+	if c.DefaultVerify != "" {
+		if p, err := tofu.ParsePolicy(c.DefaultVerify); err == nil {
+			return p
+		}
+	}
+	return tofu.DefaultPolicy
+}
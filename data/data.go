@@ -2,6 +2,7 @@ package data
 
 import (
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -11,11 +12,31 @@ import (
 
 var xdg_data_home string = os.Getenv("XDG_DATA_HOME")
 
+// app_dir_override replaces the whole app dir when set, see SetAppDir.
+var app_dir_override string
+
 const app_dir = "gemcat"
 const data_file = "browser_state"
 const cache_dir = "gemcache"
+const cmd_history_file = "cmd_history"
+const subs_file = "subscriptions.json"
+const search_index_file = "search_index.json"
+const search_visits_file = "search_visits.jsonl"
+
+// MaxCmdHistory is how many lines of shell input are kept.
+const MaxCmdHistory = 1000
+
+// SetAppDir makes gemcat keep its data and cache in dir instead of under
+// $XDG_DATA_HOME. Mostly useful for tests.
+func SetAppDir(dir string) {
+	app_dir_override = dir
+}
 
 func getAppDir() string {
+	if app_dir_override != "" {
+		return app_dir_override
+	}
+
 	var base_data_dir string
 	if xdg_data_home != "" {
 		base_data_dir = xdg_data_home
@@ -63,6 +84,186 @@ func SaveDataFile(data []byte) error {
 	return nil
 }
 
+func getCmdHistoryFile() string {
+	app_data_dir := getAppDir()
+
+	err := os.MkdirAll(app_data_dir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create data dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	return filepath.Join(app_data_dir, cmd_history_file)
+}
+
+// LoadCmdHistory returns the most recent lines of shell input, oldest first.
+func LoadCmdHistory() ([]string, error) {
+	data, err := os.ReadFile(getCmdHistoryFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read command history: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > MaxCmdHistory {
+		lines = lines[len(lines)-MaxCmdHistory:]
+	}
+	return lines, nil
+}
+
+// AppendCmdHistory records a line of shell input, trimming the file back to
+// MaxCmdHistory lines once it grows to twice that.
+func AppendCmdHistory(line string) error {
+	path := getCmdHistoryFile()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write command history: %w", err)
+	}
+	_, err = fmt.Fprintln(f, line)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write command history: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read command history: %w", err)
+	}
+	if strings.Count(string(data), "\n") < MaxCmdHistory*2 {
+		return nil
+	}
+
+	lines, err := LoadCmdHistory()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+func getSubsFile() string {
+	app_data_dir := getAppDir()
+
+	err := os.MkdirAll(app_data_dir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create data dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	return filepath.Join(app_data_dir, subs_file)
+}
+
+// LoadSubsFile reads the saved subscriptions, returning nil if there are
+// none yet.
+func LoadSubsFile() ([]byte, error) {
+	data, err := os.ReadFile(getSubsFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+	return data, nil
+}
+
+func SaveSubsFile(data []byte) error {
+	err := os.WriteFile(getSubsFile(), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write subscriptions: %w", err)
+	}
+	return nil
+}
+
+func getSearchIndexFile() string {
+	app_data_dir := getAppDir()
+
+	err := os.MkdirAll(app_data_dir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create data dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	return filepath.Join(app_data_dir, search_index_file)
+}
+
+// LoadSearchIndexFile reads the saved search index, returning nil if there
+// is none yet.
+func LoadSearchIndexFile() ([]byte, error) {
+	data, err := os.ReadFile(getSearchIndexFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read search index: %w", err)
+	}
+	return data, nil
+}
+
+func SaveSearchIndexFile(data []byte) error {
+	err := os.WriteFile(getSearchIndexFile(), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return nil
+}
+
+func getSearchVisitsFile() string {
+	return filepath.Join(filepath.Dir(getSearchIndexFile()), search_visits_file)
+}
+
+// AppendSearchVisit adds a line to the log of visits the search index has
+// yet to take in, which is much cheaper than rewriting the index. It returns
+// the size of the log afterwards.
+func AppendSearchVisit(line []byte) (int64, error) {
+	f, err := os.OpenFile(getSearchVisitsFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open search visits: %w", err)
+	}
+	var size int64
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		var fi os.FileInfo
+		fi, err = f.Stat()
+		if err == nil {
+			size = fi.Size()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write search visits: %w", err)
+	}
+	return size, nil
+}
+
+// LoadSearchVisitsFile reads the log of visits, returning nil if there is
+// none.
+func LoadSearchVisitsFile() ([]byte, error) {
+	data, err := os.ReadFile(getSearchVisitsFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read search visits: %w", err)
+	}
+	return data, nil
+}
+
+// ClearSearchVisitsFile empties the log of visits once the index has them.
+func ClearSearchVisitsFile() error {
+	err := os.Remove(getSearchVisitsFile())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear search visits: %w", err)
+	}
+	return nil
+}
+
 func getCacheDir() string {
 	cache_path := filepath.Join(getAppDir(), cache_dir)
 	err := os.MkdirAll(cache_path, 0755)
@@ -145,6 +346,64 @@ func NormalizeGemPath(u *url.URL) string {
 		}
 	}
 
+	// Other protocols get their own tree so that they don't clash with
+	// gemini pages on the same host. Hostnames can't start with '_'.
+	if u.Scheme != "" && u.Scheme != "gemini" {
+		host = filepath.Join("_"+u.Scheme, host)
+	}
+
 	// Avoid any weird escaping issues
 	return filepath.Join(host, path)
 }
+
+// CachedFile is a file in the cache. URL is worked out from its path, so a
+// page cached without an extension comes back with .gmi on the end.
+type CachedFile struct {
+	// Path is relative to the cache, like NormalizeGemPath's.
+	Path    string
+	URL     *url.URL
+	ModTime time.Time
+}
+
+// CachedFiles lists every file in the cache.
+func CachedFiles() ([]CachedFile, error) {
+	root := getCacheDir()
+	var files []CachedFile
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, CachedFile{Path: rel, URL: cachedURL(rel), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache: %w", err)
+	}
+	return files, nil
+}
+
+// cachedURL undoes NormalizeGemPath as far as it can.
+func cachedURL(rel string) *url.URL {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	u := &url.URL{Scheme: "gemini"}
+	if strings.HasPrefix(parts[0], "_") && len(parts) > 1 {
+		u.Scheme = strings.TrimPrefix(parts[0], "_")
+		parts = parts[1:]
+	}
+	u.Host = parts[0]
+
+	u.Path = "/" + strings.Join(parts[1:], "/")
+	if parts[len(parts)-1] == "index.gmi" {
+		u.Path = strings.TrimSuffix(u.Path, "index.gmi")
+	}
+	return u
+}
@@ -0,0 +1,261 @@
+// Package feeds keeps track of subscriptions to gemlogs, Atom and RSS feeds
+// and plain pages, and makes the about:feeds page out of them.
+package feeds
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/data"
+)
+
+type Kind string
+
+const (
+	// KindGemfeed is a gemtext page of links labelled with YYYY-MM-DD dates.
+	KindGemfeed Kind = "gemfeed"
+	KindAtom    Kind = "atom"
+	KindRSS     Kind = "rss"
+	// KindPage is any other page, which is watched for changes.
+	KindPage Kind = "page"
+)
+
+type Entry struct {
+	URL   string    `json:"url"`
+	Title string    `json:"title"`
+	Date  time.Time `json:"date"`
+	Read  bool      `json:"read"`
+}
+
+type Sub struct {
+	URL     string    `json:"url"`
+	Title   string    `json:"title"`
+	Kind    Kind      `json:"kind"`
+	Added   time.Time `json:"added"`
+	Updated time.Time `json:"updated"`
+	// Hash is the SHA-256 of a page subscription's last seen content.
+	Hash    string  `json:"hash,omitempty"`
+	Entries []Entry `json:"entries"`
+	// Err is why the last refresh failed, if it did.
+	Err string `json:"error,omitempty"`
+}
+
+// Name is the sub's title, or its URL if it has none.
+func (s Sub) Name() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return s.URL
+}
+
+func (s Sub) Unread() int {
+	n := 0
+	for _, e := range s.Entries {
+		if !e.Read {
+			n++
+		}
+	}
+	return n
+}
+
+type Subs []Sub
+
+func (subs Subs) Index(u string) int {
+	for i, s := range subs {
+		if s.URL == u {
+			return i
+		}
+	}
+	return -1
+}
+
+func (subs Subs) Get(u string) (Sub, bool) {
+	i := subs.Index(u)
+	if i == -1 {
+		return Sub{}, false
+	}
+	return subs[i], true
+}
+
+func LoadSubs() (Subs, error) {
+	content, err := data.LoadSubsFile()
+	if err != nil || content == nil {
+		return nil, err
+	}
+
+	var subs Subs
+	err = json.Unmarshal(content, &subs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+func SaveSubs(subs Subs) error {
+	content, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return data.SaveSubsFile(content)
+}
+
+// FetchFunc fetches a URL, like browser.Fetch or a Browser's Fetch.
+type FetchFunc func(ctx context.Context, u *url.URL, opts browser.FetchOpts) (browser.Response, error)
+
+// now is replaced in tests.
+var now = time.Now
+
+// New fetches u and subscribes to it. Everything already in the feed is
+// taken as read, so only what is posted from now on shows up as new.
+func New(ctx context.Context, fetch FetchFunc, opts browser.FetchOpts, u *url.URL) (Sub, error) {
+	s := Sub{URL: u.String(), Added: now()}
+	err := s.Refresh(ctx, fetch, opts)
+	if err != nil {
+		return s, err
+	}
+	for i := range s.Entries {
+		s.Entries[i].Read = true
+	}
+	return s, nil
+}
+
+// Refresh fetches the sub again, bypassing the cache, and merges in its
+// entries. Entries keep their read state, and new ones are unread. The
+// error is also kept in Err so the feeds page can show it.
+func (s *Sub) Refresh(ctx context.Context, fetch FetchFunc, opts browser.FetchOpts) error {
+	opts.NoCache = true
+	return s.refreshWith(ctx, fetch, opts)
+}
+
+func (s *Sub) refreshWith(ctx context.Context, fetch FetchFunc, opts browser.FetchOpts) error {
+	err := s.update(ctx, fetch, opts)
+	if err != nil {
+		return s.fail(err)
+	}
+	s.Err = ""
+	return nil
+}
+
+func (s *Sub) fail(err error) error {
+	s.Err = err.Error()
+	return fmt.Errorf("%s: %w", s.URL, err)
+}
+
+func (s *Sub) update(ctx context.Context, fetch FetchFunc, opts browser.FetchOpts) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := fetch(ctx, u, opts)
+	if err != nil {
+		return err
+	}
+	if resp.Download != "" {
+		return fmt.Errorf("not a page, it was saved to %s", resp.Download)
+	}
+	base := u
+	if resp.URL != nil {
+		base = resp.URL
+	}
+
+	if s.Kind == "" {
+		s.Kind = Detect(resp.Body)
+	}
+	title, entries, err := Parse(s.Kind, base, resp.Body)
+	if err != nil {
+		return err
+	}
+	if title != "" {
+		s.Title = title
+	}
+
+	t := now()
+	s.Updated = t
+	if s.Kind == KindPage {
+		s.updatePage(resp.Body, t)
+		return nil
+	}
+
+	s.Entries = merge(s.Entries, entries, t)
+	return nil
+}
+
+// updatePage gives a page sub a single entry, which becomes unread whenever
+// the page changes.
+func (s *Sub) updatePage(body string, t time.Time) {
+	sum := sha256.Sum256([]byte(body))
+	hash := hex.EncodeToString(sum[:])
+	if hash == s.Hash && len(s.Entries) == 1 {
+		s.Entries[0].Title = s.Name()
+		return
+	}
+
+	s.Hash = hash
+	s.Entries = []Entry{{URL: s.URL, Title: s.Name(), Date: t}}
+}
+
+// merge returns the fetched entries with the read state of the ones that
+// were already known. Entries without a date are dated when first seen.
+func merge(old, fetched []Entry, t time.Time) []Entry {
+	known := make(map[string]Entry, len(old))
+	for _, e := range old {
+		known[e.URL] = e
+	}
+
+	merged := make([]Entry, 0, len(fetched))
+	seen := make(map[string]bool, len(fetched))
+	for _, e := range fetched {
+		if seen[e.URL] {
+			continue
+		}
+		seen[e.URL] = true
+
+		if k, ok := known[e.URL]; ok {
+			e.Read = k.Read
+			if e.Date.IsZero() {
+				e.Date = k.Date
+			}
+		}
+		if e.Date.IsZero() {
+			e.Date = t
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+// MarkRead marks every entry linking to u as read, reporting whether any
+// were unread.
+func (subs Subs) MarkRead(u string) bool {
+	changed := false
+	for i := range subs {
+		for j := range subs[i].Entries {
+			e := &subs[i].Entries[j]
+			if e.URL == u && !e.Read {
+				e.Read = true
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// MarkRead marks the entries linking to u as read in the saved
+// subscriptions, for when u is visited.
+func MarkRead(u string) error {
+	subs, err := LoadSubs()
+	if err != nil {
+		return err
+	}
+	if !subs.MarkRead(u) {
+		return nil
+	}
+	return SaveSubs(subs)
+}
@@ -0,0 +1,363 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/data"
+	"github.com/krbreyn/gemcat/robots"
+)
+
+func mustParse(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func checkEntries(t *testing.T, got, want []Entry) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got entries %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if got[i].URL != want[i].URL || got[i].Title != want[i].Title ||
+			!got[i].Date.Equal(want[i].Date) || got[i].Read != want[i].Read {
+			t.Errorf("entry %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	base := mustParse(t, "gemini://example.org/log/")
+
+	tests := []struct {
+		name    string
+		body    string
+		kind    Kind
+		title   string
+		entries []Entry
+	}{
+		{
+			name: "gemfeed",
+			body: "## Not the title\n# My Log\n# Also not\n" +
+				"=> first.gmi 2025-12-31 - First post\n" +
+				"=> /about.gmi About me\n" +
+				"=> gemini://other.org/x.gmi 2026-01-02: Elsewhere\n" +
+				"=> 2026-13-01.gmi 2026-13-01 Bad date\n",
+			kind:  KindGemfeed,
+			title: "My Log",
+			entries: []Entry{
+				{URL: "gemini://example.org/log/first.gmi", Title: "First post", Date: date("2025-12-31T00:00:00Z")},
+				{URL: "gemini://other.org/x.gmi", Title: "Elsewhere", Date: date("2026-01-02T00:00:00Z")},
+			},
+		},
+		{
+			name: "atom",
+			body: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom Log</title>
+  <entry>
+    <title>One</title>
+    <link rel="alternate" href="one.gmi"/>
+    <id>urn:one</id>
+    <updated>2026-01-05T10:00:00Z</updated>
+  </entry>
+  <entry>
+    <title>Two</title>
+    <id>gemini://example.org/two.gmi</id>
+    <published>2026-01-06T10:00:00+01:00</published>
+    <updated>2026-01-07T10:00:00Z</updated>
+  </entry>
+</feed>`,
+			kind:  KindAtom,
+			title: "Atom Log",
+			entries: []Entry{
+				{URL: "gemini://example.org/log/one.gmi", Title: "One", Date: date("2026-01-05T10:00:00Z")},
+				{URL: "gemini://example.org/two.gmi", Title: "Two", Date: date("2026-01-06T09:00:00Z")},
+			},
+		},
+		{
+			name: "rss",
+			body: `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0">
+  <channel>
+    <title>RSS Log</title>
+    <item>
+      <title>Hello</title>
+      <link>gemini://example.org/hello.gmi</link>
+      <pubDate>Mon, 05 Jan 2026 10:00:00 +0000</pubDate>
+    </item>
+    <item>
+      <title>Undated</title>
+      <guid>undated.gmi</guid>
+    </item>
+  </channel>
+</rss>`,
+			kind:  KindRSS,
+			title: "RSS Log",
+			entries: []Entry{
+				{URL: "gemini://example.org/hello.gmi", Title: "Hello", Date: date("2026-01-05T10:00:00Z")},
+				{URL: "gemini://example.org/log/undated.gmi", Title: "Undated"},
+			},
+		},
+		{
+			name:  "page",
+			body:  "## Just a page\n=> /a.gmi A\n",
+			kind:  KindPage,
+			title: "Just a page",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if kind := Detect(test.body); kind != test.kind {
+				t.Errorf("detected %s, want %s", kind, test.kind)
+			}
+			title, entries, err := Parse(test.kind, base, test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title != test.title {
+				t.Errorf("got title %q, want %q", title, test.title)
+			}
+			checkEntries(t, entries, test.entries)
+		})
+	}
+}
+
+// fakeFetch serves whatever is in pages.
+func fakeFetch(pages map[string]string) FetchFunc {
+	return func(ctx context.Context, u *url.URL, opts browser.FetchOpts) (browser.Response, error) {
+		if !opts.NoCache {
+			return browser.Response{}, errors.New("feeds should bypass the cache")
+		}
+		body, ok := pages[u.String()]
+		if !ok {
+			return browser.Response{}, errors.New("status was not 2x but was 51")
+		}
+		return browser.Response{Status: "20 text/gemini", Body: body, URL: u}, nil
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	t0 := date("2026-03-01T12:00:00Z")
+	now = func() time.Time { return t0 }
+	t.Cleanup(func() { now = time.Now })
+
+	pages := map[string]string{
+		"gemini://example.org/log.gmi":  "# Log\n=> a.gmi 2026-01-01 A\n",
+		"gemini://example.org/page.gmi": "# Page\nhello\n",
+	}
+	fetch := fakeFetch(pages)
+	ctx := context.Background()
+
+	log, err := New(ctx, fetch, browser.FetchOpts{}, mustParse(t, "gemini://example.org/log.gmi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := New(ctx, fetch, browser.FetchOpts{}, mustParse(t, "gemini://example.org/page.gmi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Kind != KindGemfeed || page.Kind != KindPage {
+		t.Errorf("got kinds %s and %s", log.Kind, page.Kind)
+	}
+	if log.Unread() != 0 || page.Unread() != 0 {
+		t.Error("entries that existed before subscribing are unread")
+	}
+
+	pages["gemini://example.org/log.gmi"] += "=> b.gmi 2026-02-01 B\n"
+	if err := log.Refresh(ctx, fetch, browser.FetchOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, log.Entries, []Entry{
+		{URL: "gemini://example.org/a.gmi", Title: "A", Date: date("2026-01-01T00:00:00Z"), Read: true},
+		{URL: "gemini://example.org/b.gmi", Title: "B", Date: date("2026-02-01T00:00:00Z")},
+	})
+
+	if err := page.Refresh(ctx, fetch, browser.FetchOpts{}); err != nil || page.Unread() != 0 {
+		t.Errorf("an unchanged page is unread: %v", err)
+	}
+	t0 = t0.Add(time.Hour)
+	pages["gemini://example.org/page.gmi"] = "# Page\nhello again\n"
+	if err := page.Refresh(ctx, fetch, browser.FetchOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, page.Entries, []Entry{
+		{URL: "gemini://example.org/page.gmi", Title: "Page", Date: t0},
+	})
+
+	delete(pages, "gemini://example.org/log.gmi")
+	if err := log.Refresh(ctx, fetch, browser.FetchOpts{}); err == nil {
+		t.Error("refreshing a missing feed succeeded")
+	}
+	if log.Err == "" || len(log.Entries) != 2 {
+		t.Errorf("a failed refresh left err %q and entries %+v", log.Err, log.Entries)
+	}
+
+	subs := Subs{log, page}
+	if !subs.MarkRead("gemini://example.org/b.gmi") || subs.MarkRead("gemini://example.org/b.gmi") {
+		t.Error("MarkRead didn't report marking an entry just once")
+	}
+
+	got := Page(subs)
+	want := "# Feeds\n\n" +
+		"1 unread of 3 entries from 2 subscriptions.\n\n" +
+		"=> gemini://example.org/page.gmi 2026-03-01 Page (new)\n" +
+		"=> gemini://example.org/b.gmi 2026-02-01 Log - B\n" +
+		"=> gemini://example.org/a.gmi 2026-01-01 Log - A\n" +
+		"\n## Problems\n\n" +
+		"=> gemini://example.org/log.gmi Log: status was not 2x but was 51\n"
+	if got != want {
+		t.Errorf("got page:\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.HasPrefix(Page(nil), "# Feeds\n\nYou have no subscriptions yet.") {
+		t.Errorf("got empty page %q", Page(nil))
+	}
+}
+
+func TestRefresher(t *testing.T) {
+	data.SetAppDir(t.TempDir())
+	t.Cleanup(func() { data.SetAppDir("") })
+
+	var mu sync.Mutex
+	inflight := make(map[string]int)
+	most := make(map[string]int)
+	fetches := make(map[string]int)
+
+	fetch := func(ctx context.Context, u *url.URL, opts browser.FetchOpts) (browser.Response, error) {
+		mu.Lock()
+		fetches[u.String()]++
+		n := fetches[u.String()]
+		inflight[u.Host]++
+		most[u.Host] = max(most[u.Host], inflight[u.Host])
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inflight[u.Host]--
+		mu.Unlock()
+
+		switch {
+		case u.Path == "/robots.txt" && u.Host == "private.org":
+			return browser.Response{Status: "20 text/plain", Body: "User-agent: *\nDisallow: /private/\n", URL: u}, nil
+		case u.Path == "/robots.txt":
+			return browser.Response{}, errors.New("status was not 2x but was 51")
+		case u.Host == "slow.org":
+			return browser.Response{}, &browser.StatusError{Code: 44, Meta: "0"}
+		case u.String() == "gemini://a.org/1.gmi" && n == 1:
+			return browser.Response{}, &browser.StatusError{Code: 44, Meta: "0"}
+		}
+		return browser.Response{Status: "20 text/gemini", Body: "# " + u.Path + "\n", URL: u}, nil
+	}
+
+	var subs Subs
+	for _, u := range []string{
+		"gemini://a.org/1.gmi", "gemini://a.org/2.gmi", "gemini://a.org/3.gmi",
+		"gemini://a.org/4.gmi", "gemini://b.org/1.gmi", "gemini://b.org/2.gmi",
+	} {
+		subs = append(subs, Sub{URL: u})
+	}
+
+	var progress []int
+	r := &Refresher{
+		Fetch:   fetch,
+		Workers: 6,
+		PerHost: 2,
+		Robots:  &robots.Cache{Fetch: fetch},
+		Progress: func(done, total int, s *Sub) {
+			if total != len(subs) {
+				t.Errorf("progress total %d", total)
+			}
+			progress = append(progress, done)
+		},
+	}
+	if err := r.Refresh(context.Background(), subs); err != nil {
+		t.Fatal(err)
+	}
+	if most["a.org"] != 2 || most["b.org"] > 2 {
+		t.Errorf("got at most %v requests at once per host", most)
+	}
+	if fetches["gemini://a.org/1.gmi"] != 2 || fetches["gemini://b.org/1.gmi"] != 1 {
+		t.Errorf("got fetches %v", fetches)
+	}
+	if len(progress) != len(subs) || progress[len(progress)-1] != len(subs) {
+		t.Errorf("got progress %v", progress)
+	}
+	for _, s := range subs {
+		if s.Err != "" || s.Title != mustParse(t, s.URL).Path {
+			t.Errorf("sub %s has title %q and error %q", s.URL, s.Title, s.Err)
+		}
+	}
+
+	// A server that keeps asking to slow down is given up on.
+	slow := Subs{{URL: "gemini://slow.org/"}}
+	r = &Refresher{Fetch: fetch, Retries: 1, Robots: &robots.Cache{Fetch: fetch}}
+	if err := r.Refresh(context.Background(), slow); err == nil || slow[0].Err == "" {
+		t.Errorf("refreshing a slow server: %v", err)
+	}
+	if fetches["gemini://slow.org/"] != 2 {
+		t.Errorf("a slow server was fetched %d times", fetches["gemini://slow.org/"])
+	}
+
+	// robots.txt is obeyed.
+	private := Subs{{URL: "gemini://private.org/private/log.gmi"}, {URL: "gemini://private.org/log.gmi"}}
+	r = &Refresher{Fetch: fetch, Robots: &robots.Cache{Fetch: fetch}}
+	if err := r.Refresh(context.Background(), private); err == nil || private[0].Err == "" || private[1].Err != "" {
+		t.Errorf("refreshing with robots.txt: %v", err)
+	}
+	if fetches["gemini://private.org/private/log.gmi"] != 0 {
+		t.Error("a disallowed sub was fetched")
+	}
+
+	// Subs cached recently enough aren't fetched.
+	cached := mustParse(t, "gemini://c.org/log.gmi")
+	if err := data.CacheGemFile(cached, []byte("# Cached\n=> a.gmi 2026-01-01 A\n")); err != nil {
+		t.Fatal(err)
+	}
+	fresh := Subs{{URL: cached.String()}}
+	r = &Refresher{Fetch: fetch, MaxAge: time.Hour, Robots: &robots.Cache{Fetch: fetch}}
+	if err := r.Refresh(context.Background(), fresh); err != nil {
+		t.Fatal(err)
+	}
+	if fetches[cached.String()] != 0 || fresh[0].Title != "Cached" || len(fresh[0].Entries) != 1 {
+		t.Errorf("got fetches %v and sub %+v", fetches, fresh[0])
+	}
+}
+
+func TestSlowDownWait(t *testing.T) {
+	tests := []struct {
+		meta     string
+		attempt  int
+		min, max time.Duration
+	}{
+		{"5", 0, 5 * time.Second, 7500 * time.Millisecond},
+		{"0", 3, 0, 0},
+		{"", 2, 4 * time.Second, 6 * time.Second},
+		{"please wait", 0, time.Second, 1500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		for range 20 {
+			got := slowDownWait(test.meta, test.attempt)
+			if got < test.min || got > test.max {
+				t.Errorf("slowDownWait(%q, %d) = %v, want %v to %v", test.meta, test.attempt, got, test.min, test.max)
+				break
+			}
+		}
+	}
+}
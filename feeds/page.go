@@ -0,0 +1,83 @@
+package feeds
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+)
+
+func init() {
+	browser.RegisterAbout("feeds", func(ctx context.Context, u *url.URL) (string, error) {
+		subs, err := LoadSubs()
+		if err != nil {
+			return "", err
+		}
+		return Page(subs), nil
+	})
+}
+
+// PageURL is where the feeds page is opened from.
+const PageURL = "about:feeds"
+
+type item struct {
+	Entry
+	feed string
+}
+
+// Page makes the feeds page: every entry of every sub, newest first, with
+// the unread ones marked. The links are dated like a gemfeed's.
+func Page(subs Subs) string {
+	var items []item
+	unread := 0
+	for _, s := range subs {
+		for _, e := range s.Entries {
+			items = append(items, item{Entry: e, feed: s.Name()})
+			if !e.Read {
+				unread++
+			}
+		}
+	}
+	slices.SortStableFunc(items, func(a, b item) int {
+		return cmp.Or(b.Date.Compare(a.Date), cmp.Compare(a.feed, b.feed))
+	})
+
+	var sb strings.Builder
+	sb.WriteString("# Feeds\n\n")
+	if len(subs) == 0 {
+		sb.WriteString("You have no subscriptions yet. Add one with 'sub add [url]'.\n")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "%d unread of %d entries from %d subscriptions.\n\n", unread, len(items), len(subs))
+
+	for _, it := range items {
+		label := it.feed
+		if it.Title != "" && it.Title != it.feed {
+			label += " - " + it.Title
+		}
+		if !it.Read {
+			label += " (new)"
+		}
+		fmt.Fprintf(&sb, "=> %s %s %s\n", it.URL, it.Date.Format(time.DateOnly), label)
+	}
+
+	var problems []Sub
+	for _, s := range subs {
+		if s.Err != "" {
+			problems = append(problems, s)
+		}
+	}
+	if len(problems) != 0 {
+		sb.WriteString("\n## Problems\n\n")
+		for _, s := range problems {
+			fmt.Fprintf(&sb, "=> %s %s: %s\n", s.URL, s.Name(), s.Err)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,254 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/krbreyn/gemcat/gemtxt"
+)
+
+// Detect works out what kind of feed body is, going by its content since
+// the mime type isn't kept. Gemtext without dated links is a page.
+func Detect(body string) Kind {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "<") {
+		switch xmlRoot(trimmed) {
+		case "feed":
+			return KindAtom
+		case "rss", "RDF":
+			return KindRSS
+		}
+	}
+
+	_, entries := ParseGemfeed(nil, body)
+	if len(entries) != 0 {
+		return KindGemfeed
+	}
+	return KindPage
+}
+
+func xmlRoot(body string) string {
+	dec := newXMLDecoder(body)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// Parse parses body as kind, returning the feed's title and its entries.
+// Relative links are resolved against base.
+func Parse(kind Kind, base *url.URL, body string) (string, []Entry, error) {
+	switch kind {
+	case KindGemfeed:
+		title, entries := ParseGemfeed(base, body)
+		return title, entries, nil
+	case KindAtom:
+		return ParseAtom(base, body)
+	case KindRSS:
+		return ParseRSS(base, body)
+	case KindPage:
+		return PageTitle(body), nil, nil
+	}
+	return "", nil, errors.New("unknown feed kind " + string(kind))
+}
+
+// PageTitle is the first heading of a gemtext page.
+func PageTitle(body string) string {
+	for _, l := range gemtxt.Parse(body) {
+		if l.Type == gemtxt.HeadingLine {
+			return strings.TrimSpace(strings.TrimLeft(l.Raw, "#"))
+		}
+	}
+	return ""
+}
+
+// ParseGemfeed parses a gemtext page as a Gemini feed: its title is the
+// first level 1 heading, and every link whose label starts with a
+// YYYY-MM-DD date is an entry.
+func ParseGemfeed(base *url.URL, body string) (string, []Entry) {
+	var title string
+	var entries []Entry
+
+	for _, l := range gemtxt.Parse(body) {
+		switch l.Type {
+		case gemtxt.HeadingLine:
+			if title == "" && !strings.HasPrefix(l.Raw, "##") {
+				title = strings.TrimSpace(strings.TrimPrefix(l.Raw, "#"))
+			}
+		case gemtxt.LinkLine:
+			if len(l.Label) < len(time.DateOnly) {
+				continue
+			}
+			date, err := time.Parse(time.DateOnly, l.Label[:len(time.DateOnly)])
+			if err != nil {
+				continue
+			}
+
+			entryTitle := strings.TrimSpace(l.Label[len(time.DateOnly):])
+			entryTitle = strings.TrimSpace(strings.TrimLeft(entryTitle, "-–—:|"))
+			entries = append(entries, Entry{
+				URL:   resolve(base, l.URL),
+				Title: entryTitle,
+				Date:  date,
+			})
+		}
+	}
+
+	return title, entries
+}
+
+func resolve(base *url.URL, link string) string {
+	if base == nil {
+		return link
+	}
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return link
+	}
+	return base.ResolveReference(u).String()
+}
+
+type atomFeed struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+func ParseAtom(base *url.URL, body string) (string, []Entry, error) {
+	var feed atomFeed
+	err := decodeXML(body, &feed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var entries []Entry
+	for _, e := range feed.Entries {
+		link := e.ID
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = l.Href
+				break
+			}
+		}
+		if link == "" {
+			continue
+		}
+
+		date := parseDate(e.Published)
+		if date.IsZero() {
+			date = parseDate(e.Updated)
+		}
+		entries = append(entries, Entry{
+			URL:   resolve(base, link),
+			Title: strings.TrimSpace(e.Title),
+			Date:  date,
+		})
+	}
+
+	return strings.TrimSpace(feed.Title), entries, nil
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// RSS 1.0 puts its items next to the channel rather than in it.
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	DCDate  string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+func ParseRSS(base *url.URL, body string) (string, []Entry, error) {
+	var feed rssFeed
+	err := decodeXML(body, &feed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var entries []Entry
+	for _, item := range append(feed.Channel.Items, feed.Items...) {
+		link := strings.TrimSpace(item.Link)
+		if link == "" {
+			link = strings.TrimSpace(item.GUID)
+		}
+		if link == "" {
+			continue
+		}
+
+		date := parseDate(item.PubDate)
+		if date.IsZero() {
+			date = parseDate(item.DCDate)
+		}
+		entries = append(entries, Entry{
+			URL:   resolve(base, link),
+			Title: strings.TrimSpace(item.Title),
+			Date:  date,
+		})
+	}
+
+	return strings.TrimSpace(feed.Channel.Title), entries, nil
+}
+
+func newXMLDecoder(body string) *xml.Decoder {
+	dec := xml.NewDecoder(strings.NewReader(body))
+	// Feeds in the wild declare all sorts of encodings, read them as is.
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	dec.Strict = false
+	return dec
+}
+
+func decodeXML(body string, v any) error {
+	return newXMLDecoder(body).Decode(v)
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.DateTime,
+	time.DateOnly,
+}
+
+// parseDate parses the date formats found in feeds, returning the zero
+// time for anything else.
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
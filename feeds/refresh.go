@@ -0,0 +1,194 @@
+package feeds
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/data"
+	"github.com/krbreyn/gemcat/robots"
+)
+
+// Refresher defaults.
+const (
+	DefaultWorkers = 8
+	DefaultPerHost = 2
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 3
+)
+
+// Refresher refreshes many subs at once with a pool of workers, without
+// making more than PerHost requests to any one host at a time.
+type Refresher struct {
+	Fetch FetchFunc
+	Opts  browser.FetchOpts
+
+	// Workers is how many subs are refreshed at once.
+	Workers int
+	// PerHost is how many of those may be on the same host.
+	PerHost int
+	// Timeout bounds connecting and reading each response.
+	Timeout time.Duration
+	// MaxAge lets subs whose cached copy is younger than it be refreshed
+	// from the cache instead. If 0, everything is fetched.
+	MaxAge time.Duration
+	// Retries is how many times a request answered with 44 SLOW DOWN is
+	// tried again.
+	Retries int
+
+	// Robots is checked before each sub is fetched. Defaults to
+	// robots.Default.
+	Robots *robots.Cache
+
+	// Progress is called after each sub is refreshed, never concurrently.
+	Progress func(done, total int, s *Sub)
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// Agent is the robots.txt user agent refreshes go by. Feed readers have no
+// virtual agent of their own, so only the rules for every agent apply.
+const Agent = ""
+
+// slowDownBase is the first backoff when a 44 doesn't say how long to wait.
+var slowDownBase = time.Second
+
+// Refresh refreshes the subs at the given indexes, or all of them if there
+// are none, returning every error joined together.
+func (r *Refresher) Refresh(ctx context.Context, subs Subs, which ...int) error {
+	if len(which) == 0 {
+		for i := range subs {
+			which = append(which, i)
+		}
+	}
+
+	workers := cmp.Or(r.Workers, DefaultWorkers)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	done := 0
+
+	for range min(workers, len(which)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := r.refresh(ctx, &subs[i])
+
+				mu.Lock()
+				errs = append(errs, err)
+				done++
+				if r.Progress != nil {
+					r.Progress(done, len(which), &subs[i])
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, i := range which {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// hostSlots returns the semaphore limiting requests to host.
+func (r *Refresher) hostSlots(host string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hosts == nil {
+		r.hosts = make(map[string]chan struct{})
+	}
+	slots, ok := r.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, cmp.Or(r.PerHost, DefaultPerHost))
+		r.hosts[host] = slots
+	}
+	return slots
+}
+
+func (r *Refresher) refresh(ctx context.Context, s *Sub) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return s.fail(err)
+	}
+
+	if r.MaxAge > 0 {
+		stale, err := data.IsCacheStale(u, r.MaxAge)
+		if err == nil && !stale {
+			return s.refreshWith(ctx, fromCache, r.Opts)
+		}
+	}
+
+	slots := r.hostSlots(u.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return s.fail(ctx.Err())
+	}
+	defer func() { <-slots }()
+
+	rules := cmp.Or(r.Robots, robots.Default).Get(ctx, u, r.Opts)
+	if !rules.Allowed(u.Path, Agent) {
+		return s.fail(errors.New("robots.txt doesn't allow refreshing it"))
+	}
+
+	return s.Refresh(ctx, r.fetch, r.Opts)
+}
+
+// fetch fetches with a timeout, backing off and retrying while the server
+// answers 44 SLOW DOWN.
+func (r *Refresher) fetch(ctx context.Context, u *url.URL, opts browser.FetchOpts) (browser.Response, error) {
+	timeout := cmp.Or(r.Timeout, DefaultTimeout)
+	retries := cmp.Or(r.Retries, DefaultRetries)
+
+	// The timeout is left to the fetch rather than put on ctx, so that time
+	// spent waiting on a host's rate limit doesn't count.
+	opts.Timeout = timeout
+	for attempt := 0; ; attempt++ {
+		resp, err := r.Fetch(ctx, u, opts)
+
+		var serr *browser.StatusError
+		if !errors.As(err, &serr) || serr.Code != 44 || attempt >= retries {
+			return resp, err
+		}
+
+		select {
+		case <-time.After(slowDownWait(serr.Meta, attempt)):
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		}
+	}
+}
+
+// slowDownWait is how long to wait before retrying after a 44: the number of
+// seconds the server asked for, or else a doubling backoff, plus up to half
+// again so that requests held back together don't all retry together.
+func slowDownWait(meta string, attempt int) time.Duration {
+	wait, ok := browser.ParseSlowDown(meta)
+	if !ok {
+		wait = slowDownBase << attempt
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait + rand.N(wait/2+1)
+}
+
+func fromCache(ctx context.Context, u *url.URL, opts browser.FetchOpts) (browser.Response, error) {
+	content, err := data.LoadFromCache(u)
+	if err != nil {
+		return browser.Response{}, err
+	}
+	return browser.Response{Status: "20 [cache hit]", Body: string(content), URL: u}, nil
+}
@@ -0,0 +1,262 @@
+// Package geminitest runs a local Gemini server for tests, in the spirit of
+// net/http/httptest.
+package geminitest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route is a scripted response. If Func is set it is called for every
+// request and its result is used instead.
+type Route struct {
+	Status int
+	Meta   string
+	Body   string
+	// Delay is waited before the header is sent, for testing timeouts.
+	Delay time.Duration
+	Func  func(r *Request) Route
+}
+
+type Request struct {
+	Raw string
+	URL *url.URL
+	// Params are the ;key=value parameters of a titan:// request, and Body
+	// is what it uploaded.
+	Params map[string]string
+	Body   []byte
+}
+
+type Server struct {
+	// Addr is the host:port the server listens on.
+	Addr string
+
+	ln net.Listener
+
+	mu       sync.Mutex
+	routes   map[string]Route
+	cert     tls.Certificate
+	requests []Request
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on an ephemeral port of 127.0.0.1 with a fresh
+// self-signed certificate. Paths without a route are answered with 51.
+func NewServer() *Server {
+	s := &Server{
+		routes: make(map[string]Route),
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to generate key: %v", err))
+	}
+	s.cert = newCert(key)
+
+	config := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return &s.cert, nil
+		},
+	}
+
+	s.ln, err = tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to listen: %v", err))
+	}
+	s.Addr = s.ln.Addr().String()
+
+	go s.serve()
+	return s
+}
+
+func newCert(key *ecdsa.PrivateKey) tls.Certificate {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to generate serial: %v", err))
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to create certificate: %v", err))
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to parse certificate: %v", err))
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+// URL returns the gemini:// URL of path on the server.
+func (s *Server) URL(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "gemini://" + s.Addr + path
+}
+
+func (s *Server) Handle(path string, r Route) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[path] = r
+}
+
+// Page serves body as text/gemini at path.
+func (s *Server) Page(path, body string) {
+	s.Handle(path, Route{Status: 20, Meta: "text/gemini", Body: body})
+}
+
+// Redirect answers requests for path with a temporary redirect to target.
+func (s *Server) Redirect(path, target string) {
+	s.Handle(path, Route{Status: 30, Meta: target})
+}
+
+// Certificate returns the certificate the server currently presents.
+func (s *Server) Certificate() *x509.Certificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cert.Leaf
+}
+
+// RotateCert makes the server present a new certificate, optionally keeping
+// the same key.
+func (s *Server) RotateCert(keepKey bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !keepKey {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			panic(fmt.Sprintf("geminitest: failed to generate key: %v", err))
+		}
+	}
+	s.cert = newCert(key)
+}
+
+// Requests returns every request the server has received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handleConn(conn.(*tls.Conn))
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || len(line) > 1026 {
+		return
+	}
+	raw := strings.TrimRight(line, "\r\n")
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		fmt.Fprintf(conn, "59 bad request\r\n")
+		return
+	}
+
+	req := Request{
+		Raw: raw,
+		URL: u,
+	}
+
+	if u.Scheme == "titan" {
+		path, params, _ := strings.Cut(u.EscapedPath(), ";")
+		u.Path, _ = url.PathUnescape(path)
+		u.RawPath = ""
+		req.Params = make(map[string]string)
+		for _, p := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(p, "=")
+			req.Params[k], _ = url.PathUnescape(v)
+		}
+		size, err := strconv.Atoi(req.Params["size"])
+		if err != nil || size < 0 {
+			fmt.Fprintf(conn, "59 bad size\r\n")
+			return
+		}
+		req.Body = make([]byte, size)
+		_, err = io.ReadFull(r, req.Body)
+		if err != nil {
+			return
+		}
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	route, ok := s.routes[path]
+	s.mu.Unlock()
+
+	if !ok {
+		route = Route{Status: 51, Meta: "not found"}
+	}
+	if route.Func != nil {
+		route = route.Func(&req)
+	}
+
+	time.Sleep(route.Delay)
+
+	fmt.Fprintf(conn, "%d %s\r\n", route.Status, route.Meta)
+	if route.Status >= 20 && route.Status <= 29 {
+		io.WriteString(conn, route.Body)
+	}
+}
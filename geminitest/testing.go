@@ -0,0 +1,36 @@
+package geminitest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/krbreyn/gemcat/data"
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+// SetTempDirs points gemcat's data dir, known hosts, config and downloads at
+// a temp dir for the rest of the test, so that nothing it does is kept.
+func SetTempDirs(t testing.TB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	data.SetAppDir(filepath.Join(dir, "data"))
+	tofu.SetKnownHostsPath(filepath.Join(dir, "known-hosts"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DOWNLOAD_DIR", filepath.Join(dir, "downloads"))
+	t.Cleanup(func() {
+		data.SetAppDir("")
+		tofu.SetKnownHostsPath("")
+	})
+}
+
+// NewTestServer starts a server that is closed when the test ends, with
+// SetTempDirs called first.
+func NewTestServer(t testing.TB) *Server {
+	t.Helper()
+
+	SetTempDirs(t)
+	s := NewServer()
+	t.Cleanup(s.Close)
+	return s
+}
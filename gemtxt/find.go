@@ -0,0 +1,84 @@
+package gemtxt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Match is a line of a page's displayed text that matched a search.
+type Match struct {
+	// LineNo counts from 1, like the lines ColorHighlighted prints before
+	// they are wrapped.
+	LineNo int
+	Text   string
+	// LinkNo is the link number if the match is on a link line, or -1.
+	LinkNo int
+	// Spans are the start and end offsets of each match within Text.
+	Spans [][]int
+}
+
+// CompileSearch turns a user's search into a regexp. Plain searches match
+// literally and ignore case unless they contain an uppercase letter.
+func CompileSearch(pattern string, isRegex bool) (*regexp.Regexp, error) {
+	if isRegex {
+		return regexp.Compile(pattern)
+	}
+
+	expr := regexp.QuoteMeta(pattern)
+	if strings.ToLower(pattern) == pattern {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// Find searches the displayed text of every line of body.
+func Find(body string, re *regexp.Regexp) []Match {
+	var matches []Match
+
+	for i, line := range layout(body) {
+		spans := re.FindAllStringIndex(line.Text, -1)
+		if len(spans) == 0 {
+			continue
+		}
+
+		matches = append(matches, Match{
+			LineNo: i + 1,
+			Text:   line.Text,
+			LinkNo: line.LinkNo,
+			Spans:  spans,
+		})
+	}
+
+	return matches
+}
+
+// Context returns the displayed text of the lines within n lines of lineNo,
+// along with the number of the first one.
+func Context(body string, lineNo, n int) (int, []string) {
+	lines := layout(body)
+
+	start := max(lineNo-1-n, 0)
+	end := min(lineNo+n, len(lines))
+	if start >= end {
+		return lineNo, nil
+	}
+
+	var texts []string
+	for _, l := range lines[start:end] {
+		texts = append(texts, l.Text)
+	}
+	return start + 1, texts
+}
+
+// layout is the lines of body the way ColorHighlighted prints them, with a
+// blank line after every link.
+func layout(body string) []Line {
+	var lines []Line
+	for _, l := range Parse(body) {
+		lines = append(lines, l)
+		if l.Type == LinkLine || l.Type == PromptLine {
+			lines = append(lines, Line{Type: TextLine, LinkNo: -1})
+		}
+	}
+	return lines
+}
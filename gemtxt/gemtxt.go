@@ -3,6 +3,7 @@ package gemtxt
 import (
 	"bufio"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -32,7 +33,7 @@ func ColorPlain(body string) string {
 			b.WriteString("\033[32m" + line + "\033[39m\n") // Green
 		} else if strings.HasPrefix(line, ">") {
 			b.WriteString("\033[37m" + line + "\033[39m\n") // White
-		} else if strings.HasPrefix(line, "=>") {
+		} else if strings.HasPrefix(line, "=>") || strings.HasPrefix(line, "=:") {
 			b.WriteString("\033[36m" + line + "\033[39m\n") // Cyan
 		} else {
 			b.WriteString(line + "\n")
@@ -43,19 +44,39 @@ func ColorPlain(body string) string {
 }
 
 func ColorWithLinkNosAndNoURLs(body string) string {
-	var li int
-	lf := func(line string) string {
-		var b strings.Builder
-		split := strings.Fields(line)
-		b.WriteString("\033[36m" + split[0] + " " + fmt.Sprintf("[%d] ", li))
-		for _, str := range split[2:] {
-			b.WriteString(str + " ")
+	return ColorHighlighted(body, nil)
+}
+
+// ColorHighlighted colors body like ColorWithLinkNosAndNoURLs and shows every
+// match of highlight in reverse video. A nil highlight matches nothing.
+func ColorHighlighted(body string, highlight *regexp.Regexp) string {
+	var b strings.Builder
+
+	for _, line := range layout(body) {
+		text := line.Text
+		if highlight != nil {
+			text = highlight.ReplaceAllStringFunc(text, func(m string) string {
+				return "\033[7m" + m + "\033[27m" // Reverse
+			})
+		}
+
+		switch line.Type {
+		case PreToggleLine:
+			b.WriteString("\033[3m]" + text + "\033[23m\n") // Italics
+		case HeadingLine:
+			b.WriteString("\033[34m" + text + "\033[39m\n") // Blue
+		case ListLine:
+			b.WriteString("\033[32m" + text + "\033[39m\n") // Green
+		case QuoteLine:
+			b.WriteString("\033[37m" + text + "\033[39m\n") // White
+		case LinkLine, PromptLine:
+			b.WriteString("\033[36m" + text + "\033[39m\n") // Cyan
+		default:
+			b.WriteString(text + "\n")
 		}
-		b.WriteString("\033[39m\n")
-		li++
-		return b.String()
 	}
-	return ColorLinkFunc(body, lf)
+
+	return b.String()
 }
 
 func ColorLinkFunc(body string, link_func func(line string) string) string {
@@ -84,7 +105,7 @@ func ColorLinkFunc(body string, link_func func(line string) string) string {
 			b.WriteString("\033[32m" + line + "\033[39m\n") // Green
 		} else if strings.HasPrefix(line, ">") {
 			b.WriteString("\033[37m" + line + "\033[39m\n") // White
-		} else if strings.HasPrefix(line, "=>") {
+		} else if strings.HasPrefix(line, "=>") || strings.HasPrefix(line, "=:") {
 			b.WriteString(fmt.Sprintf("%s\n", link_func(line)))
 		} else {
 			b.WriteString(line + "\n")
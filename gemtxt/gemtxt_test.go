@@ -0,0 +1,90 @@
+package gemtxt
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testPage = "# Gemcat\n" +
+	"=> gemini://a.example Alpha capsule\n" +
+	"```\n" +
+	"=> not a link\n" +
+	"```\n" +
+	"=>gemini://b.example\n" +
+	"plain alpha text\n" +
+	"=: /echo Ask me\n"
+
+func TestParse(t *testing.T) {
+	lines := Parse(testPage)
+	if len(lines) != 8 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+
+	want := []struct {
+		typ    LineType
+		linkNo int
+		text   string
+	}{
+		{HeadingLine, -1, "# Gemcat"},
+		{LinkLine, 0, "=> [0] Alpha capsule"},
+		{PreToggleLine, -1, ""},
+		{PreLine, -1, "=> not a link"},
+		{PreToggleLine, -1, ""},
+		{LinkLine, 1, "=> [1] "},
+		{TextLine, -1, "plain alpha text"},
+		{PromptLine, 2, "=: [2] Ask me"},
+	}
+	for i, w := range want {
+		l := lines[i]
+		if l.Type != w.typ || l.LinkNo != w.linkNo || l.Text != w.text {
+			t.Errorf("line %d: got %+v, want %+v", i, l, w)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	re, err := CompileSearch("alpha", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := Find(testPage, re)
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches", len(matches))
+	}
+	if matches[0].LineNo != 2 || matches[0].LinkNo != 0 {
+		t.Errorf("got first match %+v", matches[0])
+	}
+	// Links are printed with a blank line after them.
+	if matches[1].LineNo != 9 || matches[1].LinkNo != -1 {
+		t.Errorf("got second match %+v", matches[1])
+	}
+	printed := strings.Split(ColorHighlighted(testPage, re), "\n")
+	for _, m := range matches {
+		if !strings.Contains(printed[m.LineNo-1], "\033[7m") {
+			t.Errorf("line %d is printed as %q", m.LineNo, printed[m.LineNo-1])
+		}
+	}
+
+	start, context := Context(testPage, 9, 1)
+	if want := []string{"", "plain alpha text", "=: [2] Ask me"}; start != 8 || !slices.Equal(context, want) {
+		t.Errorf("got context %q from %d", context, start)
+	}
+
+	re, err = CompileSearch("Alpha", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(Find(testPage, re)); n != 1 {
+		t.Errorf("uppercase search got %d matches, want 1", n)
+	}
+
+	re, err = CompileSearch(`b\.example|not`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(Find(testPage, re)); n != 1 {
+		t.Errorf("regex search got %d matches, want 1", n)
+	}
+}
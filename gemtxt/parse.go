@@ -0,0 +1,80 @@
+package gemtxt
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+type LineType int
+
+const (
+	TextLine LineType = iota
+	LinkLine
+	HeadingLine
+	ListLine
+	QuoteLine
+	PreToggleLine
+	PreLine
+	// PromptLine is spartan's =: line, a link that asks for input to send
+	// to its URL. It is numbered along with the page's links.
+	PromptLine
+)
+
+// Line is a single parsed line of gemtext. Text is what gets displayed, which
+// for links is the link number and label rather than the URL.
+type Line struct {
+	Type  LineType
+	Raw   string
+	Text  string
+	URL   string
+	Label string
+	// LinkNo is the link's number on the page, or -1 for other lines.
+	LinkNo int
+}
+
+func Parse(body string) []Line {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+
+	var lines []Line
+	var isInPreformattedBlock bool
+	var li int
+
+	for scanner.Scan() {
+		raw := scanner.Text()
+		l := Line{Type: TextLine, Raw: raw, Text: raw, LinkNo: -1}
+
+		switch {
+		case strings.HasPrefix(raw, "```"):
+			isInPreformattedBlock = !isInPreformattedBlock
+			l.Type = PreToggleLine
+			l.Text = strings.TrimPrefix(raw, "```")
+		case isInPreformattedBlock:
+			l.Type = PreLine
+		case strings.HasPrefix(raw, "#"):
+			l.Type = HeadingLine
+		case strings.HasPrefix(raw, "*"):
+			l.Type = ListLine
+		case strings.HasPrefix(raw, ">"):
+			l.Type = QuoteLine
+		case strings.HasPrefix(raw, "=>"), strings.HasPrefix(raw, "=:"):
+			split := strings.Fields(raw[2:])
+			if len(split) == 0 {
+				break
+			}
+			l.Type = LinkLine
+			if strings.HasPrefix(raw, "=:") {
+				l.Type = PromptLine
+			}
+			l.LinkNo = li
+			l.URL = split[0]
+			l.Label = strings.Join(split[1:], " ")
+			l.Text = fmt.Sprintf("%s [%d] %s", raw[:2], li, l.Label)
+			li++
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines
+}
@@ -0,0 +1,85 @@
+package interactive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
+	"github.com/krbreyn/gemcat/shell"
+)
+
+// RunBatch runs every line of r as shell input without prompting, first
+// going to u if isURL is set. It returns the exit code, which is 1 if any
+// command failed.
+func RunBatch(r io.Reader, u *url.URL, isURL bool, asJSON bool) int {
+	// Nobody is around to page through output or answer prompts.
+	var out shell.ShellOut = CLIOutput{conf: &config.Config{Pager: config.PagerOff}}
+	if asJSON {
+		out = NewJSONOutput(os.Stdout)
+	}
+	return runBatch(out, r, u, isURL)
+}
+
+func runBatch(out shell.ShellOut, r io.Reader, u *url.URL, isURL bool) int {
+	conf, err := config.Load()
+	if err != nil {
+		out.RecvError(err)
+		return 1
+	}
+
+	b := &browser.Browser{Conf: conf}
+	sh := shell.NewShell(out)
+	b.CertPrompt = sh.Out.ConfirmCertChange
+	b.InputPrompt = sh.Out.GetInput
+	b.OnWait = shell.WaitProgress(sh.Out)
+
+	failed := false
+	report := func(err error) {
+		for _, err := range shell.SplitErrors(err) {
+			if !errors.Is(err, shell.ErrExit) {
+				failed = true
+				out.RecvError(err)
+			}
+		}
+	}
+
+	if isURL {
+		err := sh.Run(b, []string{"goto", u.String()})
+		if err != nil {
+			report(err)
+			return 1
+		}
+	}
+
+	var lineNo int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		err := sh.RunLine(b, scanner.Text())
+		if err == nil {
+			continue
+		}
+
+		var lerr *shell.LexError
+		if errors.As(err, &lerr) {
+			err = fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		report(err)
+		if errors.Is(err, shell.ErrExit) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		report(err)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
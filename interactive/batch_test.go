@@ -0,0 +1,52 @@
+package interactive
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func TestRunBatchJSON(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "# Home\n=> /a.gmi A\n")
+	s.Page("/a.gmi", "# A\n")
+
+	tests := []struct {
+		name  string
+		input string
+		code  int
+		types []string
+	}{
+		{"ok", "goto " + s.URL("/") + "; links\nlgt 0", 0, []string{"status", "page", "links", "status", "page"}},
+		{"bad command", "goto " + s.URL("/") + "\nnope\nback", 1, []string{"status", "page", "error", "error"}},
+		{"exit", "stpos; exit; nope\nnope", 0, []string{"msg", "status"}},
+		{"lex error", "goto 'unterminated", 1, []string{"error"}},
+		{"not found", "goto " + s.URL("/missing"), 1, []string{"status", "error"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			code := runBatch(NewJSONOutput(&buf), strings.NewReader(tt.input), nil, false)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d", code, tt.code)
+			}
+
+			var types []string
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var obj map[string]any
+				if err := dec.Decode(&obj); err != nil {
+					t.Fatal(err)
+				}
+				types = append(types, obj["type"].(string))
+			}
+			if strings.Join(types, ",") != strings.Join(tt.types, ",") {
+				t.Errorf("got objects %v, want %v\n%s", types, tt.types, buf.String())
+			}
+		})
+	}
+}
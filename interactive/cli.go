@@ -2,53 +2,185 @@ package interactive
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
+	"github.com/krbreyn/gemcat/data"
 	"github.com/krbreyn/gemcat/gemtxt"
 	"github.com/krbreyn/gemcat/shell"
+	"github.com/krbreyn/gemcat/tofu"
 	"github.com/muesli/reflow/wordwrap"
 	"golang.org/x/term"
 )
 
 func RunCLI(u *url.URL, isURL bool, loadLast bool) {
-	b := &browser.Browser{}
-	sh := shell.NewShell(CLIOutput{})
-	scanner := bufio.NewScanner(os.Stdin)
+	conf, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	// The line editor and the prompts share one reader, so that neither
+	// buffers input the other was meant to get, like a pasted answer.
+	in := bufio.NewReader(os.Stdin)
+	b := &browser.Browser{Conf: conf}
+	sh := shell.NewShell(CLIOutput{in: in, conf: &b.Conf})
+	b.CertPrompt = sh.Out.ConfirmCertChange
+	b.InputPrompt = sh.Out.GetInput
+	b.OnWait = shell.WaitProgress(sh.Out)
+
+	err = sh.Source(b, shell.RCPath())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, err)
+	}
 
 	if isURL && u.String() != b.S.CurrURL() {
 		err := shell.GotoCmd{}.Do(b, sh.Out, []string{u.String()})
 		if err != nil {
-			fmt.Println(err.Error())
+			sh.Out.RecvError(err)
 			os.Exit(1)
 		}
 	}
 
+	readLine := func() (string, error) {
+		fmt.Print("> ")
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return trimNewline(line), nil
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		history, err := data.LoadCmdHistory()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		ed := newLineEditor(
+			in,
+			history,
+			func(before string) (int, []shell.Completion) {
+				return sh.Complete(b, before)
+			},
+			func() bool {
+				return b.Conf.EditMode == config.EditModeVi
+			},
+		)
+		ed.onHistory = func(line string) {
+			if err := data.AppendCmdHistory(line); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+		readLine = func() (string, error) {
+			return ed.ReadLine("> ")
+		}
+	}
+
 	fmt.Println("welcome to gemcat\ntype 'help' to see the available commands!")
 
 	for {
-		fmt.Print("> ")
-
-		if !scanner.Scan() {
-			if err := scanner.Err(); err != nil {
+		line, err := readLine()
+		if err != nil {
+			if err != io.EOF {
 				fmt.Fprintln(os.Stderr, "Error reading input:", err)
 			}
 			break
 		}
 
-		cmd := strings.Fields(scanner.Text())
-		sh.HandleInput(b, cmd)
+		if sh.HandleLine(b, line) {
+			break
+		}
 	}
 	os.Exit(0)
 }
 
-type CLIOutput struct{}
+type CLIOutput struct {
+	in   *bufio.Reader
+	conf *config.Config
+}
 
 func (o CLIOutput) RecvError(err error) {
-	fmt.Fprintln(os.Stderr, err)
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+
+	var lerr *shell.LexError
+	if errors.As(err, &lerr) {
+		fmt.Fprintln(os.Stderr, lerr.Caret())
+	}
+}
+
+func (o CLIOutput) RecvLinks(links []browser.Link) {
+	for _, l := range links {
+		if l.Label == "" {
+			fmt.Println(l.No, l.URL)
+		} else {
+			fmt.Printf("%d %s %s\n", l.No, l.URL, l.Label)
+		}
+	}
+}
+
+func (o CLIOutput) RecvTable(table shell.Table) {
+	marked := slices.ContainsFunc(table.Rows, func(r shell.Row) bool { return r.Current })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	writeRow := func(mark string, cells []string) {
+		if marked {
+			fmt.Fprint(tw, mark)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	if len(table.Header) != 0 {
+		writeRow("   ", table.Header)
+	}
+	for _, row := range table.Rows {
+		mark := "   "
+		if row.Current {
+			mark = "-> "
+		}
+		writeRow(mark, row.Cells)
+	}
+	tw.Flush()
+}
+
+// RecvProgress redraws a single line on the terminal, or prints when done
+// otherwise.
+func (o CLIOutput) RecvProgress(p shell.Progress) {
+	done := p.Total != 0 && p.Done >= p.Total
+
+	count := strconv.Itoa(p.Done)
+	if p.Total != 0 {
+		count += "/" + strconv.Itoa(p.Total)
+	}
+
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		if done {
+			fmt.Fprintf(os.Stderr, "%s %s\n", p.Label, count)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s %s", p.Label, count)
+	if done {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (o CLIOutput) RecvStatus(s shell.Status) {
+	if s.Kind == shell.StatusWarning {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", s.Msg)
+		return
+	}
+	fmt.Println(s.Msg)
 }
 
 func (o CLIOutput) RecvMsg(msg string) {
@@ -56,11 +188,42 @@ func (o CLIOutput) RecvMsg(msg string) {
 }
 
 func (o CLIOutput) RecvPage(page browser.Page) {
-	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
 	if err != nil {
-		width = 80
+		width, height = 80, 0
+	}
+	text := renderPage(page, width)
+
+	if o.usePager(text, height) {
+		err := runPager(o.in, os.Stdout, text, height)
+		if err == nil {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "pager error:", err)
+	}
+	fmt.Println(text)
+}
+
+// renderPage colors page, highlighting the matches of its search, and wraps
+// it to width.
+func renderPage(page browser.Page, width int) string {
+	var highlight *regexp.Regexp
+	if page.Find != nil {
+		highlight = page.Find.Pattern
+	}
+	return wordwrap.String(gemtxt.ColorHighlighted(page.Content, highlight), width)
+}
+
+func (o CLIOutput) usePager(text string, height int) bool {
+	mode := config.PagerAuto
+	if o.conf != nil && o.conf.Pager != "" {
+		mode = o.conf.Pager
 	}
-	fmt.Println(wordwrap.String(gemtxt.ColorWithLinkNosAndNoURLs(page.Content), width))
+
+	if mode == config.PagerOff || height == 0 || o.in == nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	return mode == config.PagerAlways || strings.Count(text, "\n")+1 > height-1
 }
 
 func (o CLIOutput) ShowHelp(help []shell.HelpInfo) {
@@ -76,9 +239,61 @@ func (o CLIOutput) ShowHelp(help []shell.HelpInfo) {
 	}
 }
 
-// func (o CLIOutput) GetInput() string {
+func (o CLIOutput) ConfirmCertChange(c tofu.CertChange) tofu.Decision {
+	fmt.Printf("[TOFU] The certificate for %s has changed!\n", c.Host)
+	fmt.Printf("  old fingerprint: %s\n", c.OldFingerprint)
+	if c.OldExpiry.IsZero() {
+		fmt.Println("  old expiry:      unknown")
+	} else {
+		fmt.Printf("  old expiry:      %s\n", c.OldExpiry.Format(time.DateTime))
+	}
+	fmt.Printf("  new fingerprint: %s\n", c.NewFingerprint)
+	fmt.Printf("  new validity:    %s to %s\n",
+		c.NewNotBefore.Format(time.DateTime), c.NewNotAfter.Format(time.DateTime))
 
-// }
+	for {
+		fmt.Print("trust [o]nce, trust [a]lways, or a[b]ort? ")
+		answer, ok := o.readLine()
+		if !ok {
+			return tofu.Abort
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "o", "once":
+			return tofu.TrustOnce
+		case "a", "always":
+			return tofu.TrustAlways
+		case "b", "abort", "":
+			return tofu.Abort
+		}
+	}
+}
+
+func (o CLIOutput) GetInput(prompt string) (string, bool) {
+	fmt.Print(prompt)
+	input, ok := o.readLine()
+	if !ok {
+		fmt.Println()
+	}
+	return input, ok
+}
+
+// readLine reads a line of input. ok is false at the end of it, or if there
+// is nothing to read from.
+func (o CLIOutput) readLine() (line string, ok bool) {
+	if o.in == nil {
+		return "", false
+	}
+	line, err := o.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", false
+	}
+	return trimNewline(line), true
+}
+
+func trimNewline(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
 
 // func (o CLIOutput) GetCert() *x509.Certificate {
 
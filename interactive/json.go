@@ -0,0 +1,175 @@
+package interactive
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/shell"
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+// JSONOutput writes everything the shell outputs as one JSON object per
+// line, each with a "type" field saying what it is.
+type JSONOutput struct {
+	enc *json.Encoder
+}
+
+func NewJSONOutput(w io.Writer) JSONOutput {
+	return JSONOutput{enc: json.NewEncoder(w)}
+}
+
+type jsonMsg struct {
+	Type string `json:"type"`
+	Msg  string `json:"msg"`
+}
+
+type jsonError struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+type jsonLink struct {
+	No    int    `json:"no"`
+	URL   string `json:"url"`
+	Label string `json:"label,omitempty"`
+}
+
+type jsonLinks struct {
+	Type  string     `json:"type"`
+	Links []jsonLink `json:"links"`
+}
+
+type jsonTable struct {
+	Type    string     `json:"type"`
+	Header  []string   `json:"header,omitempty"`
+	Rows    [][]string `json:"rows"`
+	Current *int       `json:"current,omitempty"`
+}
+
+type jsonProgress struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	Done  int    `json:"done"`
+	Total int    `json:"total,omitempty"`
+}
+
+type jsonStatus struct {
+	Type string `json:"type"`
+	Kind string `json:"kind"`
+	Msg  string `json:"msg"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonPage struct {
+	Type    string     `json:"type"`
+	URL     string     `json:"url"`
+	Content string     `json:"content"`
+	Links   []jsonLink `json:"links"`
+}
+
+type jsonHelp struct {
+	Type     string         `json:"type"`
+	Commands []jsonHelpInfo `json:"commands"`
+}
+
+type jsonHelpInfo struct {
+	Words []string `json:"words"`
+	Desc  string   `json:"desc"`
+}
+
+type jsonCertChange struct {
+	Type           string    `json:"type"`
+	Host           string    `json:"host"`
+	OldFingerprint string    `json:"old_fingerprint"`
+	OldExpiry      time.Time `json:"old_expiry,omitzero"`
+	NewFingerprint string    `json:"new_fingerprint"`
+	NewNotBefore   time.Time `json:"new_not_before"`
+	NewNotAfter    time.Time `json:"new_not_after"`
+}
+
+func (o JSONOutput) RecvError(err error) {
+	o.enc.Encode(jsonError{Type: "error", Error: err.Error()})
+}
+
+func (o JSONOutput) RecvMsg(msg string) {
+	o.enc.Encode(jsonMsg{Type: "msg", Msg: msg})
+}
+
+func toJSONLinks(links []browser.Link) []jsonLink {
+	jl := make([]jsonLink, 0, len(links))
+	for _, l := range links {
+		jl = append(jl, jsonLink{No: l.No, URL: l.URL, Label: l.Label})
+	}
+	return jl
+}
+
+func (o JSONOutput) RecvPage(page browser.Page) {
+	o.enc.Encode(jsonPage{
+		Type:    "page",
+		URL:     page.URL,
+		Content: page.Content,
+		Links:   toJSONLinks(page.Links),
+	})
+}
+
+func (o JSONOutput) RecvLinks(links []browser.Link) {
+	o.enc.Encode(jsonLinks{Type: "links", Links: toJSONLinks(links)})
+}
+
+// RecvTable gives the index of the current row, if there is one, as
+// "current".
+func (o JSONOutput) RecvTable(table shell.Table) {
+	jt := jsonTable{Type: "table", Header: table.Header, Rows: [][]string{}}
+	for i, row := range table.Rows {
+		jt.Rows = append(jt.Rows, row.Cells)
+		if row.Current {
+			jt.Current = &i
+		}
+	}
+	o.enc.Encode(jt)
+}
+
+func (o JSONOutput) RecvProgress(p shell.Progress) {
+	o.enc.Encode(jsonProgress{Type: "progress", Label: p.Label, Done: p.Done, Total: p.Total})
+}
+
+func (o JSONOutput) RecvStatus(s shell.Status) {
+	o.enc.Encode(jsonStatus{Type: "status", Kind: s.Kind.String(), Msg: s.Msg, URL: s.URL})
+}
+
+func (o JSONOutput) ShowHelp(help []shell.HelpInfo) {
+	var cmds []jsonHelpInfo
+	for _, hi := range help {
+		cmds = append(cmds, jsonHelpInfo{Words: hi.Words, Desc: hi.Desc})
+	}
+	o.enc.Encode(jsonHelp{Type: "help", Commands: cmds})
+}
+
+type jsonInput struct {
+	Type   string `json:"type"`
+	Prompt string `json:"prompt"`
+}
+
+// GetInput reports that input was needed and cancels, since nobody is
+// around to answer. Batch input has to be given in the URL instead.
+func (o JSONOutput) GetInput(prompt string) (string, bool) {
+	o.enc.Encode(jsonInput{Type: "input", Prompt: prompt})
+	return "", false
+}
+
+// ConfirmCertChange reports the change and aborts, since nobody is around to
+// answer.
+func (o JSONOutput) ConfirmCertChange(c tofu.CertChange) tofu.Decision {
+	o.enc.Encode(jsonCertChange{
+		Type:           "cert_change",
+		Host:           c.Host,
+		OldFingerprint: c.OldFingerprint,
+		OldExpiry:      c.OldExpiry,
+		NewFingerprint: c.NewFingerprint,
+		NewNotBefore:   c.NewNotBefore,
+		NewNotAfter:    c.NewNotAfter,
+	})
+	return tofu.Abort
+}
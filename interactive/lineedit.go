@@ -0,0 +1,576 @@
+package interactive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/krbreyn/gemcat/shell"
+	"golang.org/x/term"
+)
+
+type keyKind int
+
+const (
+	keyNone keyKind = iota
+	keyRune
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyPageUp
+	keyPageDown
+	keyEscape
+)
+
+type key struct {
+	kind keyKind
+	r    rune
+	alt  bool
+}
+
+const (
+	ctrlA     = 0x01
+	ctrlB     = 0x02
+	ctrlC     = 0x03
+	ctrlD     = 0x04
+	ctrlE     = 0x05
+	ctrlF     = 0x06
+	ctrlH     = 0x08
+	tab       = 0x09
+	ctrlK     = 0x0b
+	ctrlL     = 0x0c
+	ctrlN     = 0x0e
+	ctrlP     = 0x10
+	ctrlU     = 0x15
+	ctrlW     = 0x17
+	ctrlY     = 0x19
+	backspace = 0x7f
+)
+
+// lineEditor reads lines from a terminal in raw mode, with emacs or vi style
+// bindings, history and tab completion.
+type lineEditor struct {
+	in      *bufio.Reader
+	fd      int
+	history []string
+	// onHistory is called with every line added to the history, to save it.
+	onHistory func(line string)
+	complete  func(before string) (int, []shell.Completion)
+	// vi is checked at the start of every line so that the mode can be
+	// switched from the shell.
+	vi func() bool
+
+	prompt  string
+	buf     []rune
+	pos     int
+	histPos int
+	draft   []rune
+	killed  []rune
+	normal  bool
+	pending rune
+}
+
+// newLineEditor reads keys from in, which has to be reading the terminal on
+// stdin.
+func newLineEditor(in *bufio.Reader, history []string, complete func(string) (int, []shell.Completion), vi func() bool) *lineEditor {
+	return &lineEditor{
+		in:       in,
+		fd:       int(os.Stdin.Fd()),
+		history:  history,
+		complete: complete,
+		vi:       vi,
+	}
+}
+
+// ReadLine returns io.EOF when ctrl-d is pressed on an empty line.
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	oldState, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(e.fd, oldState)
+
+	e.prompt = prompt
+	e.buf = nil
+	e.pos = 0
+	e.histPos = len(e.history)
+	e.normal = false
+	e.pending = 0
+	e.refresh()
+
+	for {
+		k, err := readKey(e.in)
+		if err != nil {
+			return "", err
+		}
+
+		if k.kind == keyRune && (k.r == '\r' || k.r == '\n') {
+			fmt.Print("\r\n")
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, nil
+		}
+
+		if k.kind == keyRune && k.r == ctrlC {
+			fmt.Print("^C\r\n")
+			e.buf = nil
+			e.pos = 0
+			e.histPos = len(e.history)
+			e.normal = false
+			e.refresh()
+			continue
+		}
+
+		if k.kind == keyRune && k.r == ctrlD && len(e.buf) == 0 {
+			fmt.Print("\r\n")
+			return "", io.EOF
+		}
+
+		if e.normal {
+			e.handleNormal(k)
+		} else {
+			e.handleInsert(k)
+		}
+		e.refresh()
+	}
+}
+
+// addHistory adds line to the history unless it's blank or the same as the
+// last line.
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" ||
+		(len(e.history) != 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.onHistory != nil {
+		e.onHistory(line)
+	}
+}
+
+// readKey reads a keypress from a terminal in raw mode.
+func readKey(in *bufio.Reader) (key, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+	if r != 0x1b {
+		return key{kind: keyRune, r: r}, nil
+	}
+
+	// A lone escape is a keypress, anything following it in the same read
+	// is an escape sequence.
+	if in.Buffered() == 0 {
+		return key{kind: keyEscape}, nil
+	}
+
+	r, _, err = in.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch r {
+	case '[':
+		var params strings.Builder
+		for {
+			c, _, err := in.ReadRune()
+			if err != nil {
+				return key{}, err
+			}
+			if c >= '@' && c <= '~' {
+				return csiKey(params.String(), c), nil
+			}
+			params.WriteRune(c)
+		}
+	case 'O':
+		c, _, err := in.ReadRune()
+		if err != nil {
+			return key{}, err
+		}
+		return csiKey("", c), nil
+	}
+
+	return key{kind: keyRune, r: r, alt: true}, nil
+}
+
+func csiKey(params string, final rune) key {
+	switch final {
+	case 'A':
+		return key{kind: keyUp}
+	case 'B':
+		return key{kind: keyDown}
+	case 'C':
+		return key{kind: keyRight}
+	case 'D':
+		return key{kind: keyLeft}
+	case 'H':
+		return key{kind: keyHome}
+	case 'F':
+		return key{kind: keyEnd}
+	case '~':
+		switch params {
+		case "1", "7":
+			return key{kind: keyHome}
+		case "4", "8":
+			return key{kind: keyEnd}
+		case "3":
+			return key{kind: keyDelete}
+		case "5":
+			return key{kind: keyPageUp}
+		case "6":
+			return key{kind: keyPageDown}
+		}
+	}
+	return key{kind: keyNone}
+}
+
+func (e *lineEditor) refresh() {
+	var b strings.Builder
+	b.WriteString("\r" + e.prompt + string(e.buf) + "\033[K")
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(&b, "\033[%dD", n)
+	}
+	fmt.Print(b.String())
+}
+
+// handleInsert handles keys for emacs bindings and vi's insert mode.
+func (e *lineEditor) handleInsert(k key) {
+	switch k.kind {
+	case keyUp:
+		e.historyPrev()
+	case keyDown:
+		e.historyNext()
+	case keyLeft:
+		e.pos = max(e.pos-1, 0)
+	case keyRight:
+		e.pos = min(e.pos+1, len(e.buf))
+	case keyHome:
+		e.pos = 0
+	case keyEnd:
+		e.pos = len(e.buf)
+	case keyDelete:
+		e.deleteRange(e.pos, e.pos+1, false)
+	case keyEscape:
+		if e.vi() {
+			e.normal = true
+			e.pos = max(e.pos-1, 0)
+		}
+	case keyRune:
+		if k.alt {
+			e.handleAlt(k.r)
+			return
+		}
+		e.handleCtrl(k.r)
+	}
+}
+
+func (e *lineEditor) handleAlt(r rune) {
+	switch r {
+	case 'b':
+		e.pos = e.wordBack(e.pos)
+	case 'f':
+		e.pos = e.wordEnd(e.pos)
+	case 'd':
+		e.deleteRange(e.pos, e.wordEnd(e.pos), true)
+	case backspace, ctrlH:
+		e.deleteRange(e.wordBack(e.pos), e.pos, true)
+	}
+}
+
+func (e *lineEditor) handleCtrl(r rune) {
+	switch r {
+	case ctrlA:
+		e.pos = 0
+	case ctrlE:
+		e.pos = len(e.buf)
+	case ctrlB:
+		e.pos = max(e.pos-1, 0)
+	case ctrlF:
+		e.pos = min(e.pos+1, len(e.buf))
+	case ctrlD:
+		e.deleteRange(e.pos, e.pos+1, false)
+	case backspace, ctrlH:
+		e.deleteRange(e.pos-1, e.pos, false)
+	case ctrlK:
+		e.deleteRange(e.pos, len(e.buf), true)
+	case ctrlU:
+		e.deleteRange(0, e.pos, true)
+	case ctrlW:
+		start := e.pos
+		for start > 0 && e.buf[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && e.buf[start-1] != ' ' {
+			start--
+		}
+		e.deleteRange(start, e.pos, true)
+	case ctrlY:
+		e.insert(e.killed)
+	case ctrlP:
+		e.historyPrev()
+	case ctrlN:
+		e.historyNext()
+	case ctrlL:
+		fmt.Print("\033[H\033[2J")
+	case tab:
+		e.tabComplete()
+	default:
+		if unicode.IsPrint(r) {
+			e.insert([]rune{r})
+		}
+	}
+}
+
+// handleNormal handles keys in vi's normal mode.
+func (e *lineEditor) handleNormal(k key) {
+	defer func() {
+		if e.normal && len(e.buf) > 0 {
+			e.pos = min(e.pos, len(e.buf)-1)
+		}
+		e.pos = max(e.pos, 0)
+	}()
+
+	switch k.kind {
+	case keyUp:
+		e.historyPrev()
+		return
+	case keyDown:
+		e.historyNext()
+		return
+	case keyLeft:
+		k = key{kind: keyRune, r: 'h'}
+	case keyRight:
+		k = key{kind: keyRune, r: 'l'}
+	case keyHome:
+		k = key{kind: keyRune, r: '0'}
+	case keyEnd:
+		k = key{kind: keyRune, r: '$'}
+	case keyDelete:
+		k = key{kind: keyRune, r: 'x'}
+	case keyRune:
+	default:
+		e.pending = 0
+		return
+	}
+
+	if e.pending != 0 {
+		op := e.pending
+		e.pending = 0
+
+		start, end := e.pos, e.pos
+		switch k.r {
+		case op:
+			start, end = 0, len(e.buf)
+		case 'w', 'e':
+			end = e.wordEnd(e.pos)
+		case 'b':
+			start = e.wordBack(e.pos)
+		case '$':
+			end = len(e.buf)
+		case '0', '^':
+			start = 0
+		default:
+			return
+		}
+		e.deleteRange(start, end, true)
+		if op == 'c' {
+			e.normal = false
+		}
+		return
+	}
+
+	switch k.r {
+	case 'h', backspace, ctrlH:
+		e.pos = max(e.pos-1, 0)
+	case 'l', ' ':
+		e.pos = min(e.pos+1, len(e.buf))
+	case '0', '^':
+		e.pos = 0
+	case '$':
+		e.pos = len(e.buf)
+	case 'w':
+		e.pos = e.wordForward(e.pos)
+	case 'e':
+		e.pos = max(e.wordEnd(e.pos+1)-1, 0)
+	case 'b':
+		e.pos = e.wordBack(e.pos)
+	case 'x':
+		e.deleteRange(e.pos, e.pos+1, true)
+	case 'X':
+		e.deleteRange(e.pos-1, e.pos, true)
+	case 'D':
+		e.deleteRange(e.pos, len(e.buf), true)
+	case 'C':
+		e.deleteRange(e.pos, len(e.buf), true)
+		e.normal = false
+	case 'S':
+		e.deleteRange(0, len(e.buf), true)
+		e.normal = false
+	case 'd', 'c':
+		e.pending = k.r
+	case 'p':
+		e.pos = min(e.pos+1, len(e.buf))
+		e.insert(e.killed)
+		e.pos--
+	case 'P':
+		e.insert(e.killed)
+		e.pos--
+	case 'i':
+		e.normal = false
+	case 'a':
+		e.pos = min(e.pos+1, len(e.buf))
+		e.normal = false
+	case 'I':
+		e.pos = 0
+		e.normal = false
+	case 'A':
+		e.pos = len(e.buf)
+		e.normal = false
+	case 'k', ctrlP:
+		e.historyPrev()
+	case 'j', ctrlN:
+		e.historyNext()
+	case ctrlL:
+		fmt.Print("\033[H\033[2J")
+	}
+}
+
+func (e *lineEditor) insert(rs []rune) {
+	e.buf = append(e.buf[:e.pos], append(append([]rune(nil), rs...), e.buf[e.pos:]...)...)
+	e.pos += len(rs)
+}
+
+func (e *lineEditor) deleteRange(start, end int, kill bool) {
+	start = max(start, 0)
+	end = min(end, len(e.buf))
+	if start >= end {
+		return
+	}
+	if kill {
+		e.killed = append([]rune(nil), e.buf[start:end]...)
+	}
+	e.buf = append(e.buf[:start], e.buf[end:]...)
+	e.pos = start
+}
+
+// wordForward returns the start of the next word.
+func (e *lineEditor) wordForward(pos int) int {
+	for pos < len(e.buf) && e.buf[pos] != ' ' {
+		pos++
+	}
+	for pos < len(e.buf) && e.buf[pos] == ' ' {
+		pos++
+	}
+	return pos
+}
+
+// wordEnd returns the position just past the end of the current or next
+// word.
+func (e *lineEditor) wordEnd(pos int) int {
+	for pos < len(e.buf) && e.buf[pos] == ' ' {
+		pos++
+	}
+	for pos < len(e.buf) && e.buf[pos] != ' ' {
+		pos++
+	}
+	return pos
+}
+
+// wordBack returns the start of the current or previous word.
+func (e *lineEditor) wordBack(pos int) int {
+	for pos > 0 && e.buf[pos-1] == ' ' {
+		pos--
+	}
+	for pos > 0 && e.buf[pos-1] != ' ' {
+		pos--
+	}
+	return pos
+}
+
+func (e *lineEditor) historyPrev() {
+	if e.histPos == 0 {
+		return
+	}
+	if e.histPos == len(e.history) {
+		e.draft = e.buf
+	}
+	e.histPos--
+	e.buf = []rune(e.history[e.histPos])
+	e.pos = len(e.buf)
+}
+
+func (e *lineEditor) historyNext() {
+	if e.histPos == len(e.history) {
+		return
+	}
+	e.histPos++
+	if e.histPos == len(e.history) {
+		e.buf = e.draft
+	} else {
+		e.buf = []rune(e.history[e.histPos])
+	}
+	e.pos = len(e.buf)
+}
+
+func (e *lineEditor) tabComplete() {
+	if e.complete == nil {
+		return
+	}
+
+	before := string(e.buf[:e.pos])
+	start, cands := e.complete(before)
+	word := []rune(before[start:])
+	wordStart := utf8.RuneCountInString(before[:start])
+
+	if len(cands) == 0 {
+		fmt.Print("\a")
+		return
+	}
+
+	replace := func(text string) {
+		e.deleteRange(wordStart, e.pos, false)
+		e.pos = wordStart
+		e.insert([]rune(text))
+	}
+
+	if len(cands) == 1 {
+		replace(cands[0].Text + " ")
+		return
+	}
+
+	prefix := cands[0].Text
+	for _, c := range cands[1:] {
+		for !strings.HasPrefix(c.Text, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	if utf8.RuneCountInString(prefix) > len(word) {
+		replace(prefix)
+		return
+	}
+
+	const maxListed = 50
+	var b strings.Builder
+	b.WriteString("\r\n")
+	for i, c := range cands {
+		if i == maxListed {
+			fmt.Fprintf(&b, "... and %d more\r\n", len(cands)-maxListed)
+			break
+		}
+		if c.Desc != "" {
+			fmt.Fprintf(&b, "%s\t%s\r\n", c.Text, c.Desc)
+		} else {
+			fmt.Fprintf(&b, "%s\r\n", c.Text)
+		}
+	}
+	fmt.Print(b.String())
+}
@@ -0,0 +1,256 @@
+package interactive
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/shell"
+)
+
+// newTestEditor is a line editor reading keys from input, without a
+// terminal.
+func newTestEditor(input string, vi bool, history ...string) *lineEditor {
+	e := newLineEditor(bufio.NewReader(strings.NewReader(input)), history, nil, func() bool { return vi })
+	e.histPos = len(history)
+	return e
+}
+
+// typeKeys feeds the keys of each read to the editor, the way ReadLine
+// does between the start of a line and enter. An escape is only a key of
+// its own at the end of a read.
+func typeKeys(t *testing.T, e *lineEditor, reads ...string) {
+	t.Helper()
+	for _, r := range reads {
+		e.in = bufio.NewReader(strings.NewReader(r))
+		for {
+			k, err := readKey(e.in)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.normal {
+				e.handleNormal(k)
+			} else {
+				e.handleInsert(k)
+			}
+		}
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	e := newTestEditor("a\x1b[A\x1bOH\x1b[3~\x1b[1;5C\x1bf\x01\x1b", false)
+	want := []key{
+		{kind: keyRune, r: 'a'},
+		{kind: keyUp},
+		{kind: keyHome},
+		{kind: keyDelete},
+		{kind: keyRight},
+		{kind: keyRune, r: 'f', alt: true},
+		{kind: keyRune, r: ctrlA},
+		{kind: keyEscape},
+	}
+	for i, w := range want {
+		k, err := readKey(e.in)
+		if err != nil {
+			t.Fatalf("key %d: %v", i, err)
+		}
+		if k != w {
+			t.Errorf("key %d: got %+v, want %+v", i, k, w)
+		}
+	}
+	if _, err := readKey(e.in); err != io.EOF {
+		t.Errorf("got %v at the end", err)
+	}
+}
+
+func TestCSIKey(t *testing.T) {
+	tests := []struct {
+		params string
+		final  rune
+		want   keyKind
+	}{
+		{"", 'A', keyUp},
+		{"", 'B', keyDown},
+		{"", 'C', keyRight},
+		{"", 'D', keyLeft},
+		{"", 'H', keyHome},
+		{"", 'F', keyEnd},
+		{"1", '~', keyHome},
+		{"7", '~', keyHome},
+		{"4", '~', keyEnd},
+		{"8", '~', keyEnd},
+		{"3", '~', keyDelete},
+		{"5", '~', keyPageUp},
+		{"6", '~', keyPageDown},
+		{"2", '~', keyNone},
+		{"", 'Z', keyNone},
+	}
+	for _, tt := range tests {
+		if got := csiKey(tt.params, tt.final).kind; got != tt.want {
+			t.Errorf("%q %c: got %v, want %v", tt.params, tt.final, got, tt.want)
+		}
+	}
+}
+
+func TestLineEditorKeys(t *testing.T) {
+	history := []string{"first", "second"}
+
+	tests := []struct {
+		name  string
+		vi    bool
+		reads []string
+		buf   string
+		pos   int
+	}{
+		// emacs
+		{name: "typing", reads: []string{"hello"}, buf: "hello", pos: 5},
+		{name: "ctrl-a", reads: []string{"hello\x01X"}, buf: "Xhello", pos: 1},
+		{name: "ctrl-e", reads: []string{"hello\x01\x05X"}, buf: "helloX", pos: 6},
+		{name: "ctrl-b ctrl-f", reads: []string{"abc\x02\x02\x06X"}, buf: "abXc", pos: 3},
+		{name: "backspace", reads: []string{"abc\x7f"}, buf: "ab", pos: 2},
+		{name: "arrows", reads: []string{"abc\x1b[D\x1b[D\x1b[C"}, buf: "abc", pos: 2},
+		{name: "home delete", reads: []string{"abc\x1b[H\x1b[3~"}, buf: "bc", pos: 0},
+		{name: "ctrl-d deletes", reads: []string{"abc\x01\x04"}, buf: "bc", pos: 0},
+		{name: "ctrl-k", reads: []string{"abc\x1b[D\x1b[D\x0b"}, buf: "a", pos: 1},
+		{name: "ctrl-u", reads: []string{"abc def\x1b[D\x1b[D\x1b[D\x15"}, buf: "def", pos: 0},
+		{name: "ctrl-w", reads: []string{"hello world  \x17"}, buf: "hello ", pos: 6},
+		{name: "kill and yank", reads: []string{"hello world\x17\x01\x19"}, buf: "worldhello ", pos: 5},
+		{name: "alt-b alt-d", reads: []string{"one two\x1bb\x1bd"}, buf: "one ", pos: 4},
+		{name: "alt-f", reads: []string{"one two\x01\x1bfX"}, buf: "oneX two", pos: 4},
+		{name: "alt-backspace", reads: []string{"one two\x1b\x7f"}, buf: "one ", pos: 4},
+		{name: "escape is nothing", reads: []string{"ab\x1b"}, buf: "ab", pos: 2},
+		{name: "up", reads: []string{"x\x1b[A"}, buf: "second", pos: 6},
+		{name: "up twice", reads: []string{"x\x1b[A\x10"}, buf: "first", pos: 5},
+		{name: "past the oldest", reads: []string{"\x10\x10\x10"}, buf: "first", pos: 5},
+		{name: "back to the draft", reads: []string{"x\x1b[A\x10\x1b[B\x0e"}, buf: "x", pos: 1},
+
+		// vi
+		{name: "vi insert", vi: true, reads: []string{"hello"}, buf: "hello", pos: 5},
+		{name: "vi escape", vi: true, reads: []string{"hello\x1b"}, buf: "hello", pos: 4},
+		{name: "vi w X", vi: true, reads: []string{"one two three\x1b", "0wwX"}, buf: "one twothree", pos: 7},
+		{name: "vi b", vi: true, reads: []string{"one two\x1b", "bix"}, buf: "one xtwo", pos: 5},
+		{name: "vi e", vi: true, reads: []string{"one two\x1b", "0ea!"}, buf: "one! two", pos: 4},
+		{name: "vi $ and 0", vi: true, reads: []string{"abc\x1b", "0$"}, buf: "abc", pos: 2},
+		{name: "vi x p", vi: true, reads: []string{"abc\x1b", "0xp"}, buf: "bac", pos: 1},
+		{name: "vi X P", vi: true, reads: []string{"abc\x1b", "XP"}, buf: "abc", pos: 1},
+		{name: "vi dw", vi: true, reads: []string{"one two\x1b", "0dw"}, buf: " two", pos: 0},
+		{name: "vi db", vi: true, reads: []string{"one two\x1b", "db"}, buf: "one o", pos: 4},
+		{name: "vi dd", vi: true, reads: []string{"one two\x1b", "dd"}, buf: "", pos: 0},
+		{name: "vi d$", vi: true, reads: []string{"one two\x1b", "0wd$"}, buf: "one ", pos: 3},
+		{name: "vi d with a bad motion", vi: true, reads: []string{"one\x1b", "dzx"}, buf: "on", pos: 1},
+		{name: "vi D", vi: true, reads: []string{"one two\x1b", "bD"}, buf: "one ", pos: 3},
+		{name: "vi cc", vi: true, reads: []string{"abc\x1b", "ccxyz"}, buf: "xyz", pos: 3},
+		{name: "vi cw", vi: true, reads: []string{"one two\x1b", "0cwsix"}, buf: "six two", pos: 3},
+		{name: "vi C", vi: true, reads: []string{"one two\x1b", "bCsix"}, buf: "one six", pos: 7},
+		{name: "vi S", vi: true, reads: []string{"one two\x1b", "Ssix"}, buf: "six", pos: 3},
+		{name: "vi I", vi: true, reads: []string{"abc\x1b", "IX"}, buf: "Xabc", pos: 1},
+		{name: "vi A", vi: true, reads: []string{"abc\x1b", "0AX"}, buf: "abcX", pos: 4},
+		{name: "vi a", vi: true, reads: []string{"abc\x1b", "0aX"}, buf: "aXbc", pos: 2},
+		{name: "vi h l", vi: true, reads: []string{"abc\x1b", "hhl"}, buf: "abc", pos: 1},
+		{name: "vi l stops at the end", vi: true, reads: []string{"abc\x1b", "llll"}, buf: "abc", pos: 2},
+		{name: "vi arrows", vi: true, reads: []string{"abc\x1b", "\x1b[D\x1b[D\x1b[3~"}, buf: "bc", pos: 0},
+		{name: "vi k", vi: true, reads: []string{"\x1b", "k"}, buf: "second", pos: 5},
+		{name: "vi k j", vi: true, reads: []string{"x\x1b", "kkj"}, buf: "second", pos: 5},
+		{name: "vi yank after a kill", vi: true, reads: []string{"abc\x1b", "D0P"}, buf: "cab", pos: 0},
+	}
+
+	for _, tt := range tests {
+		e := newTestEditor("", tt.vi, history...)
+		typeKeys(t, e, tt.reads...)
+		if string(e.buf) != tt.buf || e.pos != tt.pos {
+			t.Errorf("%s: got %q at %d, want %q at %d", tt.name, string(e.buf), e.pos, tt.buf, tt.pos)
+		}
+	}
+}
+
+func TestTabComplete(t *testing.T) {
+	words := []string{"bookmarks", "bookmark-add", "back", "café", "cafétéria", "example.org"}
+	complete := func(before string) (int, []shell.Completion) {
+		start := strings.LastIndex(before, " ") + 1
+		var cands []shell.Completion
+		for _, w := range words {
+			if strings.HasPrefix(w, before[start:]) {
+				cands = append(cands, shell.Completion{Text: w})
+			}
+		}
+		return start, cands
+	}
+
+	tests := []struct {
+		name string
+		buf  string
+		pos  int
+		want string
+		// wantPos is where the cursor ends up.
+		wantPos int
+	}{
+		{name: "one candidate", buf: "ba", pos: 2, want: "back ", wantPos: 5},
+		{name: "common prefix", buf: "bo", pos: 2, want: "bookmark", wantPos: 8},
+		{name: "already the prefix", buf: "bookmark", pos: 8, want: "bookmark", wantPos: 8},
+		{name: "unicode prefix", buf: "caf", pos: 3, want: "café", wantPos: 4},
+		{name: "nothing", buf: "zz", pos: 2, want: "zz", wantPos: 2},
+		{name: "mid line", buf: "gt ex rest", pos: 5, want: "gt example.org  rest", wantPos: 15},
+		{name: "after unicode", buf: "né cafét", pos: 8, want: "né cafétéria ", wantPos: 13},
+	}
+	for _, tt := range tests {
+		e := newTestEditor("", false)
+		e.complete = complete
+		e.buf = []rune(tt.buf)
+		e.pos = tt.pos
+		e.tabComplete()
+		if string(e.buf) != tt.want || e.pos != tt.wantPos {
+			t.Errorf("%s: got %q at %d, want %q at %d", tt.name, string(e.buf), e.pos, tt.want, tt.wantPos)
+		}
+	}
+}
+
+func TestSharedInput(t *testing.T) {
+	// Typed ahead of a prompt, say by a paste, and read by the editor in one
+	// go. The prompts have to get what the editor didn't use.
+	in := bufio.NewReader(strings.NewReader("gt 1\nsecret\nsecond\n"))
+	e := newLineEditor(in, nil, nil, func() bool { return false })
+	for range len("gt 1") {
+		k, err := readKey(e.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.handleInsert(k)
+	}
+	if string(e.buf) != "gt 1" {
+		t.Fatalf("got %q", string(e.buf))
+	}
+	if k, err := readKey(e.in); err != nil || k.r != '\n' {
+		t.Fatalf("got %+v, %v instead of enter", k, err)
+	}
+
+	o := CLIOutput{in: in}
+	for _, want := range []string{"secret", "second"} {
+		if got, ok := o.GetInput(""); got != want || !ok {
+			t.Errorf("got %q, %v, want %q", got, ok, want)
+		}
+	}
+	if got, ok := o.GetInput(""); ok {
+		t.Errorf("got %q at the end of input", got)
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	e := newTestEditor("", false, "first")
+	var saved []string
+	e.onHistory = func(line string) { saved = append(saved, line) }
+
+	for _, line := range []string{"first", "second", "second", " ", "", "first"} {
+		e.addHistory(line)
+	}
+	if want := []string{"first", "second", "first"}; !slices.Equal(e.history, want) {
+		t.Errorf("got history %q, want %q", e.history, want)
+	}
+	if want := []string{"second", "first"}; !slices.Equal(saved, want) {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+}
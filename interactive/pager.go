@@ -0,0 +1,234 @@
+package interactive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// linkLineRe matches the start of a rendered link or spartan prompt line.
+var linkLineRe = regexp.MustCompile(`^\x1b\[36m=[>:] \[(\d+)\]`)
+
+// highlight starts a search match in a rendered page.
+const highlight = "\033[7m"
+
+const pagerHelp = "q quit, space/b page, j/k line, g/G ends, [n]l link"
+
+// runPager shows text through $PAGER if it is set, or the built-in pager
+// otherwise. The built-in pager reads keys from in, which is shared with
+// the line editor so that neither loses input meant for the other.
+func runPager(in *bufio.Reader, out io.Writer, text string, height int) error {
+	if pager := os.Getenv("PAGER"); pager != "" {
+		cmd := exec.Command("sh", "-c", pager)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	return builtinPager(in, out, strings.Split(strings.TrimSuffix(text, "\n"), "\n"), height)
+}
+
+// builtinPager is a small less-like pager. Besides the usual movement keys,
+// typing a link number followed by 'l' or enter scrolls to that link, and n
+// and N step through the matches of a search. The terminal is only put in
+// raw mode if stdin is one.
+func builtinPager(in *bufio.Reader, out io.Writer, lines []string, height int) error {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, oldState)
+	}
+
+	p := newPager(lines, height)
+	for {
+		fmt.Fprint(out, p.render())
+
+		k, err := readKey(in)
+		if err != nil {
+			return err
+		}
+		if p.handle(k) {
+			fmt.Fprint(out, "\r\033[K")
+			return nil
+		}
+	}
+}
+
+// pager is the state of the built-in pager.
+type pager struct {
+	lines []string
+	// links maps link numbers to the line they are on.
+	links map[int]int
+	// matches are the lines with a search match on them, and match is the
+	// one last stepped to.
+	matches []int
+	match   int
+	rows    int
+	top     int
+	// num is a link number being typed.
+	num string
+	msg string
+	// help is the summary of keys shown when there's nothing else to say.
+	help string
+}
+
+func newPager(lines []string, height int) *pager {
+	p := &pager{
+		lines: lines,
+		links: make(map[int]int),
+		match: -1,
+		rows:  max(height-1, 1),
+		help:  pagerHelp,
+	}
+	for i, l := range lines {
+		if m := linkLineRe.FindStringSubmatch(l); m != nil {
+			no, _ := strconv.Atoi(m[1])
+			p.links[no] = i
+		}
+		if strings.Contains(l, highlight) {
+			p.matches = append(p.matches, i)
+		}
+	}
+	if len(p.matches) != 0 {
+		p.help += ", n/N match"
+	}
+	return p
+}
+
+// last is the top line of the last screen.
+func (p *pager) last() int {
+	return max(len(p.lines)-p.rows, 0)
+}
+
+// handle handles a keypress, reporting whether it quits the pager.
+func (p *pager) handle(k key) bool {
+	p.msg = ""
+	if k.kind == keyRune && !k.alt && k.r >= '0' && k.r <= '9' {
+		p.num += string(k.r)
+		return false
+	}
+	num := p.num
+	p.num = ""
+
+	switch k.kind {
+	case keyEscape:
+		return true
+	case keyPageDown:
+		p.top += p.rows
+	case keyPageUp:
+		p.top -= p.rows
+	case keyDown:
+		p.top++
+	case keyUp:
+		p.top--
+	case keyHome:
+		p.top = 0
+	case keyEnd:
+		p.top = p.last()
+	case keyRune:
+		switch k.r {
+		case 'q', 'Q', ctrlC:
+			return true
+		case ' ', 'f':
+			p.top += p.rows
+		case 'b':
+			p.top -= p.rows
+		case 'j':
+			p.top++
+		case 'k':
+			p.top--
+		case 'd':
+			p.top += p.rows / 2
+		case 'u':
+			p.top -= p.rows / 2
+		case 'g':
+			p.top = 0
+		case 'G':
+			p.top = p.last()
+		case 'n':
+			p.step(1)
+		case 'N':
+			p.step(-1)
+		case 'l', '\r', '\n':
+			if num == "" {
+				p.top++
+				break
+			}
+			no, _ := strconv.Atoi(num)
+			if i, ok := p.links[no]; ok {
+				p.top = i
+			} else {
+				p.msg = fmt.Sprintf("no link %d", no)
+			}
+		}
+	}
+	p.top = min(max(p.top, 0), p.last())
+	return false
+}
+
+// step scrolls to the next or previous search match, wrapping around at
+// either end like the shell's n and N.
+func (p *pager) step(step int) {
+	n := len(p.matches)
+	if n == 0 {
+		p.msg = "no search matches"
+		return
+	}
+	if p.match == -1 && step < 0 {
+		p.match = n - 1
+	} else {
+		p.match = ((p.match+step)%n + n) % n
+	}
+	p.top = p.matches[p.match]
+	p.msg = fmt.Sprintf("match %d/%d", p.match+1, n)
+}
+
+// prompt is the status line shown under the page.
+func (p *pager) prompt() string {
+	end := min(p.top+p.rows, len(p.lines))
+	pages := (len(p.lines) + p.rows - 1) / p.rows
+	percent := 100
+	if len(p.lines) > 0 {
+		percent = end * 100 / len(p.lines)
+	}
+
+	prompt := fmt.Sprintf(" lines %d-%d/%d %d%% page %d/%d ",
+		p.top+1, end, len(p.lines), percent, p.top/p.rows+1, pages)
+	switch {
+	case p.msg != "":
+		prompt += "(" + p.msg + ") "
+	case p.num != "":
+		prompt += "link " + p.num + " "
+	default:
+		prompt += "(" + p.help + ") "
+	}
+	return prompt
+}
+
+// render draws the whole screen.
+func (p *pager) render() string {
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+
+	end := min(p.top+p.rows, len(p.lines))
+	for _, l := range p.lines[p.top:end] {
+		b.WriteString(l + "\033[0m\r\n")
+	}
+	for range p.rows - (end - p.top) {
+		b.WriteString("~\r\n")
+	}
+	b.WriteString("\033[7m" + p.prompt() + "\033[27m")
+
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package interactive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/gemtxt"
+)
+
+// typePager feeds keys to p, reporting whether one of them quit it.
+func typePager(t *testing.T, p *pager, keys string) bool {
+	t.Helper()
+	in := bufio.NewReader(strings.NewReader(keys))
+	for {
+		k, err := readKey(in)
+		if err != nil {
+			return false
+		}
+		if p.handle(k) {
+			return true
+		}
+	}
+}
+
+func TestPagerLinks(t *testing.T) {
+	var body strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&body, "line %d\n", i)
+		if i%5 == 4 {
+			fmt.Fprintf(&body, "=> /%d link %d\n", i, i)
+		}
+	}
+	body.WriteString("=: /ask a prompt\n")
+	lines := strings.Split(strings.TrimSuffix(gemtxt.ColorWithLinkNosAndNoURLs(body.String()), "\n"), "\n")
+
+	p := newPager(lines, 5)
+	if len(p.links) != 5 {
+		t.Fatalf("got links %v", p.links)
+	}
+	for no, i := range p.links {
+		if !strings.Contains(lines[i], fmt.Sprintf("[%d]", no)) {
+			t.Errorf("link %d is on line %q", no, lines[i])
+		}
+	}
+
+	tests := []struct {
+		keys string
+		top  int
+		msg  string
+	}{
+		{keys: "1l", top: p.links[1]},
+		{keys: "2\r", top: p.links[2]},
+		// The last link is too far down to be at the top.
+		{keys: "4l", top: p.last()},
+		{keys: "9l", msg: "no link 9"},
+		{keys: "l", top: 1},
+		{keys: "jjk", top: 1},
+		{keys: " ", top: 4},
+		{keys: "  b", top: 4},
+		{keys: "G", top: p.last()},
+		{keys: "Gg", top: 0},
+		{keys: "\x1b[6~\x1b[6~\x1b[5~", top: 4},
+		{keys: "\x1b[F", top: p.last()},
+		{keys: "k", top: 0},
+	}
+	for _, tt := range tests {
+		p.top = 0
+		if typePager(t, p, tt.keys) {
+			t.Errorf("%q quit", tt.keys)
+		}
+		if p.top != tt.top || p.msg != tt.msg {
+			t.Errorf("%q: got top %d (%q), want %d (%q)", tt.keys, p.top, p.msg, tt.top, tt.msg)
+		}
+	}
+
+	for _, keys := range []string{"q", "Q", "\x03", "\x1b", "12q"} {
+		if !typePager(t, newPager(lines, 5), keys) {
+			t.Errorf("%q didn't quit", keys)
+		}
+	}
+}
+
+func TestPagerMatches(t *testing.T) {
+	var lines []string
+	for i := range 50 {
+		line := fmt.Sprintf("line %d", i)
+		if i%10 == 3 {
+			line = "a \033[7mmatch\033[27m on " + line
+		}
+		lines = append(lines, line)
+	}
+	p := newPager(lines, 11)
+	if len(p.matches) != 5 || !strings.HasSuffix(p.prompt(), ", n/N match) ") {
+		t.Fatalf("got matches %v and prompt %q", p.matches, p.prompt())
+	}
+
+	tests := []struct {
+		keys string
+		top  int
+		msg  string
+	}{
+		{keys: "n", top: 3, msg: "match 1/5"},
+		{keys: "nn", top: 13, msg: "match 2/5"},
+		{keys: "N", top: p.last(), msg: "match 5/5"},
+		{keys: "nnnnN", top: 23, msg: "match 3/5"},
+		// Wraps around to the first.
+		{keys: "nnnnnn", top: 3, msg: "match 1/5"},
+	}
+	for _, tt := range tests {
+		p.top, p.match = 0, -1
+		typePager(t, p, tt.keys)
+		if p.top != tt.top || p.msg != tt.msg {
+			t.Errorf("%q: got top %d (%q), want %d (%q)", tt.keys, p.top, p.msg, tt.top, tt.msg)
+		}
+	}
+
+	p = newPager(lines[:3], 11)
+	typePager(t, p, "n")
+	if p.msg != "no search matches" {
+		t.Errorf("got %q without a search", p.msg)
+	}
+}
+
+func TestPagerPrompt(t *testing.T) {
+	tests := []struct {
+		lines  int
+		height int
+		top    int
+		num    string
+		msg    string
+		want   string
+	}{
+		{lines: 100, height: 11, want: " lines 1-10/100 10% page 1/10 (q quit, space/b page, j/k line, g/G ends, [n]l link) "},
+		{lines: 100, height: 11, top: 90, want: " lines 91-100/100 100% page 10/10 (q quit, space/b page, j/k line, g/G ends, [n]l link) "},
+		{lines: 100, height: 11, top: 45, num: "12", want: " lines 46-55/100 55% page 5/10 link 12 "},
+		{lines: 30, height: 21, top: 10, msg: "no link 3", want: " lines 11-30/30 100% page 1/2 (no link 3) "},
+		{lines: 3, height: 11, want: " lines 1-3/3 100% page 1/1 (q quit, space/b page, j/k line, g/G ends, [n]l link) "},
+		{lines: 0, height: 11, want: " lines 1-0/0 100% page 1/0 (q quit, space/b page, j/k line, g/G ends, [n]l link) "},
+	}
+	for _, tt := range tests {
+		p := newPager(make([]string, tt.lines), tt.height)
+		p.top, p.num, p.msg = tt.top, tt.num, tt.msg
+		if got := p.prompt(); got != tt.want {
+			t.Errorf("%d lines from %d:\ngot  %q\nwant %q", tt.lines, tt.top, got, tt.want)
+		}
+	}
+}
+
+func TestRunPager(t *testing.T) {
+	text := "# Title\nsome text\n"
+
+	t.Setenv("PAGER", "cat")
+	var out bytes.Buffer
+	in := bufio.NewReader(strings.NewReader("q"))
+	err := runPager(in, &out, text, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != text {
+		t.Errorf("$PAGER got %q", out.String())
+	}
+	if _, err := in.Peek(1); err != nil {
+		t.Error("the built-in pager read the keys")
+	}
+
+	t.Setenv("PAGER", "")
+	out.Reset()
+	err = runPager(in, &out, text, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "some text\x1b[0m\r\n") || !strings.Contains(out.String(), " lines 1-2/2 ") {
+		t.Errorf("the built-in pager drew %q", out.String())
+	}
+	if _, err := in.Peek(1); err == nil {
+		t.Error("the built-in pager didn't read the keys")
+	}
+}
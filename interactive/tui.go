@@ -1,12 +1,248 @@
 package interactive
 
 import (
+	"bufio"
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
+	"github.com/krbreyn/gemcat/data"
+	"github.com/krbreyn/gemcat/shell"
+	"golang.org/x/term"
 )
 
+const tuiHelp = "q quit, [n]o open link, </> back/forward, / find, n/N match, : command"
+
+const tuiWelcome = "# gemcat\n\n" +
+	"Press : to run a shell command, like 'gt geminiprotocol.net', or :help to see them all.\n"
+
+// RunTUI shows pages full screen in the built-in pager, with keys to follow
+// links, go back and forth, search the page and run shell commands.
 func RunTUI(u *url.URL, isURL bool, loadLast bool) {
-	fmt.Println("not implemented!")
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Fprintln(os.Stderr, "err: the TUI needs a terminal")
+		os.Exit(1)
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	b := &browser.Browser{Conf: conf}
+	out := &tuiOutput{CLIOutput: CLIOutput{in: in, conf: &b.Conf}}
+	sh := shell.NewShell(out)
+	b.CertPrompt = sh.Out.ConfirmCertChange
+	b.InputPrompt = sh.Out.GetInput
+	b.OnWait = shell.WaitProgress(sh.Out)
+
+	err = sh.Source(b, shell.RCPath())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	if isURL && u.String() != b.S.CurrURL() {
+		err := shell.GotoCmd{}.Do(b, sh.Out, []string{u.String()})
+		if err != nil {
+			sh.Out.RecvError(err)
+			os.Exit(1)
+		}
+	}
+
+	history, err := data.LoadCmdHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	cmdEd := newLineEditor(
+		in,
+		history,
+		func(before string) (int, []shell.Completion) {
+			return sh.Complete(b, before)
+		},
+		func() bool {
+			return b.Conf.EditMode == config.EditModeVi
+		},
+	)
+	cmdEd.onHistory = func(line string) {
+		if err := data.AppendCmdHistory(line); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	t := &tui{
+		b:      b,
+		sh:     &sh,
+		out:    out,
+		in:     in,
+		fd:     fd,
+		cmdEd:  cmdEd,
+		findEd: newLineEditor(in, nil, nil, cmdEd.vi),
+	}
+	err = t.run()
+	fmt.Print("\033[H\033[2J")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	os.Exit(0)
 }
+
+// tuiOutput is the CLI's output, except that pages are left for the TUI to
+// show.
+type tuiOutput struct {
+	CLIOutput
+	gotPage bool
+}
+
+func (o *tuiOutput) RecvPage(page browser.Page) {
+	o.gotPage = true
+}
+
+type tui struct {
+	b   *browser.Browser
+	sh  *shell.Shell
+	out *tuiOutput
+	in  *bufio.Reader
+	fd  int
+	// cmdEd reads shell commands and findEd searches, which are kept out of
+	// the command history.
+	cmdEd  *lineEditor
+	findEd *lineEditor
+}
+
+func (t *tui) run() error {
+	oldState, err := term.MakeRaw(t.fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(t.fd, oldState)
+
+	p := t.view()
+	for {
+		fmt.Print(p.render())
+
+		k, err := readKey(t.in)
+		if err != nil {
+			return err
+		}
+		if k.kind != keyRune || k.alt {
+			p.handle(k)
+			continue
+		}
+
+		var quit bool
+		switch k.r {
+		case 'q', 'Q', ctrlC:
+			return nil
+		case 'o':
+			if p.num == "" {
+				p.msg = "type a link number before o"
+				continue
+			}
+			quit, err = t.command(oldState, "l "+p.num)
+		case '<':
+			quit, err = t.command(oldState, "b")
+		case '>':
+			quit, err = t.command(oldState, "f")
+		case ':':
+			line, ok := t.prompt(t.cmdEd, ":")
+			if !ok {
+				continue
+			}
+			quit, err = t.command(oldState, line)
+		case '/':
+			text, ok := t.prompt(t.findEd, "/")
+			if !ok {
+				continue
+			}
+			p = t.find(text)
+			continue
+		default:
+			p.handle(k)
+			continue
+		}
+		if err != nil || quit {
+			return err
+		}
+		p = t.view()
+	}
+}
+
+// view shows the current page from its top.
+func (t *tui) view() *pager {
+	width, height, err := term.GetSize(t.fd)
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	page := t.b.S.CurrPage()
+	if page.URL == "" {
+		page.Content = tuiWelcome
+	}
+	text := renderPage(page, width)
+
+	p := newPager(strings.Split(strings.TrimSuffix(text, "\n"), "\n"), height)
+	p.help = tuiHelp
+	return p
+}
+
+// prompt reads a line on the bottom row of the screen. ok is false if it
+// was cancelled with ctrl-d.
+func (t *tui) prompt(ed *lineEditor, prompt string) (string, bool) {
+	_, height, err := term.GetSize(t.fd)
+	if err != nil {
+		height = 24
+	}
+	fmt.Printf("\033[%d;1H\033[K", height)
+
+	line, err := ed.ReadLine(prompt)
+	return line, err == nil
+}
+
+// find searches the current page like the shell's find command, and shows
+// the first match.
+func (t *tui) find(text string) *pager {
+	rec := &shell.Recorder{}
+	err := shell.FindCmd{}.Do(t.b, rec, strings.Fields(text))
+
+	p := t.view()
+	switch {
+	case err != nil:
+		p.msg = err.Error()
+	case len(p.matches) == 0:
+		p.msg = "search cleared"
+	default:
+		p.step(1)
+	}
+	return p
+}
+
+// command runs a line of shell commands with the terminal back in cooked
+// mode, so that their output and any prompts look like the CLI's. If they
+// don't bring up a page, their output stays on screen until a key is
+// pressed. quit is true if the exit command was run.
+func (t *tui) command(cooked *term.State, line string) (quit bool, err error) {
+	err = term.Restore(t.fd, cooked)
+	if err != nil {
+		return false, err
+	}
+	fmt.Print("\033[H\033[2J")
+
+	t.out.gotPage = false
+	quit = t.sh.HandleLine(t.b, line)
+
+	_, err = term.MakeRaw(t.fd)
+	if err != nil || quit {
+		return quit, err
+	}
+	if !t.out.gotPage {
+		fmt.Print("\r\n\033[7m press any key to go back \033[27m")
+		_, err = readKey(t.in)
+	}
+	return false, err
+}
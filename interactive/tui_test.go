@@ -0,0 +1,48 @@
+package interactive
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/browser"
+)
+
+func TestTUIFind(t *testing.T) {
+	var body strings.Builder
+	for i := range 60 {
+		if i%20 == 10 {
+			body.WriteString("=> /x a needle in a link\n")
+		}
+		body.WriteString("hay\n")
+	}
+	b := &browser.Browser{}
+	b.S.Stack = []browser.Page{{URL: "gemini://example.org/", Content: body.String()}}
+	tu := &tui{b: b, fd: -1}
+
+	p := tu.find("needle")
+	if len(p.matches) != 3 || p.top != p.matches[0] || p.msg != "match 1/3" {
+		t.Fatalf("got matches %v at %d (%q)", p.matches, p.top, p.msg)
+	}
+	if !strings.Contains(p.lines[p.top], "needle") {
+		t.Errorf("the top line is %q", p.lines[p.top])
+	}
+	// Links are followed by a blank line, which the match lines allow for.
+	if want := []int{10, 32, 54}; !slices.Equal(p.matches, want) {
+		t.Errorf("got match lines %v, want %v", p.matches, want)
+	}
+
+	typePager(t, p, "n")
+	if p.top != p.matches[1] || p.msg != "match 2/3" {
+		t.Errorf("n went to %d (%q)", p.top, p.msg)
+	}
+
+	p = tu.find("nothing")
+	if len(p.matches) != 0 || p.msg != "no matches for 'nothing'" {
+		t.Errorf("got matches %v (%q)", p.matches, p.msg)
+	}
+	p = tu.find("")
+	if p.msg != "search cleared" || b.S.CurrPage().Find != nil {
+		t.Errorf("got %q", p.msg)
+	}
+}
@@ -0,0 +1,392 @@
+// Package linkcheck requests every link on a page, or on every page of a
+// capsule, and reports which of them are broken.
+package linkcheck
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/gemtxt"
+	"github.com/krbreyn/gemcat/robots"
+)
+
+// DefaultWorkers is how many links are checked at once unless told
+// otherwise.
+const DefaultWorkers = 8
+
+// Agent is the robots.txt user agent link checks go by. Link checkers have
+// no virtual agent of their own, so only the rules for every agent apply.
+const Agent = ""
+
+type Status string
+
+const (
+	// StatusOK is a link that works, including ones that ask for input or
+	// a client certificate.
+	StatusOK       Status = "ok"
+	StatusRedirect Status = "redirect"
+	// StatusTempFail is a 4x response.
+	StatusTempFail Status = "temporary failure"
+	// StatusPermFail is a 5x response.
+	StatusPermFail Status = "permanent failure"
+	// StatusTLS is a failed handshake or a certificate that didn't verify.
+	StatusTLS     Status = "tls error"
+	StatusTimeout Status = "timeout"
+	StatusError   Status = "error"
+	// StatusSkipped is a link that wasn't requested, because gemcat can't
+	// fetch its scheme, robots.txt doesn't allow it or it is a local link on
+	// a remote page.
+	StatusSkipped Status = "skipped"
+)
+
+// Broken reports whether the status is for a link that doesn't work.
+func (s Status) Broken() bool {
+	switch s {
+	case StatusOK, StatusRedirect, StatusSkipped:
+		return false
+	}
+	return true
+}
+
+type Result struct {
+	URL    string `json:"url"`
+	Status Status `json:"status"`
+	// Code is the response's status code, if there was one.
+	Code int `json:"code,omitempty"`
+	// Redirects are the URLs redirected to, in order.
+	Redirects []string `json:"redirects,omitempty"`
+	// Detail is the status meta or the error.
+	Detail string `json:"detail,omitempty"`
+	// From are the pages linking to the URL.
+	From []string `json:"from"`
+}
+
+type Report struct {
+	Start   string   `json:"start"`
+	Results []Result `json:"results"`
+}
+
+// Broken returns the results for broken links.
+func (r Report) Broken() []Result {
+	var broken []Result
+	for _, res := range r.Results {
+		if res.Status.Broken() {
+			broken = append(broken, res)
+		}
+	}
+	return broken
+}
+
+// BrokenError is returned by callers that fail when links are broken.
+type BrokenError struct {
+	Broken, Total int
+}
+
+func (e *BrokenError) Error() string {
+	return fmt.Sprintf("%d of %d links are broken", e.Broken, e.Total)
+}
+
+type Options struct {
+	// Crawl also checks the links of every page found under start's
+	// directory on its host, instead of just those of start.
+	Crawl bool
+	// Workers is how many links are checked at once.
+	Workers int
+	// Fetch fetches each URL. Defaults to browser.Fetch.
+	Fetch browser.HandlerFunc
+	Opts  browser.FetchOpts
+	// Robots is checked before each link is requested. Defaults to
+	// robots.Default.
+	Robots *robots.Cache
+	// Progress is told how many links are done out of how many are known.
+	Progress func(done, total int)
+}
+
+type checker struct {
+	o       Options
+	start   *url.URL
+	prefix  string
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	results map[string]*Result
+	done    int
+}
+
+// Run fetches start and checks every link on it, or with Crawl every link
+// on the pages under it. Links to the same URL are only requested once.
+// Results are sorted by URL.
+func Run(ctx context.Context, start *url.URL, o Options) (Report, error) {
+	if o.Fetch == nil {
+		o.Fetch = browser.Fetch
+	}
+	o.Robots = cmp.Or(o.Robots, robots.Default)
+	// A check is about what is there now, and nobody is around to answer
+	// prompts for input or about certificates.
+	o.Opts.NoCache = true
+	o.Opts.Input = nil
+	o.Opts.CertPrompt = nil
+
+	// Links to files would otherwise be kept in the downloads dir.
+	tmp, err := os.MkdirTemp("", "gemcat-check-")
+	if err != nil {
+		return Report{}, err
+	}
+	defer os.RemoveAll(tmp)
+	o.Opts.DownloadDir = tmp
+
+	start = browser.WithoutFragment(start)
+	report := Report{Start: start.String()}
+
+	resp, err := o.Fetch(ctx, start, o.Opts)
+	if err != nil {
+		return report, err
+	}
+	if !resp.IsGemtext() {
+		return report, fmt.Errorf("%s isn't a gemtext page", start)
+	}
+	base := start
+	if resp.URL != nil {
+		base = resp.URL
+	}
+
+	c := &checker{
+		o:       o,
+		start:   start,
+		prefix:  browser.ScopePrefix(start),
+		sem:     make(chan struct{}, cmp.Or(o.Workers, DefaultWorkers)),
+		results: map[string]*Result{start.String(): {URL: start.String(), Status: StatusOK}},
+	}
+	c.addLinks(ctx, base, resp.Body)
+	c.wg.Wait()
+
+	if ctx.Err() != nil {
+		return report, ctx.Err()
+	}
+
+	delete(c.results, start.String())
+	for _, res := range c.results {
+		report.Results = append(report.Results, *res)
+	}
+	slices.SortFunc(report.Results, func(a, b Result) int { return strings.Compare(a.URL, b.URL) })
+	return report, nil
+}
+
+// addLinks checks the links of a page that haven't been seen yet.
+func (c *checker) addLinks(ctx context.Context, base *url.URL, body string) {
+	from := base.String()
+	for _, l := range gemtxt.Parse(body) {
+		if l.Type != gemtxt.LinkLine {
+			continue
+		}
+		ref, err := url.Parse(l.URL)
+		if err != nil {
+			c.add(ctx, &Result{URL: l.URL, Status: StatusError, Detail: err.Error()}, from, nil)
+			continue
+		}
+		u := browser.WithoutFragment(base.ResolveReference(ref))
+		if local(u) && !local(base) {
+			// Otherwise a capsule could have us read and crawl our own files.
+			c.add(ctx, &Result{URL: u.String(), Status: StatusSkipped, Detail: "local link on a remote page"}, from, nil)
+			continue
+		}
+		c.add(ctx, &Result{URL: u.String()}, from, u)
+	}
+}
+
+// add checks res's URL in the background unless it is already known, in
+// which case from is just added to those linking to it.
+func (c *checker) add(ctx context.Context, res *Result, from string, u *url.URL) {
+	c.mu.Lock()
+	if known, ok := c.results[res.URL]; ok {
+		if !slices.Contains(known.From, from) {
+			known.From = append(known.From, from)
+		}
+		c.mu.Unlock()
+		return
+	}
+	res.From = []string{from}
+	c.results[res.URL] = res
+	c.progress()
+	c.mu.Unlock()
+
+	if u == nil {
+		c.finish()
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		page, base := c.check(ctx, u, res)
+		<-c.sem
+		c.finish()
+
+		if page != "" {
+			c.addLinks(ctx, base, page)
+		}
+	}()
+}
+
+func (c *checker) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done++
+	c.progress()
+}
+
+// progress must be called with mu held.
+func (c *checker) progress() {
+	if c.o.Progress != nil {
+		// The start page isn't counted.
+		c.o.Progress(c.done, len(c.results)-1)
+	}
+}
+
+// check requests u and fills in res. If the page should be crawled, its body
+// and the URL it came from are returned.
+func (c *checker) check(ctx context.Context, u *url.URL, res *Result) (string, *url.URL) {
+	if !c.o.Robots.Get(ctx, u, c.o.Opts).Allowed(u.Path, Agent) {
+		res.Status = StatusSkipped
+		res.Detail = "robots.txt doesn't allow it"
+		return "", nil
+	}
+
+	opts := c.o.Opts
+	var redirects []string
+	opts.OnRedirect = func(from, to *url.URL) {
+		redirects = append(redirects, to.String())
+	}
+	resp, err := c.o.Fetch(ctx, u, opts)
+	res.Redirects = redirects
+
+	if err != nil {
+		classify(res, err)
+		return "", nil
+	}
+
+	res.Code = statusCode(resp.Status)
+	res.Status = StatusOK
+	if len(redirects) != 0 {
+		res.Status = StatusRedirect
+	}
+
+	base := u
+	if resp.URL != nil {
+		base = resp.URL
+	}
+	if c.o.Crawl && c.inScope(base) && resp.IsGemtext() {
+		return resp.Body, base
+	}
+	return "", nil
+}
+
+// classify fills in res for a failed request.
+func classify(res *Result, err error) {
+	res.Detail = err.Error()
+
+	var serr *browser.StatusError
+	var uerr *browser.UnsupportedSchemeError
+	var cerr *browser.CertError
+	var alert tls.AlertError
+	var rerr tls.RecordHeaderError
+	var nerr net.Error
+	switch {
+	case errors.As(err, &serr):
+		res.Code = serr.Code
+		res.Detail = serr.Meta
+		switch serr.Code / 10 {
+		case 4:
+			res.Status = StatusTempFail
+		case 5:
+			res.Status = StatusPermFail
+		case 1, 6:
+			// The link leads somewhere, it just needs something from
+			// whoever follows it.
+			res.Status = StatusOK
+		default:
+			res.Status = StatusError
+		}
+	case errors.As(err, &uerr):
+		res.Status = StatusSkipped
+	case errors.As(err, &cerr), errors.As(err, &alert), errors.As(err, &rerr):
+		res.Status = StatusTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &nerr) && nerr.Timeout():
+		res.Status = StatusTimeout
+	default:
+		res.Status = StatusError
+	}
+}
+
+// local reports whether u is fetched without going over the network.
+func local(u *url.URL) bool {
+	return u.Scheme == "file" || u.Scheme == "about"
+}
+
+func (c *checker) inScope(u *url.URL) bool {
+	return u.Scheme == c.start.Scheme && u.Host == c.start.Host &&
+		strings.HasPrefix(u.Path, c.prefix) && u.RawQuery == ""
+}
+
+func statusCode(status string) int {
+	var code int
+	fmt.Sscan(status, &code)
+	return code
+}
+
+// Gemtext writes the report as a gemtext page, with broken links first.
+func (r Report) Gemtext() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Links of %s\n\n", r.Start)
+
+	broken := r.Broken()
+	fmt.Fprintf(&sb, "%d links checked, %d broken.\n", len(r.Results), len(broken))
+
+	section := func(title string, results []Result) {
+		if len(results) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n## %s\n\n", title)
+		for _, res := range results {
+			label := string(res.Status)
+			if res.Code != 0 {
+				label = fmt.Sprintf("%d %s", res.Code, label)
+			}
+			if res.Detail != "" {
+				label += ": " + res.Detail
+			}
+			fmt.Fprintf(&sb, "=> %s %s\n", res.URL, label)
+			for _, to := range res.Redirects {
+				fmt.Fprintf(&sb, "* redirects to %s\n", to)
+			}
+			for _, from := range res.From {
+				fmt.Fprintf(&sb, "* linked from %s\n", from)
+			}
+		}
+	}
+
+	section("Broken", broken)
+	var fine []Result
+	for _, res := range r.Results {
+		if !res.Status.Broken() {
+			fine = append(fine, res)
+		}
+	}
+	section("Working", fine)
+	return sb.String()
+}
@@ -0,0 +1,152 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func TestRun(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	secret := filepath.Join(t.TempDir(), "secret.gmi")
+	err := os.WriteFile(secret, []byte("# Secret\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Handle("/robots.txt", geminitest.Route{Status: 20, Meta: "text/plain", Body: "User-agent: *\nDisallow: /docs/private/\n"})
+	s.Page("/docs/", "# Docs\n"+
+		"=> a.gmi A\n"+
+		"=> a.gmi#top A again\n"+
+		"=> moved Moved\n"+
+		"=> missing.gmi Missing\n"+
+		"=> busy Busy\n"+
+		"=> slow Slow\n"+
+		"=> private/x.gmi Private\n"+
+		"=> search Search\n"+
+		"=> https://example.org/ Web\n"+
+		"=> file://"+secret+" Secret\n"+
+		"=> about:history History\n")
+	s.Page("/docs/a.gmi", "# A\n=> ./ Back\n=> b.gmi B\n")
+	s.Page("/docs/b.gmi", "# B\n=> gone.gmi Gone\n")
+	s.Redirect("/docs/moved", "/docs/moved2")
+	s.Redirect("/docs/moved2", "/docs/a.gmi")
+	s.Handle("/docs/busy", geminitest.Route{Status: 41, Meta: "server unavailable"})
+	s.Handle("/docs/slow", geminitest.Route{Status: 20, Meta: "text/gemini", Delay: time.Second})
+	s.Handle("/docs/search", geminitest.Route{Status: 10, Meta: "query"})
+	s.Handle("/docs/private/x.gmi", geminitest.Route{Status: 51, Meta: "not found"})
+
+	rel := func(u string) string { return strings.TrimPrefix(u, strings.TrimSuffix(s.URL("/"), "/")) }
+	opts := browser.FetchOpts{Timeout: 200 * time.Millisecond}
+	report, err := Run(context.Background(), mustParse(t, s.URL("/docs/")), Options{Opts: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Status{
+		"/docs/a.gmi":          StatusOK,
+		"/docs/moved":          StatusRedirect,
+		"/docs/missing.gmi":    StatusPermFail,
+		"/docs/busy":           StatusTempFail,
+		"/docs/slow":           StatusTimeout,
+		"/docs/private/x.gmi":  StatusSkipped,
+		"/docs/search":         StatusOK,
+		"https://example.org/": StatusSkipped,
+		"file://" + secret:     StatusSkipped,
+		"about:history":        StatusSkipped,
+	}
+	got := make(map[string]Status)
+	for _, res := range report.Results {
+		got[rel(res.URL)] = res.Status
+	}
+	if len(got) != len(want) {
+		t.Errorf("got results %v", got)
+	}
+	for u, status := range want {
+		if got[u] != status {
+			t.Errorf("%s: got %q, want %q", u, got[u], status)
+		}
+	}
+	if n := len(report.Broken()); n != 3 {
+		t.Errorf("got %d broken links, want 3", n)
+	}
+
+	for _, res := range report.Results {
+		switch rel(res.URL) {
+		case "/docs/moved":
+			if want := []string{s.URL("/docs/moved2"), s.URL("/docs/a.gmi")}; !slices.Equal(res.Redirects, want) {
+				t.Errorf("got redirects %q, want %q", res.Redirects, want)
+			}
+		case "file://" + secret:
+			if res.Code != 0 || res.Detail != "local link on a remote page" {
+				t.Errorf("the local link was fetched: %+v", res)
+			}
+		case "/docs/missing.gmi":
+			if res.Code != 51 || !slices.Equal(res.From, []string{s.URL("/docs/")}) {
+				t.Errorf("got %+v", res)
+			}
+		}
+	}
+
+	// Crawling also checks the links of the pages under the start page.
+	report, err = Run(context.Background(), mustParse(t, s.URL("/docs/")), Options{Opts: opts, Crawl: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, res := range report.Broken() {
+		urls = append(urls, rel(res.URL))
+	}
+	if want := []string{"/docs/busy", "/docs/gone.gmi", "/docs/missing.gmi", "/docs/slow"}; !slices.Equal(urls, want) {
+		t.Errorf("crawl got broken links %q, want %q", urls, want)
+	}
+
+	gmi := report.Gemtext()
+	if !strings.Contains(gmi, "=> "+s.URL("/docs/gone.gmi")+" 51 permanent failure: not found\n* linked from "+s.URL("/docs/b.gmi")) {
+		t.Errorf("gemtext report:\n%s", gmi)
+	}
+
+	_, err = Run(context.Background(), mustParse(t, s.URL("/nothing/")), Options{})
+	if err == nil {
+		t.Error("checking a missing page succeeded")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Status
+	}{
+		{&browser.StatusError{Code: 44, Meta: "10"}, StatusTempFail},
+		{&browser.StatusError{Code: 59, Meta: "bad request"}, StatusPermFail},
+		{&browser.StatusError{Code: 60}, StatusOK},
+		{&browser.CertError{Host: "example.org", Err: errors.New("[TOFU] Certificate mismatch")}, StatusTLS},
+		{&browser.UnsupportedSchemeError{Scheme: "mailto"}, StatusSkipped},
+		{context.DeadlineExceeded, StatusTimeout},
+		{errors.New("connection refused"), StatusError},
+	}
+	for _, tt := range tests {
+		var res Result
+		classify(&res, tt.err)
+		if res.Status != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.err, res.Status, tt.want)
+		}
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := browser.ParseURL(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
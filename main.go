@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
 	"github.com/krbreyn/gemcat/gemtxt"
 	"github.com/krbreyn/gemcat/interactive"
+	"github.com/krbreyn/gemcat/linkcheck"
+	"github.com/krbreyn/gemcat/shell"
 	"github.com/muesli/reflow/wordwrap"
 	"golang.org/x/term"
 )
@@ -19,11 +26,30 @@ func main() {
 	tuiMode := flag.Bool("t", false, "TUI mode")
 	loadLast := flag.Bool("ll", false, "Load last session")
 	help := flag.Bool("help", false, "Help")
+	cmds := flag.String("c", "", "Run the given shell commands and exit")
+	jsonOut := flag.Bool("json", false, "Print batch mode output as JSON, one object per line")
 
 	flag.Parse()
 	args := flag.Args()
 	argc := len(args)
 
+	if argc > 0 && !looksLikeURL(args[0]) {
+		switch args[0] {
+		case "cert":
+			runCert(args[1:])
+		case "feeds":
+			runFeeds(args[1:])
+		case "mirror":
+			runMirror(args[1:])
+		case "check":
+			runCheck(args[1:])
+		case "search":
+			runSearch(args[1:])
+		case "upload":
+			runUpload(args[1:])
+		}
+	}
+
 	if *tuiMode && *cliMode {
 		die("err: Pick only CLI mode or TUI mode!")
 	}
@@ -32,7 +58,16 @@ func main() {
 		die("err: '-ll' cannot be used outside of interactive mode!")
 	}
 
-	if argc == 0 && (!*cliMode && !*tuiMode) {
+	batch := *cmds != "" || (argc == 0 && !*cliMode && !*tuiMode && !term.IsTerminal(int(os.Stdin.Fd())))
+	if batch && (*cliMode || *tuiMode) {
+		die("err: '-c' cannot be used in interactive mode!")
+	}
+
+	if *jsonOut && !batch {
+		die("err: '-json' can only be used in batch mode!")
+	}
+
+	if argc == 0 && (!*cliMode && !*tuiMode && !batch) {
 		die("err: Must include URL if not using interactive mode!")
 	}
 
@@ -45,24 +80,45 @@ func main() {
 	if argc == 0 {
 		isURL = false
 	} else {
-		URL := args[0]
-		if !strings.HasPrefix(URL, "gemini://") {
-			URL = "gemini://" + URL
-		}
 		var err error
-		u, err = url.Parse(URL)
+		u, err = browser.ParseURL(args[0])
 		if err != nil {
 			die(err.Error())
 		}
 		isURL = true
 	}
 
+	if batch {
+		var in io.Reader = os.Stdin
+		if *cmds != "" {
+			in = strings.NewReader(*cmds)
+		}
+		os.Exit(interactive.RunBatch(in, u, isURL, *jsonOut))
+	}
+
 	if !*cliMode && !*tuiMode {
 		if !isURL {
 			die("err: must include URL if not using interactive mode")
 		}
 
-		_, body, err := browser.FetchGemini(u, true)
+		conf, err := config.Load()
+		if err != nil {
+			die(err.Error())
+		}
+
+		b := &browser.Browser{Conf: conf}
+		if !b.CanFetch(u) {
+			_, err := b.OpenExternal(u)
+			if err != nil {
+				die(err.Error())
+			}
+			os.Exit(0)
+		}
+
+		resp, err := browser.Fetch(context.Background(), u, browser.FetchOpts{
+			Policy:      conf.VerifyPolicy,
+			DownloadDir: conf.DownloadDir,
+		})
 		if err != nil {
 			die(err.Error())
 		}
@@ -72,7 +128,7 @@ func main() {
 			width = 80
 		}
 
-		fmt.Println(wordwrap.String(gemtxt.ColorPlain(body), width))
+		fmt.Println(wordwrap.String(gemtxt.ColorPlain(resp.Body), width))
 		os.Exit(0)
 	}
 
@@ -87,6 +143,148 @@ func main() {
 	}
 }
 
+// looksLikeURL reports whether arg is a URL, host or path rather than a
+// subcommand name. A host called e.g. "mirror" has to be given as
+// "mirror/" or "gemini://mirror" to be visited.
+func looksLikeURL(arg string) bool {
+	return strings.ContainsAny(arg, ".:/")
+}
+
+func runCert(args []string) {
+	cmds := map[string]shell.ShellCmd{
+		"list":   shell.CertListCmd{},
+		"show":   shell.CertShowCmd{},
+		"forget": shell.CertForgetCmd{},
+		"pin":    shell.CertPinCmd{},
+		"import": shell.CertImportCmd{},
+		"export": shell.CertExportCmd{},
+	}
+
+	if len(args) == 0 {
+		die("usage: gemcat cert list|show|forget|pin|import|export [args]")
+	}
+
+	cmd, ok := cmds[args[0]]
+	if !ok {
+		die(fmt.Sprintf("err: unknown cert command '%s'", args[0]))
+	}
+
+	err := cmd.Do(&browser.Browser{}, interactive.CLIOutput{}, args[1:])
+	if err != nil {
+		die("err: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+// runFeeds manages subscriptions from the command line, so that e.g.
+// "gemcat feeds refresh" can be run by cron.
+func runFeeds(args []string) {
+	if len(args) == 0 || !slices.Contains([]string{"add", "list", "rm", "refresh", "read"}, args[0]) {
+		die("usage: gemcat feeds add|list|rm|refresh|read [args]")
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		die(err.Error())
+	}
+
+	err = shell.SubCmd{}.Do(&browser.Browser{Conf: conf}, interactive.CLIOutput{}, args)
+	if err != nil {
+		die("err: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+func runMirror(args []string) {
+	if len(args) == 0 {
+		die("usage: gemcat mirror [-depth n] [-o dir] url")
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		die(err.Error())
+	}
+
+	err = shell.MirrorCmd{}.Do(&browser.Browser{Conf: conf}, interactive.CLIOutput{}, args)
+	if err != nil {
+		die("err: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+// runCheck exits with 1 if any links are broken, so that it can be used in
+// scripts. The report is kept alone on stdout so it can be piped.
+func runCheck(args []string) {
+	if len(args) == 0 {
+		die("usage: gemcat check [-crawl] [-format table|json|gemtext] url")
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		die(err.Error())
+	}
+
+	err = shell.CheckCmd{}.Do(&browser.Browser{Conf: conf}, checkOutput{}, args)
+	var berr *linkcheck.BrokenError
+	if errors.As(err, &berr) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err != nil {
+		die("err: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+func runSearch(args []string) {
+	if len(args) == 0 {
+		die("usage: gemcat search terms...")
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		die(err.Error())
+	}
+
+	err = shell.SearchCmd{}.Do(&browser.Browser{Conf: conf}, interactive.CLIOutput{}, args)
+	if err != nil {
+		die("err: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+// runUpload uploads over titan from the command line, e.g. from a pipe with
+// "gemcat upload titan://example.org/log.gmi -".
+func runUpload(args []string) {
+	if len(args) == 0 {
+		die("usage: gemcat upload [-mime type] [-token token] url [file|-]")
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		die(err.Error())
+	}
+
+	err = shell.UploadCmd{}.Do(&browser.Browser{Conf: conf}, interactive.CLIOutput{}, args)
+	if err != nil {
+		die("err: " + err.Error())
+	}
+	os.Exit(0)
+}
+
+// checkOutput prints statuses to stderr, leaving stdout to the report.
+type checkOutput struct {
+	interactive.CLIOutput
+}
+
+func (o checkOutput) RecvStatus(s shell.Status) {
+	if s.Kind == shell.StatusWarning {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", s.Msg)
+		return
+	}
+	fmt.Fprintln(os.Stderr, s.Msg)
+}
+
 func die(msg string) {
 	fmt.Println(msg)
 	os.Exit(1)
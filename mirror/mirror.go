@@ -0,0 +1,242 @@
+// Package mirror saves a capsule, or part of one, to disk so that it can be
+// browsed offline.
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/gemtxt"
+	"github.com/krbreyn/gemcat/robots"
+)
+
+// DefaultDepth is how many links deep a mirror goes unless told otherwise.
+const DefaultDepth = 5
+
+type Options struct {
+	// Dir is where the mirror is written. Defaults to the host's name.
+	Dir string
+	// Depth is how many links away from the start page are followed. 0
+	// mirrors just the start page, and a negative depth has no limit.
+	Depth int
+	// Fetch fetches each URL. Defaults to browser.Fetch.
+	Fetch browser.HandlerFunc
+	Opts  browser.FetchOpts
+	// Progress is told how many URLs are done out of how many are known.
+	Progress func(done, total int)
+	// Warn is told about URLs that couldn't be mirrored.
+	Warn func(err error)
+}
+
+type Stats struct {
+	Dir   string
+	Pages int
+	Files int
+	// Robots is how many URLs robots.txt kept out of the mirror.
+	Robots int
+	Failed int
+}
+
+// Agent is the robots.txt user agent mirrors go by.
+const Agent = robots.Archiver
+
+type job struct {
+	u     *url.URL
+	depth int
+}
+
+type page struct {
+	local string
+	base  *url.URL
+	body  string
+}
+
+// Run mirrors every page and file on start's host under start's directory,
+// which becomes the top of the mirror. Links between mirrored URLs are
+// rewritten to relative paths, and every other link is left as it is.
+func Run(ctx context.Context, start *url.URL, o Options) (Stats, error) {
+	if o.Fetch == nil {
+		o.Fetch = browser.Fetch
+	}
+	if o.Dir == "" {
+		o.Dir = start.Hostname()
+	}
+	// A mirror is a snapshot, so it shouldn't be made of old cached copies.
+	o.Opts.NoCache = true
+
+	stats := Stats{Dir: o.Dir}
+	prefix := browser.ScopePrefix(start)
+	inScope := func(u *url.URL) bool {
+		return u.Scheme == start.Scheme && u.Host == start.Host &&
+			strings.HasPrefix(u.Path, prefix) && u.RawQuery == ""
+	}
+
+	rules := robots.Default.Get(ctx, start, o.Opts)
+
+	start = browser.WithoutFragment(start)
+	queue := []job{{u: start}}
+	seen := map[string]bool{start.String(): true}
+	saved := make(map[string]string)
+	var pages []page
+
+	for done := 0; len(queue) != 0; done++ {
+		j := queue[0]
+		queue = queue[1:]
+		if o.Progress != nil {
+			o.Progress(done, done+len(queue)+1)
+		}
+
+		if !rules.Allowed(j.u.Path, Agent) {
+			if j.depth == 0 {
+				return stats, fmt.Errorf("robots.txt doesn't allow archiving %s", j.u)
+			}
+			stats.Robots++
+			continue
+		}
+
+		resp, err := o.Fetch(ctx, j.u, o.Opts)
+		if err == nil && resp.URL != nil && !inScope(resp.URL) {
+			err = fmt.Errorf("redirected out of the mirror to %s", resp.URL)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return stats, ctx.Err()
+			}
+			if j.depth == 0 {
+				return stats, err
+			}
+			stats.Failed++
+			if o.Warn != nil {
+				o.Warn(fmt.Errorf("%s: %w", j.u, err))
+			}
+			continue
+		}
+
+		base := j.u
+		if resp.URL != nil {
+			base = resp.URL
+		}
+
+		if !resp.IsGemtext() {
+			local := localPath(j.u, prefix, false)
+			err := write(o.Dir, local, resp.Body)
+			if err != nil {
+				return stats, err
+			}
+			saved[j.u.String()] = local
+			stats.Files++
+			continue
+		}
+
+		local := localPath(j.u, prefix, true)
+		saved[j.u.String()] = local
+		pages = append(pages, page{local: local, base: base, body: resp.Body})
+		stats.Pages++
+
+		if o.Depth >= 0 && j.depth >= o.Depth {
+			continue
+		}
+		for _, l := range gemtxt.Parse(resp.Body) {
+			if l.Type != gemtxt.LinkLine {
+				continue
+			}
+			u, err := resolve(base, l.URL)
+			if err != nil || !inScope(u) || seen[u.String()] {
+				continue
+			}
+			seen[u.String()] = true
+			queue = append(queue, job{u: u, depth: j.depth + 1})
+		}
+	}
+
+	for _, p := range pages {
+		err := write(o.Dir, p.local, rewrite(p, saved))
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	if o.Progress != nil {
+		n := len(seen)
+		o.Progress(n, n)
+	}
+	return stats, nil
+}
+
+func resolve(base *url.URL, link string) (*url.URL, error) {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	return browser.WithoutFragment(base.ResolveReference(ref)), nil
+}
+
+// localPath is where u is saved in the mirror of prefix, as a slash
+// separated path. Gemtext pages always end in .gmi, so directories get an
+// index.gmi and pages without an extension get one. That way the mirror can
+// be browsed as local files.
+func localPath(u *url.URL, prefix string, gemtext bool) string {
+	p := strings.TrimPrefix(u.Path, prefix)
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += browser.IndexFile
+		if !gemtext {
+			p = strings.TrimSuffix(p, ".gmi")
+		}
+	} else if gemtext && path.Ext(p) != ".gmi" && path.Ext(p) != ".gemini" {
+		p += ".gmi"
+	}
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// rewrite points the links of p that were mirrored at their local copies.
+func rewrite(p page, saved map[string]string) string {
+	var sb strings.Builder
+	for _, l := range gemtxt.Parse(p.body) {
+		if l.Type == gemtxt.LinkLine {
+			if link, ok := localLink(p, l.URL, saved); ok {
+				sb.WriteString("=> " + link)
+				if l.Label != "" {
+					sb.WriteString(" " + l.Label)
+				}
+				sb.WriteString("\n")
+				continue
+			}
+		}
+		sb.WriteString(l.Raw + "\n")
+	}
+	return sb.String()
+}
+
+func localLink(p page, link string, saved map[string]string) (string, bool) {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	target := p.base.ResolveReference(ref)
+	local, ok := saved[browser.WithoutFragment(target).String()]
+	if !ok {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(p.local)), filepath.FromSlash(local))
+	if err != nil {
+		return "", false
+	}
+	u := url.URL{Path: filepath.ToSlash(rel), Fragment: target.Fragment}
+	return u.String(), true
+}
+
+func write(dir, local, body string) error {
+	full := filepath.Join(dir, filepath.FromSlash(local))
+	err := os.MkdirAll(filepath.Dir(full), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(full, []byte(body), 0644)
+}
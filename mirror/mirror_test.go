@@ -0,0 +1,105 @@
+package mirror
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func TestRun(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Handle("/robots.txt", geminitest.Route{Status: 20, Meta: "text/plain", Body: "User-agent: archiver\nDisallow: /docs/private/\n"})
+	s.Page("/docs/", "# Docs\n"+
+		"=> a.gmi A\n"+
+		"=> sub/ Sub\n"+
+		"=> /other/ Outside\n"+
+		"=> private/x.gmi Private\n"+
+		"=> img.png Picture\n"+
+		"=> a.gmi#top A again\n"+
+		"=> gemini://example.org/ Elsewhere\n"+
+		"```\n=> a.gmi not a link\n```\n")
+	s.Page("/docs/a.gmi", "# A\n=> ./ Back\n=> missing.gmi Missing\n")
+	s.Page("/docs/sub/", "# Sub\n=> ../a.gmi\n=> deep Deep\n")
+	s.Page("/docs/sub/deep", "# Deep\n=> ../../docs/ Home\n")
+	s.Page("/docs/private/x.gmi", "# Private\n")
+	s.Handle("/docs/img.png", geminitest.Route{Status: 20, Meta: "image/png", Body: "\x89PNG"})
+
+	dir := t.TempDir()
+	var warnings []error
+	stats, err := Run(context.Background(), mustParse(t, s.URL("/docs/")), Options{
+		Dir:   dir,
+		Depth: -1,
+		Warn:  func(err error) { warnings = append(warnings, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{Dir: dir, Pages: 4, Files: 1, Robots: 1, Failed: 1}
+	if stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %v", warnings)
+	}
+
+	files := map[string]string{
+		"index.gmi": "# Docs\n" +
+			"=> a.gmi A\n" +
+			"=> sub/index.gmi Sub\n" +
+			"=> /other/ Outside\n" +
+			"=> private/x.gmi Private\n" +
+			"=> img.png Picture\n" +
+			"=> a.gmi#top A again\n" +
+			"=> gemini://example.org/ Elsewhere\n" +
+			"```\n=> a.gmi not a link\n```\n",
+		"a.gmi":         "# A\n=> index.gmi Back\n=> missing.gmi Missing\n",
+		"sub/index.gmi": "# Sub\n=> ../a.gmi\n=> deep.gmi Deep\n",
+		"sub/deep.gmi":  "# Deep\n=> ../index.gmi Home\n",
+		"img.png":       "\x89PNG",
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "private")); !os.IsNotExist(err) {
+		t.Errorf("a page robots.txt disallows was mirrored: %v", err)
+	}
+
+	dir = t.TempDir()
+	stats, err = Run(context.Background(), mustParse(t, s.URL("/docs/")), Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pages != 1 || stats.Files != 0 {
+		t.Errorf("a depth of 0 mirrored %+v", stats)
+	}
+
+	_, err = Run(context.Background(), mustParse(t, s.URL("/docs/private/x.gmi")), Options{Dir: t.TempDir()})
+	if err == nil {
+		t.Error("mirroring a disallowed page succeeded")
+	}
+	_, err = Run(context.Background(), mustParse(t, s.URL("/nothing/")), Options{Dir: t.TempDir()})
+	if err == nil {
+		t.Error("mirroring a missing page succeeded")
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := browser.ParseURL(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,187 @@
+// Package robots implements the robots.txt companion specification for
+// Gemini, which automated fetches like mirrors and feed refreshes honor.
+// Interactive browsing doesn't check it.
+package robots
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krbreyn/gemcat/browser"
+)
+
+// The virtual user agents of the companion spec. Bots go by the one that
+// describes what they do, and also obey the rules for every agent ("*").
+const (
+	Archiver   = "archiver"
+	Indexer    = "indexer"
+	Researcher = "researcher"
+	WebProxy   = "webproxy"
+)
+
+// Agents are the virtual user agents, in the order the spec lists them.
+var Agents = []string{Archiver, Indexer, Researcher, WebProxy}
+
+// Rules maps each user agent named in a robots.txt to the path prefixes it
+// is disallowed from.
+type Rules map[string][]string
+
+// Parse parses a robots.txt. Only User-agent and Disallow lines mean
+// anything in the companion spec, everything else is ignored.
+func Parse(body string) Rules {
+	rules := make(Rules)
+	var agents []string
+	inAgents := false
+
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A run of User-agent lines starts a group that they all share.
+			if !inAgents {
+				agents = nil
+			}
+			inAgents = true
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			if _, ok := rules[agent]; !ok {
+				rules[agent] = nil
+			}
+		case "disallow":
+			inAgents = false
+			if value == "" {
+				continue
+			}
+			for _, agent := range agents {
+				rules[agent] = append(rules[agent], value)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	return rules
+}
+
+// Allowed reports whether agent may fetch path. An empty agent only obeys
+// the rules for every agent.
+func (r Rules) Allowed(path, agent string) bool {
+	if path == "" {
+		path = "/"
+	}
+	for _, group := range []string{"*", strings.ToLower(agent)} {
+		if group == "" {
+			continue
+		}
+		for _, prefix := range r[group] {
+			if strings.HasPrefix(path, prefix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MaxAge is how long a host's robots.txt is kept before it is fetched again.
+const MaxAge = 24 * time.Hour
+
+type entry struct {
+	ready   chan struct{}
+	rules   Rules
+	fetched time.Time
+}
+
+// Cache keeps the robots.txt of each host it has been asked about.
+type Cache struct {
+	// Fetch fetches robots.txt files. Defaults to browser.FetchGemini.
+	Fetch browser.HandlerFunc
+
+	mu    sync.Mutex
+	hosts map[string]*entry
+}
+
+// Default is the cache shared by the whole process.
+var Default = &Cache{}
+
+// Get returns the rules of u's host, fetching its robots.txt if it isn't
+// cached. Hosts without one, or whose robots.txt can't be fetched, have no
+// rules. URLs that aren't gemini have none either.
+func (c *Cache) Get(ctx context.Context, u *url.URL, opts browser.FetchOpts) Rules {
+	if u.Scheme != "gemini" {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.hosts == nil {
+		c.hosts = make(map[string]*entry)
+	}
+	e, ok := c.hosts[u.Host]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Since(e.fetched) > MaxAge {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		e = &entry{ready: make(chan struct{})}
+		c.hosts[u.Host] = e
+		// Whoever else is waiting for it shouldn't lose out if ctx ends.
+		go c.fetch(context.WithoutCancel(ctx), u, opts, e)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.rules
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (c *Cache) fetch(ctx context.Context, u *url.URL, opts browser.FetchOpts, e *entry) {
+	defer close(e.ready)
+
+	fetch := c.Fetch
+	if fetch == nil {
+		fetch = browser.FetchGemini
+	}
+	// The disk cache is fine for robots.txt, and nobody is around to answer
+	// questions about it.
+	opts.NoCache = false
+	opts.Input = nil
+
+	robots := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	resp, err := fetch(ctx, &robots, opts)
+	e.fetched = time.Now()
+	if err != nil || !isText(resp.Status) {
+		return
+	}
+	e.rules = Parse(resp.Body)
+}
+
+// isText reports whether a status is for a text file. Cached responses
+// don't keep their mime type, so those are taken as text.
+func isText(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) < 2 || !strings.Contains(fields[1], "/") || strings.HasPrefix(fields[1], "text/")
+}
+
+// Allowed reports whether agent may fetch u, going by Default.
+func Allowed(ctx context.Context, u *url.URL, agent string, opts browser.FetchOpts) bool {
+	return Default.Get(ctx, u, opts).Allowed(u.Path, agent)
+}
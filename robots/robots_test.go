@@ -0,0 +1,100 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/krbreyn/gemcat/browser"
+)
+
+func TestParse(t *testing.T) {
+	rules := Parse("# comment\n" +
+		"User-agent: indexer\n" +
+		"User-agent: Archiver\n" +
+		"Disallow: /private/ # not for archives\n" +
+		"\n" +
+		"User-agent: *\n" +
+		"Disallow: /cgi-bin/\n" +
+		"Disallow:\n" +
+		"\n" +
+		"User-agent: webproxy\n" +
+		"Disallow: /\n")
+
+	tests := []struct {
+		agent, path string
+		want        bool
+	}{
+		{Archiver, "/private/a.gmi", false},
+		{Indexer, "/private/a.gmi", false},
+		{Researcher, "/private/a.gmi", true},
+		{Archiver, "/public/a.gmi", true},
+		{Researcher, "/cgi-bin/x", false},
+		{WebProxy, "/public/a.gmi", false},
+		{WebProxy, "", false},
+		{"", "/private/a.gmi", true},
+		{"", "/cgi-bin/x", false},
+	}
+	for _, tt := range tests {
+		if got := rules.Allowed(tt.path, tt.agent); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.path, tt.agent, got, tt.want)
+		}
+	}
+
+	var none Rules
+	if !none.Allowed("/", Archiver) {
+		t.Error("no rules should allow everything")
+	}
+}
+
+func TestCache(t *testing.T) {
+	var calls atomic.Int32
+	c := &Cache{Fetch: func(ctx context.Context, u *url.URL, opts browser.FetchOpts) (browser.Response, error) {
+		calls.Add(1)
+		if u.Path != "/robots.txt" {
+			t.Errorf("fetched %s", u)
+		}
+		switch u.Host {
+		case "down.org":
+			return browser.Response{}, errors.New("connection refused")
+		case "image.org":
+			return browser.Response{Status: "20 image/png", Body: "User-agent: *\nDisallow: /\n"}, nil
+		}
+		return browser.Response{Status: "20 text/plain", Body: "User-agent: *\nDisallow: /private/\n"}, nil
+	}}
+	ctx := context.Background()
+	parse := func(s string) *url.URL {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c.Get(ctx, parse("gemini://example.org/a.gmi"), browser.FetchOpts{}).Allowed("/private/", "") {
+				t.Error("robots.txt wasn't obeyed")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", n)
+	}
+
+	for _, u := range []string{"gemini://down.org/private/", "gemini://image.org/private/", "gopher://example.org/private/"} {
+		if !c.Get(ctx, parse(u), browser.FetchOpts{}).Allowed("/private/", Archiver) {
+			t.Errorf("%s should be allowed", u)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("fetched %d times, want 3", n)
+	}
+}
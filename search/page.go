@@ -0,0 +1,161 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/data"
+	"github.com/krbreyn/gemcat/gemtxt"
+)
+
+func init() {
+	browser.RegisterAbout("search", func(ctx context.Context, u *url.URL) (string, error) {
+		query, err := url.QueryUnescape(u.RawQuery)
+		if err != nil {
+			return "", err
+		}
+		ix, err := Load()
+		if err != nil {
+			return "", err
+		}
+		err = ix.Update()
+		if err != nil {
+			return "", err
+		}
+		err = ix.Save()
+		if err != nil {
+			return "", err
+		}
+		return Page(ix, query), nil
+	})
+}
+
+// PageURL is the search page for query.
+func PageURL(query string) string {
+	return "about:search?" + url.QueryEscape(query)
+}
+
+// MaxHits is how many results the search page shows.
+const MaxHits = 50
+
+// Page makes the search page for query, with a line of each result that has
+// the query's terms in it, if the page is still cached.
+func Page(ix *Index, query string) string {
+	var sb strings.Builder
+	if strings.TrimSpace(query) == "" {
+		sb.WriteString("# Search\n\n")
+		fmt.Fprintf(&sb, "%d pages are indexed. Search them with 'search [terms]'.\n", len(ix.Docs))
+		return sb.String()
+	}
+
+	hits := ix.Search(query)
+	fmt.Fprintf(&sb, "# Search: %s\n\n", query)
+	if len(hits) == 0 {
+		fmt.Fprintf(&sb, "Nothing found in %d pages.\n", len(ix.Docs))
+		return sb.String()
+	}
+	if len(hits) > MaxHits {
+		fmt.Fprintf(&sb, "The best %d of %d results from %d pages.\n", MaxHits, len(hits), len(ix.Docs))
+		hits = hits[:MaxHits]
+	} else {
+		fmt.Fprintf(&sb, "%d results from %d pages.\n", len(hits), len(ix.Docs))
+	}
+
+	terms := Tokenize(query)
+	for _, h := range hits {
+		label := h.Title
+		if label == "" {
+			label = h.URL
+		}
+		fmt.Fprintf(&sb, "\n=> %s %s\n", h.URL, label)
+		if line := snippet(h.URL, terms); line != "" {
+			fmt.Fprintf(&sb, "> %s\n", line)
+		}
+	}
+	return sb.String()
+}
+
+// snippetLen is about how long a snippet can get before it is cut short.
+const snippetLen = 100
+
+// snippet finds the first line of a cached page with one of terms in it,
+// other than the title.
+func snippet(raw string, terms []string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	content, err := data.LoadFromCache(u)
+	if err != nil {
+		return ""
+	}
+
+	for _, l := range gemtxt.Parse(string(content)) {
+		if l.Type == gemtxt.HeadingLine || l.Type == gemtxt.PreToggleLine {
+			continue
+		}
+		text := l.Text
+		if l.Type == gemtxt.LinkLine || l.Type == gemtxt.PromptLine {
+			text = l.Label
+		}
+		if !slices.ContainsFunc(Tokenize(text), func(t string) bool { return slices.Contains(terms, t) }) {
+			continue
+		}
+		text = strings.TrimSpace(text)
+		if len(text) > snippetLen {
+			cut := strings.LastIndex(text[:snippetLen], " ")
+			if cut <= 0 {
+				cut = snippetLen
+				for !utf8.RuneStart(text[cut]) {
+					cut--
+				}
+			}
+			text = strings.TrimSpace(text[:cut]) + "..."
+		}
+		return text
+	}
+	return ""
+}
+
+// visit is a line of the log of visits the index has yet to take in.
+type visit struct {
+	URL  string `json:"url"`
+	Body string `json:"body"`
+}
+
+// Indexable reports whether pages of a mime type are worth indexing.
+func Indexable(mime string) bool {
+	return mime == "text/gemini" || mime == "text/plain"
+}
+
+// MaxVisitsLog is how big the log of visits can get before the index
+// takes it in, so that it doesn't grow for as long as about:search isn't
+// visited.
+var MaxVisitsLog int64 = 1 << 20
+
+// Visited notes a page that was just visited, so that it can be found
+// whether or not it stays in the cache. Rewriting the whole index on every
+// visit would be slow, so visits are logged and the index takes them in the
+// next time it is loaded, or once the log passes MaxVisitsLog.
+func Visited(u *url.URL, body string) error {
+	line, err := json.Marshal(visit{URL: u.String(), Body: body})
+	if err != nil {
+		return err
+	}
+	size, err := data.AppendSearchVisit(line)
+	if err != nil || size <= MaxVisitsLog {
+		return err
+	}
+
+	ix, err := Load()
+	if err != nil {
+		return err
+	}
+	return ix.Save()
+}
@@ -0,0 +1,279 @@
+// Package search keeps a full-text index of the pages gemcat has cached or
+// visited, and makes the about:search page out of it.
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/krbreyn/gemcat/data"
+	"github.com/krbreyn/gemcat/gemtxt"
+)
+
+// HeadingBoost is how many times more a term counts in a heading than in
+// the rest of a page.
+const HeadingBoost = 5
+
+type Doc struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Path is the doc's file in the cache, see data.NormalizeGemPath.
+	Path    string    `json:"path"`
+	Indexed time.Time `json:"indexed"`
+	// Visited docs stay in the index when they leave the cache.
+	Visited bool `json:"visited,omitempty"`
+	// Len is the weighted number of terms in the doc.
+	Len   int      `json:"len"`
+	Terms []string `json:"terms"`
+}
+
+type Index struct {
+	NextID int          `json:"next_id"`
+	Docs   map[int]*Doc `json:"docs"`
+	// Postings maps each term to its weighted count in each doc it is in.
+	Postings map[string]map[int]int `json:"postings"`
+
+	byURL map[string]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		Docs:     make(map[int]*Doc),
+		Postings: make(map[string]map[int]int),
+		byURL:    make(map[string]int),
+	}
+}
+
+func Load() (*Index, error) {
+	content, err := data.LoadSearchIndexFile()
+	if err != nil {
+		return nil, err
+	}
+	ix := NewIndex()
+	if content != nil {
+		err = json.Unmarshal(content, ix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse search index: %w", err)
+		}
+		for id, d := range ix.Docs {
+			ix.byURL[d.URL] = id
+		}
+	}
+
+	visits, err := data.LoadSearchVisitsFile()
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range bytes.Split(visits, []byte("\n")) {
+		var v visit
+		// A line cut short by a crash is skipped.
+		if json.Unmarshal(line, &v) != nil {
+			continue
+		}
+		u, err := url.Parse(v.URL)
+		if err != nil {
+			continue
+		}
+		ix.Add(u, v.Body, true)
+	}
+	return ix, nil
+}
+
+// Save writes the index, which then has every visit logged so far.
+func (ix *Index) Save() error {
+	content, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	err = data.SaveSearchIndexFile(content)
+	if err != nil {
+		return err
+	}
+	return data.ClearSearchVisitsFile()
+}
+
+// Tokenize splits text into lowercase terms. Single characters are too
+// common to be worth indexing.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return slices.DeleteFunc(words, func(w string) bool { return utf8.RuneCountInString(w) < 2 })
+}
+
+// Add indexes a gemtext page, replacing whatever was indexed for u before.
+// Link labels are indexed but not their URLs.
+func (ix *Index) Add(u *url.URL, body string, visited bool) {
+	key := u.String()
+	if id, ok := ix.byURL[key]; ok {
+		visited = visited || ix.Docs[id].Visited
+		ix.remove(id)
+	}
+
+	d := &Doc{URL: key, Path: data.NormalizeGemPath(u), Indexed: time.Now(), Visited: visited}
+	counts := make(map[string]int)
+	for _, l := range gemtxt.Parse(body) {
+		text, weight := l.Text, 1
+		switch l.Type {
+		case gemtxt.HeadingLine:
+			text = strings.TrimSpace(strings.TrimLeft(l.Raw, "#"))
+			weight = HeadingBoost
+			if d.Title == "" {
+				d.Title = text
+			}
+		case gemtxt.LinkLine, gemtxt.PromptLine:
+			text = l.Label
+		case gemtxt.PreToggleLine:
+			continue
+		}
+		for _, term := range Tokenize(text) {
+			counts[term] += weight
+			d.Len += weight
+		}
+	}
+
+	id := ix.NextID
+	ix.NextID++
+	for term, n := range counts {
+		if ix.Postings[term] == nil {
+			ix.Postings[term] = make(map[int]int)
+		}
+		ix.Postings[term][id] = n
+		d.Terms = append(d.Terms, term)
+	}
+	slices.Sort(d.Terms)
+	ix.Docs[id] = d
+	ix.byURL[key] = id
+}
+
+func (ix *Index) remove(id int) {
+	d := ix.Docs[id]
+	for _, term := range d.Terms {
+		delete(ix.Postings[term], id)
+		if len(ix.Postings[term]) == 0 {
+			delete(ix.Postings, term)
+		}
+	}
+	delete(ix.Docs, id)
+	delete(ix.byURL, d.URL)
+}
+
+// Update brings the index up to date with the cache, indexing the pages
+// cached since they were last indexed and dropping the ones that aren't
+// cached anymore, unless they were visited.
+func (ix *Index) Update() error {
+	files, err := data.CachedFiles()
+	if err != nil {
+		return err
+	}
+
+	byPath := make(map[string]*Doc, len(ix.Docs))
+	for _, d := range ix.Docs {
+		byPath[d.Path] = d
+	}
+	cached := make(map[string]bool, len(files))
+
+	for _, f := range files {
+		if !isText(f.Path) {
+			continue
+		}
+		cached[f.Path] = true
+
+		u := f.URL
+		if d, ok := byPath[f.Path]; ok {
+			if !f.ModTime.After(d.Indexed) {
+				continue
+			}
+			// A visit knows the page's real URL, which the cache path
+			// doesn't always say.
+			u, err = url.Parse(d.URL)
+			if err != nil {
+				return err
+			}
+		}
+
+		content, err := data.LoadFromCache(u)
+		if err != nil || !utf8.Valid(content) {
+			continue
+		}
+		ix.Add(u, string(content), false)
+	}
+
+	for id, d := range ix.Docs {
+		if !d.Visited && !cached[d.Path] {
+			ix.remove(id)
+		}
+	}
+	return nil
+}
+
+// isText reports whether a cached file looks like it is text, going by its
+// extension. Pages without one are cached with .gmi on the end.
+func isText(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gmi", ".gemini", ".txt", ".md":
+		return true
+	}
+	return false
+}
+
+type Hit struct {
+	Doc
+	Score float64
+}
+
+// Search returns the docs with every term of the query, best first. Terms
+// are weighted by how rare they are across the index and how much of the
+// doc they make up, so headings count for more.
+func (ix *Index) Search(query string) []Hit {
+	terms := slices.Compact(slices.Sorted(slices.Values(Tokenize(query))))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	scores := make(map[int]float64)
+	for i, term := range terms {
+		postings := ix.Postings[term]
+		if len(postings) == 0 {
+			return nil
+		}
+		idf := math.Log(1 + float64(len(ix.Docs))/float64(len(postings)))
+		for id, n := range postings {
+			if _, ok := scores[id]; !ok && i != 0 {
+				continue
+			}
+			d := ix.Docs[id]
+			scores[id] += idf * float64(n) / float64(n+d.Len/100+1)
+		}
+		// Docs without this term are out.
+		for id := range scores {
+			if _, ok := postings[id]; !ok {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{Doc: *ix.Docs[id], Score: score})
+	}
+	slices.SortFunc(hits, func(a, b Hit) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.URL, b.URL)
+	})
+	return hits
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/krbreyn/gemcat/data"
+)
+
+func setTestDirs(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	data.SetAppDir(dir)
+	t.Cleanup(func() { data.SetAppDir("") })
+	return dir
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func hitURLs(hits []Hit) []string {
+	var urls []string
+	for _, h := range hits {
+		urls = append(urls, h.URL)
+	}
+	return urls
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("# Gemini's Über-cool *capsule*, v2 & a x")
+	want := []string{"gemini", "über", "cool", "capsule", "v2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix := NewIndex()
+	ix.Add(mustParse(t, "gemini://a.org/"), "# Gardening\nThis page talks about tomatoes.\n", false)
+	ix.Add(mustParse(t, "gemini://b.org/"), "# Tomatoes\nAll about tomatoes and gardening.\n", false)
+	ix.Add(mustParse(t, "gemini://c.org/"), "# Cooking\n=> gemini://tomatoes.org/ Recipes\n```\n```\n", false)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// The heading counts for more.
+		{"tomatoes", []string{"gemini://b.org/", "gemini://a.org/"}},
+		{"gardening", []string{"gemini://a.org/", "gemini://b.org/"}},
+		{"Tomatoes GARDENING", []string{"gemini://b.org/", "gemini://a.org/"}},
+		{"recipes", []string{"gemini://c.org/"}},
+		{"tomatoes cooking", nil},
+		{"nothing", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := hitURLs(ix.Search(tt.query)); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	// Adding a page again replaces it.
+	ix.Add(mustParse(t, "gemini://a.org/"), "# Moved\n", false)
+	if got := hitURLs(ix.Search("tomatoes")); !slices.Equal(got, []string{"gemini://b.org/"}) {
+		t.Errorf("got %q after re-adding", got)
+	}
+	if _, ok := ix.Postings["gardening"][0]; ok {
+		t.Error("old postings were kept")
+	}
+	if ix.Docs[3].Title != "Moved" {
+		t.Errorf("got title %q", ix.Docs[3].Title)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir := setTestDirs(t)
+	cache := func(raw, body string) {
+		err := data.CacheGemFile(mustParse(t, raw), []byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache("gemini://a.org/", "# Home\nWelcome to my capsule.\n")
+	cache("gemini://a.org/log/post", "# A post\nAbout my capsule.\n")
+	cache("gemini://a.org/image.png", "capsule")
+	cache("gopher://b.org/1/", "Capsule or hole?\n")
+
+	ix, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Visited(mustParse(t, "gemini://a.org/log/post"), "# A post\nAbout my capsule.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Visits are logged rather than rewriting the index each time.
+	if content, err := data.LoadSearchIndexFile(); err != nil || content != nil {
+		t.Errorf("a visit wrote the index: %q, %v", content, err)
+	}
+	ix, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ix.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"gemini://a.org/", "gemini://a.org/log/post", "gopher://b.org/1/"}
+	got := hitURLs(ix.Search("capsule"))
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Pages that leave the cache are dropped, unless they were visited.
+	os.RemoveAll(filepath.Join(dir, "gemcache"))
+	err = ix.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitURLs(ix.Search("capsule")); !slices.Equal(got, []string{"gemini://a.org/log/post"}) {
+		t.Errorf("got %q after clearing the cache", got)
+	}
+
+	err = ix.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visits, _ := data.LoadSearchVisitsFile(); visits != nil {
+		t.Errorf("saving kept the visits log: %q", visits)
+	}
+	ix, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.Search("capsule")) != 1 {
+		t.Error("the saved index lost its docs")
+	}
+}
+
+func TestVisitsLogLimit(t *testing.T) {
+	setTestDirs(t)
+	limit := MaxVisitsLog
+	MaxVisitsLog = 200
+	t.Cleanup(func() { MaxVisitsLog = limit })
+
+	body := "# Tomatoes\n" + strings.Repeat("growing tomatoes ", 5) + "\n"
+	for _, u := range []string{"gemini://a.org/1", "gemini://a.org/2"} {
+		err := Visited(mustParse(t, u), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first visit fits in the log, and the second pushes it past the
+	// limit, so the index takes both in.
+	if visits, err := data.LoadSearchVisitsFile(); err != nil || visits != nil {
+		t.Errorf("the visits log was kept: %q, %v", visits, err)
+	}
+	content, err := data.LoadSearchIndexFile()
+	if err != nil || content == nil {
+		t.Fatalf("the index wasn't saved: %v", err)
+	}
+
+	err = Visited(mustParse(t, "gemini://a.org/3"), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitURLs(ix.Search("tomatoes")); len(got) != 3 {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestPage(t *testing.T) {
+	setTestDirs(t)
+	u := mustParse(t, "gemini://a.org/")
+	body := "# Gardening\n" + strings.Repeat("words ", 30) + "about tomatoes\n"
+	err := data.CacheGemFile(u, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := NewIndex()
+	ix.Add(u, body, false)
+
+	want := "# Search: tomatoes\n\n1 results from 1 pages.\n\n" +
+		"=> gemini://a.org/ Gardening\n" +
+		"> " + strings.TrimSpace(strings.Repeat("words ", 16)) + "...\n"
+	if got := Page(ix, "tomatoes"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Page(ix, "nope"); !strings.Contains(got, "Nothing found in 1 pages.") {
+		t.Errorf("got:\n%s", got)
+	}
+	if got := PageURL("two words"); got != "about:search?two+words" {
+		t.Errorf("got url %s", got)
+	}
+}
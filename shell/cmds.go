@@ -1,15 +1,30 @@
 package shell
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"net/url"
 	"os"
+	"os/exec"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
+	"github.com/krbreyn/gemcat/feeds"
+	"github.com/krbreyn/gemcat/gemtxt"
+	"github.com/krbreyn/gemcat/linkcheck"
+	"github.com/krbreyn/gemcat/mirror"
+	"github.com/krbreyn/gemcat/search"
+	"github.com/krbreyn/gemcat/tofu"
 )
 
 func NeedsOneNum(args []string) (int, error) {
@@ -42,19 +57,80 @@ func NeedsTwoNums(args []string) (int, int, error) {
 }
 
 func NormalizeRelativeLink(link string, b *browser.Browser) (string, error) {
-	if !strings.Contains(link, "://") && !strings.HasPrefix(link, "gemini://") {
-		if !strings.HasPrefix(link, "/") {
-			link = strings.TrimPrefix(b.S.CurrURL(), "/") + "/" + link
-		} else {
-			u, err := url.Parse(b.S.CurrURL())
-			if err != nil {
-				return "", err
-			}
-			u.Path = ""
-			link = strings.TrimPrefix(u.String(), "/") + link
+	base, err := url.Parse(b.S.CurrURL())
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// connecting tells out that a request to u is about to be made.
+func connecting(out ShellOut, u *url.URL) {
+	out.RecvStatus(Status{
+		Kind: StatusConnecting,
+		Msg:  fmt.Sprintf("connecting to %s...", u),
+		URL:  u.String(),
+	})
+}
+
+// visit goes to u and shows it, or hands it to an external program if it
+// isn't something gemcat can fetch.
+func visit(b *browser.Browser, out ShellOut, u *url.URL) error {
+	if !b.CanFetch(u) {
+		command, err := b.OpenExternal(u)
+		if err != nil {
+			return err
+		}
+		out.RecvStatus(Status{
+			Kind: StatusInfo,
+			Msg:  fmt.Sprintf("opened %s with %s", u, command),
+			URL:  u.String(),
+		})
+		return nil
+	}
+
+	connecting(out, u)
+	err := b.GotoURL(u, true)
+	if err != nil {
+		return err
+	}
+
+	// Reading an entry, wherever it was opened from, takes it off the
+	// feeds page.
+	for _, read := range slices.Compact([]string{u.String(), b.S.CurrURL()}) {
+		err = feeds.MarkRead(read)
+		if err != nil {
+			out.RecvStatus(Status{Kind: StatusWarning, Msg: err.Error()})
+			break
+		}
+	}
+
+	// Generated pages are made fresh each time, so only those from
+	// somewhere else are worth finding again.
+	page := b.S.CurrPage()
+	if pu, err := url.Parse(page.URL); err == nil && pu.Scheme != "about" && search.Indexable(page.Mime) {
+		err = search.Visited(pu, page.Content)
+		if err != nil {
+			out.RecvStatus(Status{Kind: StatusWarning, Msg: err.Error()})
 		}
 	}
-	return link, nil
+
+	out.RecvPage(page)
+	return nil
+}
+
+// indexedTable makes a table of urls numbered by their index, like the
+// history and bookmarks.
+func indexedTable(urls []string) Table {
+	table := Table{Header: []string{"#", "url"}}
+	for i, u := range urls {
+		table.Rows = append(table.Rows, Row{Cells: []string{strconv.Itoa(i), u}})
+	}
+	return table
 }
 
 type (
@@ -91,18 +167,45 @@ type (
 	BookmarkClearAllCmd   struct{}
 	BookmarkGotoCmd       struct{}
 
+	CertListCmd   struct{}
+	CertShowCmd   struct{}
+	CertForgetCmd struct{}
+	CertPinCmd    struct{}
+	CertImportCmd struct{}
+	CertExportCmd struct{}
+	VerifyCmd     struct{}
+	TLSInfoCmd    struct{}
+
+	FindCmd     struct{}
+	FindNextCmd struct{}
+	FindPrevCmd struct{}
+
+	SubCmd   struct{}
+	FeedsCmd struct{}
+
+	MirrorCmd struct{}
+	CheckCmd  struct{}
+	SearchCmd struct{}
+
+	UploadCmd struct{}
+	EditCmd   struct{}
+
 	RefreshCmd      struct{} // TODO
 	ReprintCmd      struct{}
+	PagerCmd        struct{}
+	EditModeCmd     struct{}
+	OpenerCmd       struct{}
+	AliasCmd        struct{}
+	UnaliasCmd      struct{}
 	CloseCurrentCmd struct{} // TODO
 	CacheListCmd    struct{} // TODO
 	JustCatCmd      struct{} // TODO
 )
 
 func (_ ExitCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
-	out.RecvMsg("Goodbye!")
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: "Goodbye!"})
 	//data.SaveDataFile
-	os.Exit(0)
-	return nil
+	return ErrExit
 }
 func (_ ExitCmd) Help() HelpInfo {
 	return HelpInfo{
@@ -130,29 +233,20 @@ func (_ GotoCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 	if len(args) == 0 {
 		return errors.New("must include a link)")
 	}
-	link := args[0]
-	if !strings.HasPrefix(link, "gemini://") {
-		link = "gemini://" + link
-	}
-
-	u, err := url.Parse(link)
-	if err != nil {
-		return err
-	}
-
-	out.RecvMsg(fmt.Sprintln("connecting to", u, "..."))
-	err = b.GotoURL(u, true)
+	u, err := browser.ParseURL(args[0])
 	if err != nil {
 		return err
 	}
 
-	out.RecvPage(b.S.CurrPage())
-	return nil
+	return visit(b, out, u)
 }
 func (_ GotoCmd) Help() HelpInfo {
 	return HelpInfo{
 		Words: []string{"goto", "gt"},
-		Desc:  "Open and goto a gemini link.\n\tUsage: gt [link]",
+		Desc: "Open and goto a link. Links without a scheme are gemini, paths starting with /, ./, ../\n" +
+			"\tor ~/ are local files, and schemes gemcat can't fetch are opened with an external\n" +
+			"\tprogram, see 'opener'.\n" +
+			"\tUsage: gt [link]",
 	}
 }
 
@@ -195,7 +289,12 @@ func (_ LinkCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 		return err
 	}
 
-	out.RecvMsg(b.S.CurrPage().Links[i].URL)
+	p := b.S.CurrPage()
+	if i >= len(p.Links) || i < 0 {
+		return errors.New("invalid link number")
+	}
+
+	out.RecvMsg(p.Links[i].URL)
 	return nil
 }
 func (_ LinkCmd) Help() HelpInfo {
@@ -214,9 +313,7 @@ func (_ LinksCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 	if len(links) == 0 {
 		return errors.New("there are no links on the current page")
 	} else {
-		for _, l := range links {
-			fmt.Println(l.No, l.URL)
-		}
+		out.RecvLinks(links)
 	}
 	return nil
 }
@@ -253,8 +350,7 @@ func (_ LinkGotoCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 		return errors.New("invalid link number")
 	}
 
-	link := p.Links[i].URL
-	link, err = NormalizeRelativeLink(link, b)
+	link, err := NormalizeRelativeLink(p.Links[i].URL, b)
 	if err != nil {
 		return err
 	}
@@ -264,20 +360,22 @@ func (_ LinkGotoCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 		return err
 	}
 
-	out.RecvMsg(fmt.Sprintf("connecting to %s...", link))
-	err = b.GotoURL(u, true)
-	if err != nil {
-		return err
+	if p.Links[i].Prompt {
+		prompt := cmp.Or(p.Links[i].Label, "input") + ": "
+		input, ok := out.GetInput(prompt)
+		if !ok {
+			return errors.New("input cancelled")
+		}
+		u.RawQuery = url.QueryEscape(input)
 	}
 
-	out.RecvPage(b.S.CurrPage())
-	return nil
+	return visit(b, out, u)
 }
 
 func (_ LinkGotoCmd) Help() HelpInfo {
 	return HelpInfo{
 		Words: []string{"lgoto", "lgt"},
-		Desc:  "Goto the specified link number on the current page.\n\tUsage: lg [i]",
+		Desc:  "Goto the specified link number on the current page. Links that ask for\n\tinput, like spartan's =: lines, ask for it first and send it along.\n\tUsage: lg [i]",
 	}
 }
 
@@ -289,13 +387,14 @@ func (_ StackCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 		return errors.New("stack is empty")
 	}
 
+	table := Table{Header: []string{"#", "url"}}
 	for i, p := range b.S.Stack {
-		if i == b.S.Pos {
-			out.RecvMsg(fmt.Sprintf("-> %d %s", i, p.URL))
-		} else {
-			out.RecvMsg(fmt.Sprintf("%d %s", i, p.URL))
-		}
+		table.Rows = append(table.Rows, Row{
+			Cells:   []string{strconv.Itoa(i), p.URL},
+			Current: i == b.S.Pos,
+		})
 	}
+	out.RecvTable(table)
 	return nil
 }
 func (_ StackCmd) Help() HelpInfo {
@@ -318,7 +417,7 @@ func (_ StackPosCmd) Help() HelpInfo {
 
 // TODO
 func (_ StackRmCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
-	out.RecvMsg("Not implemented!")
+	out.RecvStatus(Status{Kind: StatusWarning, Msg: "Not implemented!"})
 	return nil
 }
 func (_ StackRmCmd) Help() HelpInfo {
@@ -331,7 +430,7 @@ func (_ StackRmCmd) Help() HelpInfo {
 func (_ StackCloseCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 	old := len(b.S.Stack)
 	b.S.Stack = b.S.Stack[:b.S.Pos+1]
-	out.RecvMsg(fmt.Sprintf("closed %d pages", old-len(b.S.Stack)))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("closed %d pages", old-len(b.S.Stack))})
 	return nil
 }
 func (_ StackCloseCmd) Help() HelpInfo {
@@ -345,7 +444,7 @@ func (_ StackCompressCmd) Do(b *browser.Browser, out ShellOut, args []string) er
 	old := len(b.S.Stack)
 	b.S.Stack = b.S.Stack[b.S.Pos:]
 	b.S.Pos = 0
-	out.RecvMsg(fmt.Sprintf("closed %d pages", old-len(b.S.Stack)))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("closed %d pages", old-len(b.S.Stack))})
 	return nil
 }
 func (_ StackCompressCmd) Help() HelpInfo {
@@ -359,7 +458,7 @@ func (_ StackEmptyCmd) Do(b *browser.Browser, out ShellOut, args []string) error
 	l := len(b.S.Stack)
 	b.S.Stack = b.S.Stack[:0]
 	b.S.Pos = 0
-	out.RecvMsg(fmt.Sprintf("closed %d pages", l))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("closed %d pages", l)})
 	return nil
 }
 func (_ StackEmptyCmd) Help() HelpInfo {
@@ -398,9 +497,7 @@ func (_ HistoryCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 		return errors.New("history is empty")
 	}
 
-	for i, h := range b.D.History {
-		out.RecvMsg(fmt.Sprintf("%d %s", i, h))
-	}
+	out.RecvTable(indexedTable(b.D.History))
 	return nil
 }
 func (_ HistoryCmd) Help() HelpInfo {
@@ -421,7 +518,7 @@ func (_ HistoryRmCmd) Do(b *browser.Browser, out ShellOut, args []string) error
 	}
 
 	removedURL := b.D.History[i]
-	out.RecvMsg(fmt.Sprintf("deleting %s...", removedURL))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("deleting %s...", removedURL)})
 	b.D.History = slices.Delete(b.D.History, i, i+1)
 	return nil
 }
@@ -435,7 +532,7 @@ func (_ HistoryRmCmd) Help() HelpInfo {
 func (_ HistoryClearAllCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 	l := len(b.D.History)
 	b.D.History = b.D.History[:0]
-	out.RecvMsg(fmt.Sprintf("deleted %d bookmarks", l))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("deleted %d history items", l)})
 	return nil
 }
 func (_ HistoryClearAllCmd) Help() HelpInfo {
@@ -459,13 +556,7 @@ func (_ HistoryGotoCmd) Do(b *browser.Browser, out ShellOut, args []string) erro
 	if err != nil {
 		return err
 	}
-	err = b.GotoURL(u, true)
-	if err != nil {
-		return err
-	}
-
-	out.RecvPage(b.S.CurrPage())
-	return nil
+	return visit(b, out, u)
 }
 func (_ HistoryGotoCmd) Help() HelpInfo {
 	return HelpInfo{
@@ -482,9 +573,7 @@ func (_ BookmarksCmd) Do(b *browser.Browser, out ShellOut, args []string) error
 		return errors.New("bookmarks is empty")
 	}
 
-	for i, b := range b.D.Bookmarks {
-		out.RecvMsg(fmt.Sprintf("%d %s", i, b))
-	}
+	out.RecvTable(indexedTable(b.D.Bookmarks))
 	return nil
 }
 func (_ BookmarksCmd) Help() HelpInfo {
@@ -505,7 +594,7 @@ func (_ BookmarkRmCmd) Do(b *browser.Browser, out ShellOut, args []string) error
 	}
 
 	removedURL := b.D.Bookmarks[i]
-	out.RecvMsg(fmt.Sprintf("deleting %s ...", removedURL))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("deleting %s ...", removedURL)})
 	b.D.Bookmarks = slices.Delete(b.D.Bookmarks, i, i+1)
 	return nil
 }
@@ -538,7 +627,7 @@ func (_ BookmarkAddLinkCmd) Do(b *browser.Browser, out ShellOut, args []string)
 	}
 
 	b.D.Bookmarks = append(b.D.Bookmarks, link)
-	out.RecvMsg(fmt.Sprintf("added %s to bookmarks", link))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("added %s to bookmarks", link)})
 	return nil
 }
 func (_ BookmarkAddLinkCmd) Help() HelpInfo {
@@ -557,7 +646,7 @@ func (_ BookmarkAddCurrentCmd) Do(b *browser.Browser, out ShellOut, args []strin
 		return errors.New("bookmarks already contains this url")
 	}
 	b.D.Bookmarks = append(b.D.Bookmarks, url)
-	out.RecvMsg(fmt.Sprintf("added %s to bookmarks", url))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("added %s to bookmarks", url)})
 	return nil
 }
 func (_ BookmarkAddCurrentCmd) Help() HelpInfo {
@@ -582,7 +671,7 @@ func (_ BookmarkSwapCmd) Do(b *browser.Browser, out ShellOut, args []string) err
 	temp := b.D.Bookmarks[i1]
 	b.D.Bookmarks[i1] = b.D.Bookmarks[i2]
 	b.D.Bookmarks[i2] = temp
-	out.RecvMsg(fmt.Sprintf("swapped %d and %d", i1, i2))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("swapped %d and %d", i1, i2)})
 	return nil
 }
 func (_ BookmarkSwapCmd) Help() HelpInfo {
@@ -595,7 +684,7 @@ func (_ BookmarkSwapCmd) Help() HelpInfo {
 func (_ BookmarkClearAllCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
 	l := len(b.D.Bookmarks)
 	b.D.Bookmarks = b.D.Bookmarks[:0]
-	out.RecvMsg(fmt.Sprintf("deleted %d bookmarks", l))
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("deleted %d bookmarks", l)})
 	return nil
 }
 func (_ BookmarkClearAllCmd) Help() HelpInfo {
@@ -620,12 +709,7 @@ func (_ BookmarkGotoCmd) Do(b *browser.Browser, out ShellOut, args []string) err
 		return err
 	}
 
-	err = b.GotoURL(u, true)
-	if err != nil {
-		return err
-	}
-	out.RecvPage(b.S.CurrPage())
-	return nil
+	return visit(b, out, u)
 }
 func (_ BookmarkGotoCmd) Help() HelpInfo {
 	return HelpInfo{
@@ -636,15 +720,1219 @@ func (_ BookmarkGotoCmd) Help() HelpInfo {
 
 // Bookmarks End
 
-// Misc
-func (_ ReprintCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
-	out.RecvPage(b.S.CurrPage())
+// Certs
+func certHost(args []string) (tofu.Host, error) {
+	if len(args) == 0 {
+		return tofu.Host{}, errors.New("must include a host")
+	}
+
+	hosts, err := tofu.LoadKnownHosts()
+	if err != nil {
+		return tofu.Host{}, err
+	}
+
+	if i, err := strconv.Atoi(args[0]); err == nil {
+		if i < 0 || i > len(hosts)-1 {
+			return tofu.Host{}, errors.New("host number is out of range")
+		}
+		return hosts[i], nil
+	}
+
+	h, ok := hosts.Get(args[0])
+	if !ok {
+		return tofu.Host{}, fmt.Errorf("%s is not a known host", args[0])
+	}
+	return h, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format(time.DateTime)
+}
+
+func (_ CertListCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	hosts, err := tofu.LoadKnownHosts()
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		return errors.New("no hosts are trusted yet")
+	}
+
+	table := Table{Header: []string{"#", "host", "fingerprint", "expires"}}
+	for i, h := range hosts {
+		table.Rows = append(table.Rows, Row{
+			Cells: []string{strconv.Itoa(i), h.Name, h.Fingerprint, formatTime(h.Expiry)},
+		})
+	}
+	out.RecvTable(table)
 	return nil
 }
-func (_ ReprintCmd) Help() HelpInfo {
+func (_ CertListCmd) Help() HelpInfo {
 	return HelpInfo{
-		Words: []string{"reprint", "rp"},
-		Desc:  "Reprint the current page's contents.",
+		Words: []string{"certls"},
+		Desc:  "List the hosts whose certificates you trust.",
+	}
+}
+
+func (_ CertShowCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	h, err := certHost(args)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "host:        %s\n", h.Name)
+	fmt.Fprintf(&sb, "fingerprint: %s\n", h.Fingerprint)
+	if h.Cert == nil {
+		sb.WriteString("certificate: pinned, not yet seen\n")
+	} else {
+		sans := slices.Clone(h.Cert.DNSNames)
+		for _, ip := range h.Cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		fmt.Fprintf(&sb, "subject:     %s\n", h.Cert.Subject)
+		fmt.Fprintf(&sb, "SANs:        %s\n", strings.Join(sans, ", "))
+		fmt.Fprintf(&sb, "valid:       %s to %s\n",
+			formatTime(h.Cert.NotBefore), formatTime(h.Cert.NotAfter))
+	}
+	fmt.Fprintf(&sb, "first seen:  %s", formatTime(h.FirstSeen))
+
+	out.RecvMsg(sb.String())
+	return nil
+}
+func (_ CertShowCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"certshow"},
+		Desc:  "Show the trusted certificate for a host.\n\tUsage: certshow [host|i]",
+	}
+}
+
+func (_ CertForgetCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	h, err := certHost(args)
+	if err != nil {
+		return err
+	}
+
+	err = tofu.Forget(h.Name)
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("forgot %s", h.Name)})
+	return nil
+}
+func (_ CertForgetCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"certrm", "certforget"},
+		Desc:  "Forget a host's certificate so the next one is trusted on first use.\n\tUsage: certrm [host|i]",
+	}
+}
+
+func (_ CertPinCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) != 2 {
+		return errors.New("must include a host and a fingerprint")
+	}
+
+	err := tofu.Pin(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("pinned %s", args[0])})
+	return nil
+}
+func (_ CertPinCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"certpin"},
+		Desc:  "Trust a SHA-256 certificate fingerprint for a host.\n\tUsage: certpin [host] [fingerprint]",
+	}
+}
+
+func (_ CertImportCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) == 0 {
+		return errors.New("must include a file")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := tofu.Import(f)
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("imported %d hosts", n)})
+	return nil
+}
+func (_ CertImportCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"certimp"},
+		Desc:  "Import trusted hosts from a known hosts file.\n\tUsage: certimp [file]",
+	}
+}
+
+func (_ CertExportCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) == 0 {
+		var sb strings.Builder
+		err := tofu.Export(&sb)
+		if err != nil {
+			return err
+		}
+		out.RecvMsg(strings.TrimSuffix(sb.String(), "\n"))
+		return nil
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = tofu.Export(f)
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("exported trusted hosts to %s", args[0])})
+	return nil
+}
+func (_ CertExportCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"certexp"},
+		Desc:  "Export your trusted hosts, printing them if no file is given.\n\tUsage: certexp [file]",
+	}
+}
+
+func (_ VerifyCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	table := Table{Header: []string{"host", "policy"}}
+	switch len(args) {
+	case 0:
+		table.Rows = append(table.Rows, Row{Cells: []string{"*", b.Conf.VerifyPolicy("").String()}})
+		for _, host := range slices.Sorted(maps.Keys(b.Conf.Verify)) {
+			table.Rows = append(table.Rows, Row{Cells: []string{host, b.Conf.Verify[host]}})
+		}
+		out.RecvTable(table)
+		return nil
+	case 1:
+		table.Rows = append(table.Rows, Row{Cells: []string{args[0], b.Conf.VerifyPolicy(args[0]).String()}})
+		out.RecvTable(table)
+		return nil
+	}
+
+	host, policy := args[0], args[1]
+	if policy == "rm" {
+		if host == "*" {
+			b.Conf.DefaultVerify = ""
+		} else {
+			delete(b.Conf.Verify, host)
+		}
+	} else {
+		p, err := tofu.ParsePolicy(policy)
+		if err != nil {
+			return err
+		}
+		if host == "*" {
+			b.Conf.DefaultVerify = p.String()
+		} else {
+			if b.Conf.Verify == nil {
+				b.Conf.Verify = make(map[string]string)
+			}
+			b.Conf.Verify[host] = p.String()
+		}
+	}
+
+	err := b.Conf.Save()
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("%s %s", host, b.Conf.VerifyPolicy(host))})
+	return nil
+}
+func (_ VerifyCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"verify", "vfy"},
+		Desc: "Show or set how certificates are verified, per host or for all hosts with '*'.\n" +
+			"\tPolicies are tofu, spki and ca, and can be combined like ca+spki.\n" +
+			"\tUsage: vfy [host|*] [policy|rm]",
+	}
+}
+
+func (_ TLSInfoCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	p := b.S.CurrPage()
+	if p.URL == "" {
+		return errors.New("you have no current page")
+	}
+	if p.TLS == nil {
+		return errors.New("the current page was not fetched over TLS, it may be cached")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "version:     %s\n", p.TLS.Version)
+	fmt.Fprintf(&sb, "cipher:      %s\n", p.TLS.CipherSuite)
+	fmt.Fprintf(&sb, "verified by: %s", p.TLS.Policy)
+	for i, cert := range p.TLS.Certs {
+		fmt.Fprintf(&sb, "\ncert %d:\n", i)
+		fmt.Fprintf(&sb, "  subject:     %s\n", cert.Subject)
+		fmt.Fprintf(&sb, "  issuer:      %s\n", cert.Issuer)
+		fmt.Fprintf(&sb, "  fingerprint: %s\n", tofu.CertFingerprint(cert))
+		fmt.Fprintf(&sb, "  spki:        %s\n", tofu.SPKIFingerprint(cert))
+		fmt.Fprintf(&sb, "  valid:       %s to %s",
+			formatTime(cert.NotBefore), formatTime(cert.NotAfter))
+	}
+
+	out.RecvMsg(sb.String())
+	return nil
+}
+func (_ TLSInfoCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"tls"},
+		Desc:  "Show the TLS session details and certificates of the current page.",
+	}
+}
+
+// Certs End
+
+// Find
+func formatMatch(body string, m gemtxt.Match, context int) string {
+	var sb strings.Builder
+
+	start, lines := gemtxt.Context(body, m.LineNo, context)
+	for i, text := range lines {
+		no := start + i
+		if no != m.LineNo {
+			fmt.Fprintf(&sb, "%d- %s\n", no, text)
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%d: %s", no, text)
+		if m.LinkNo != -1 {
+			fmt.Fprintf(&sb, "  (link %d)", m.LinkNo)
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (_ FindCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	p := b.S.CurrPage()
+	if p.URL == "" {
+		return errors.New("you have no current page")
+	}
+
+	if len(args) == 0 {
+		b.S.Stack[b.S.Pos].Find = nil
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: "search cleared"})
+		return nil
+	}
+
+	isRegex := false
+	if args[0] == "-r" {
+		isRegex = true
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("must include something to search for")
+	}
+
+	pattern := strings.Join(args, " ")
+	re, err := gemtxt.CompileSearch(pattern, isRegex)
+	if err != nil {
+		return err
+	}
+
+	matches := gemtxt.Find(p.Content, re)
+	if len(matches) == 0 {
+		b.S.Stack[b.S.Pos].Find = nil
+		return fmt.Errorf("no matches for '%s'", pattern)
+	}
+
+	b.S.Stack[b.S.Pos].Find = &browser.Find{
+		Pattern: re,
+		Matches: matches,
+		Pos:     -1,
+	}
+
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("%d matching lines for '%s'", len(matches), pattern)})
+	for i, m := range matches {
+		if i != 0 {
+			out.RecvMsg("--")
+		}
+		out.RecvMsg(formatMatch(p.Content, m, 1))
+	}
+	return nil
+}
+func (_ FindCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"find", "/"},
+		Desc: "Search the current page and highlight the matches when it is next printed.\n" +
+			"\tPlain searches ignore case unless they contain uppercase letters, -r searches by regex.\n" +
+			"\tGive no search to clear it.\n" +
+			"\tUsage: find [-r] [text], /[text]",
+	}
+}
+
+func stepFind(b *browser.Browser, out ShellOut, step int) error {
+	p := b.S.CurrPage()
+	if p.Find == nil {
+		return errors.New("no active search, use 'find' first")
+	}
+
+	f := p.Find
+	n := len(f.Matches)
+	if f.Pos == -1 && step < 0 {
+		f.Pos = n - 1
+	} else {
+		f.Pos = ((f.Pos+step)%n + n) % n
+	}
+
+	m := f.Matches[f.Pos]
+	out.RecvMsg(fmt.Sprintf("match %d/%d\n%s", f.Pos+1, n, formatMatch(p.Content, m, 1)))
+	return nil
+}
+
+func (_ FindNextCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	return stepFind(b, out, 1)
+}
+func (_ FindNextCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"n"},
+		Desc:  "Show the next match of the current search.",
+	}
+}
+
+func (_ FindPrevCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	return stepFind(b, out, -1)
+}
+func (_ FindPrevCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"N"},
+		Desc:  "Show the previous match of the current search.",
+	}
+}
+
+// Find End
+
+// Feeds
+
+// subIndex finds the sub args[0] names by number or url.
+func subIndex(subs feeds.Subs, args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("must include a subscription number or url")
+	}
+
+	if i, err := strconv.Atoi(args[0]); err == nil {
+		if i < 0 || i > len(subs)-1 {
+			return 0, errors.New("subscription number is out of range")
+		}
+		return i, nil
+	}
+
+	u, err := browser.ParseURL(args[0])
+	if err != nil {
+		return 0, err
+	}
+	i := subs.Index(u.String())
+	if i == -1 {
+		return 0, fmt.Errorf("not subscribed to %s", u)
+	}
+	return i, nil
+}
+
+// newRefresher makes a refresher configured by b's config that reports its
+// progress to out.
+func newRefresher(b *browser.Browser, out ShellOut) *feeds.Refresher {
+	opts := b.FetchOpts()
+	// Nobody is around to answer a search prompt in the middle of a refresh,
+	// and the refresher does its own retrying.
+	opts.Input = nil
+	opts.OnWait = nil
+	opts.SlowDownRetries = 0
+	opts.MaxWait = 0
+	opts.Delay = b.Conf.PoliteDelay()
+	return &feeds.Refresher{
+		Fetch:   b.Fetch,
+		Opts:    opts,
+		Workers: b.Conf.FeedWorkers,
+		PerHost: b.Conf.FeedHostLimit,
+		MaxAge:  time.Duration(b.Conf.FeedMaxAge) * time.Minute,
+		Progress: func(done, total int, s *feeds.Sub) {
+			out.RecvProgress(Progress{Label: "refreshing", Done: done, Total: total})
+		},
+	}
+}
+
+func (_ SubCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	subs, err := feeds.LoadSubs()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "add":
+		var u *url.URL
+		if len(args) > 1 {
+			u, err = browser.ParseURL(args[1])
+		} else if b.S.CurrURL() != "" {
+			u, err = url.Parse(b.S.CurrURL())
+		} else {
+			return errors.New("must include a url or be on a page")
+		}
+		if err != nil {
+			return err
+		}
+		if subs.Index(u.String()) != -1 {
+			return fmt.Errorf("already subscribed to %s", u)
+		}
+
+		connecting(out, u)
+		s, err := feeds.New(context.Background(), b.Fetch, b.FetchOpts(), u)
+		if err != nil {
+			return err
+		}
+		err = feeds.SaveSubs(append(subs, s))
+		if err != nil {
+			return err
+		}
+		out.RecvStatus(Status{
+			Kind: StatusInfo,
+			Msg:  fmt.Sprintf("subscribed to %s (%s)", s.Name(), s.Kind),
+			URL:  s.URL,
+		})
+		return nil
+
+	case "list", "ls":
+		if len(subs) == 0 {
+			return errors.New("no subscriptions yet")
+		}
+		table := Table{Header: []string{"#", "kind", "unread", "updated", "title", "url"}}
+		for i, s := range subs {
+			updated := formatTime(s.Updated)
+			if s.Err != "" {
+				updated = "failed"
+			}
+			table.Rows = append(table.Rows, Row{Cells: []string{
+				strconv.Itoa(i), string(s.Kind), strconv.Itoa(s.Unread()), updated, s.Title, s.URL,
+			}})
+		}
+		out.RecvTable(table)
+		return nil
+
+	case "rm":
+		i, err := subIndex(subs, args[1:])
+		if err != nil {
+			return err
+		}
+		s := subs[i]
+		err = feeds.SaveSubs(slices.Delete(subs, i, i+1))
+		if err != nil {
+			return err
+		}
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("unsubscribed from %s", s.Name()), URL: s.URL})
+		return nil
+
+	case "refresh":
+		var which []int
+		if len(args) > 1 {
+			i, err := subIndex(subs, args[1:])
+			if err != nil {
+				return err
+			}
+			which = append(which, i)
+		}
+		if len(subs) == 0 {
+			return errors.New("no subscriptions yet")
+		}
+
+		n := len(which)
+		if n == 0 {
+			n = len(subs)
+		}
+
+		before := 0
+		for _, s := range subs {
+			before += s.Unread()
+		}
+		out.RecvProgress(Progress{Label: "refreshing", Total: n})
+		refreshErr := newRefresher(b, out).Refresh(context.Background(), subs, which...)
+		after := 0
+		for _, s := range subs {
+			after += s.Unread()
+		}
+
+		err := feeds.SaveSubs(subs)
+		if err != nil {
+			return err
+		}
+		out.RecvStatus(Status{
+			Kind: StatusInfo,
+			Msg:  fmt.Sprintf("refreshed %d subscriptions, %d new entries", n, max(after-before, 0)),
+		})
+		return refreshErr
+
+	case "read":
+		todo := subs
+		if len(args) > 1 && args[1] != "all" {
+			i, err := subIndex(subs, args[1:])
+			if err != nil {
+				return err
+			}
+			todo = subs[i : i+1]
+		}
+		n := 0
+		for i := range todo {
+			for j := range todo[i].Entries {
+				if !todo[i].Entries[j].Read {
+					todo[i].Entries[j].Read = true
+					n++
+				}
+			}
+		}
+		err := feeds.SaveSubs(subs)
+		if err != nil {
+			return err
+		}
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("marked %d entries read", n)})
+		return nil
+	}
+
+	return fmt.Errorf("unknown sub command '%s'", args[0])
+}
+func (_ SubCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"sub"},
+		Desc: "Manage subscriptions to gemlogs, Atom and RSS feeds, and pages to watch for changes.\n" +
+			"\tadd subscribes to a url or the current page, list shows them, rm removes one,\n" +
+			"\trefresh fetches them all or one again, several at once, and read marks their entries read.\n" +
+			"\tThe feed_workers, feed_host_limit and feed_max_age config settings tune refreshing.\n" +
+			"\tUsage: sub [add [url] | list | rm [i|url] | refresh [i|url] | read [all|i|url]]",
+	}
+}
+
+func (_ FeedsCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	u, err := url.Parse(feeds.PageURL)
+	if err != nil {
+		return err
+	}
+	return visit(b, out, u)
+}
+func (_ FeedsCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"feeds"},
+		Desc:  "Open the feeds page, with the entries of all your subscriptions by date.",
+	}
+}
+
+// Feeds End
+
+// Mirror
+
+// parseFlags parses the flags at the start of a command's args, returning
+// the rest.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Args(), nil
+}
+
+func (_ MirrorCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	fs := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	depth := fs.Int("depth", mirror.DefaultDepth, "")
+	dir := fs.String("o", "", "")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var u *url.URL
+	if len(args) > 0 {
+		u, err = browser.ParseURL(args[0])
+	} else if b.S.CurrURL() != "" {
+		u, err = url.Parse(b.S.CurrURL())
+	} else {
+		return errors.New("must include a url or be on a page")
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := b.FetchOpts()
+	opts.Input = nil
+	opts.OnWait = WaitProgress(out)
+	opts.Delay = b.Conf.PoliteDelay()
+	opts.SlowDownRetries = 3
+	opts.MaxWait = 5 * time.Minute
+
+	connecting(out, u)
+	stats, err := mirror.Run(context.Background(), u, mirror.Options{
+		Dir:   *dir,
+		Depth: *depth,
+		Fetch: b.Fetch,
+		Opts:  opts,
+		Progress: func(done, total int) {
+			out.RecvProgress(Progress{Label: "mirroring", Done: done, Total: total})
+		},
+		Warn: func(err error) {
+			out.RecvStatus(Status{Kind: StatusWarning, Msg: err.Error()})
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("mirrored %d pages and %d files to %s", stats.Pages, stats.Files, stats.Dir)
+	if stats.Robots != 0 {
+		msg += fmt.Sprintf(", %d skipped for robots.txt", stats.Robots)
+	}
+	if stats.Failed != 0 {
+		msg += fmt.Sprintf(", %d failed", stats.Failed)
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: msg, URL: u.String()})
+	return nil
+}
+func (_ MirrorCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"mirror"},
+		Desc: "Save the pages and files under a url's directory on its host, or the current page's, for\n" +
+			"\tbrowsing offline. Links between them are rewritten to relative paths. -depth limits how many\n" +
+			"\tlinks deep it goes (default " + strconv.Itoa(mirror.DefaultDepth) + ", -1 for no limit), and -o sets the directory, which\n" +
+			"\tis named after the host by default. robots.txt is honored and requests are spaced out.\n" +
+			"\tUsage: mirror [-depth n] [-o dir] [url]",
+	}
+}
+
+// Mirror End
+
+// Check
+
+// Check output formats.
+const (
+	FormatTable   = "table"
+	FormatJSON    = "json"
+	FormatGemtext = "gemtext"
+)
+
+func (_ CheckCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	crawl := fs.Bool("crawl", false, "")
+	format := fs.String("format", FormatTable, "")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains([]string{FormatTable, FormatJSON, FormatGemtext}, *format) {
+		return fmt.Errorf("unknown format '%s', must be table, json or gemtext", *format)
+	}
+
+	var u *url.URL
+	if len(args) > 0 {
+		u, err = browser.ParseURL(args[0])
+	} else if b.S.CurrURL() != "" {
+		u, err = url.Parse(b.S.CurrURL())
+	} else {
+		return errors.New("must include a url or be on a page")
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := b.FetchOpts()
+	opts.OnWait = WaitProgress(out)
+	opts.Delay = b.Conf.PoliteDelay()
+	opts.SlowDownRetries = 0
+
+	connecting(out, u)
+	report, err := linkcheck.Run(context.Background(), u, linkcheck.Options{
+		Crawl: *crawl,
+		Fetch: b.Fetch,
+		Opts:  opts,
+		Progress: func(done, total int) {
+			out.RecvProgress(Progress{Label: "checking", Done: done, Total: total})
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case FormatJSON:
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		out.RecvMsg(string(content))
+	case FormatGemtext:
+		out.RecvMsg(report.Gemtext())
+	default:
+		table := Table{Header: []string{"status", "code", "url", "detail"}}
+		for _, res := range report.Results {
+			code := ""
+			if res.Code != 0 {
+				code = strconv.Itoa(res.Code)
+			}
+			detail := res.Detail
+			if len(res.Redirects) != 0 {
+				detail = "-> " + strings.Join(res.Redirects, " -> ")
+			}
+			table.Rows = append(table.Rows, Row{Cells: []string{string(res.Status), code, res.URL, detail}})
+		}
+		out.RecvTable(table)
+	}
+
+	broken := len(report.Broken())
+	if broken != 0 {
+		return &linkcheck.BrokenError{Broken: broken, Total: len(report.Results)}
+	}
+	out.RecvStatus(Status{
+		Kind: StatusInfo,
+		Msg:  fmt.Sprintf("checked %d links, none are broken", len(report.Results)),
+		URL:  u.String(),
+	})
+	return nil
+}
+func (_ CheckCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"check"},
+		Desc: "Request every link on a url's page, or the current page, and report which are broken. -crawl\n" +
+			"\talso checks the links of every page under its directory on its host. -format is table (the\n" +
+			"\tdefault), json or gemtext. robots.txt is honored and requests are spaced out.\n" +
+			"\tUsage: check [-crawl] [-format table|json|gemtext] [url]",
+	}
+}
+
+// Check End
+
+// Search
+func (_ SearchCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	u, err := url.Parse(search.PageURL(strings.Join(args, " ")))
+	if err != nil {
+		return err
+	}
+	return visit(b, out, u)
+}
+func (_ SearchCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"search"},
+		Desc: "Search the pages you have visited or that are cached, with the pages whose headings have the\n" +
+			"\tterms first. Every term has to be on a page for it to be found.\n" +
+			"\tUsage: search [terms]",
+	}
+}
+
+// Search End
+
+// Titan
+
+// editText opens text in the user's editor, returning it once they are done.
+// ext is given to the file so the editor can tell what it is.
+func editText(text, ext string) (string, error) {
+	f, err := os.CreateTemp("", "gemcat-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+
+	// Like an opener, the editor can have arguments of its own.
+	editor := cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi")
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "gemcat", f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", editor, err)
+	}
+
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// upload sends up to a titan url, then shows the page it was uploaded to if
+// the server says where that is.
+func upload(b *browser.Browser, out ShellOut, u *url.URL, up browser.Upload) error {
+	connecting(out, u)
+	opts := b.FetchOpts()
+	opts.Input = nil
+	resp, err := browser.Titan(context.Background(), u, up, opts)
+	if err != nil {
+		return err
+	}
+
+	out.RecvStatus(Status{
+		Kind: StatusInfo,
+		Msg:  fmt.Sprintf("uploaded %d bytes to %s", len(up.Body), u),
+		URL:  u.String(),
+	})
+	if resp.URL != nil && resp.URL.Scheme == "gemini" {
+		// It was just fetched, so this comes from the cache.
+		return visit(b, out, resp.URL)
+	}
+	return nil
+}
+
+func (_ UploadCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+	mimeType := fs.String("mime", "", "")
+	token := fs.String("token", "", "")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("must include a titan url")
+	}
+
+	u, err := browser.ParseURL(args[0])
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "gemini" {
+		u = browser.TitanURL(u)
+	}
+	if u.Scheme != "titan" {
+		return fmt.Errorf("can't upload to %s urls", u.Scheme)
+	}
+
+	var body []byte
+	switch {
+	case len(args) < 2:
+		text, err := editText("", ".gmi")
+		if err != nil {
+			return err
+		}
+		if text == "" {
+			return errors.New("nothing was written, so nothing was uploaded")
+		}
+		body = []byte(text)
+	case args[1] == "-":
+		body, err = io.ReadAll(os.Stdin)
+	default:
+		body, err = os.ReadFile(args[1])
+		if *mimeType == "" {
+			*mimeType = browser.MimeType(args[1])
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return upload(b, out, u, browser.Upload{Body: body, Mime: *mimeType, Token: *token})
+}
+func (_ UploadCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"upload", "up"},
+		Desc: "Upload a file to a titan url, or a gemini url's titan counterpart. The file is read from\n" +
+			"\tstdin if it is -, and written in your $EDITOR if it is left out. -mime sets its type, which\n" +
+			"\tis guessed from the file's name and is text/gemini otherwise, and -token is the server's\n" +
+			"\tpassword for uploads, if it has one.\n" +
+			"\tUsage: upload [-mime type] [-token token] [url] [file|-]",
+	}
+}
+
+func (_ EditCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	mimeType := fs.String("mime", "", "")
+	token := fs.String("token", "", "")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var u *url.URL
+	if len(args) > 0 {
+		u, err = browser.ParseURL(args[0])
+	} else if b.S.CurrURL() != "" {
+		u, err = url.Parse(b.S.CurrURL())
+	} else {
+		return errors.New("must include a url or be on a page")
+	}
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "titan" {
+		g := *u
+		g.Scheme = "gemini"
+		u = &g
+	}
+	if u.Scheme != "gemini" {
+		return fmt.Errorf("can't edit %s urls", u.Scheme)
+	}
+
+	connecting(out, u)
+	opts := b.FetchOpts()
+	opts.NoCache = true
+	resp, err := b.Fetch(context.Background(), u, opts)
+	var serr *browser.StatusError
+	if errors.As(err, &serr) && serr.Code == 51 {
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("%s doesn't exist yet, starting it", u), URL: u.String()})
+	} else if err != nil {
+		return err
+	}
+	if resp.Download != "" {
+		return fmt.Errorf("%s isn't text, so it can't be edited", u)
+	}
+	if resp.URL != nil {
+		u = resp.URL
+	}
+	// Pages that don't exist yet are gemtext unless told otherwise.
+	if *mimeType == "" {
+		*mimeType = resp.Mime()
+	}
+	ext := ".gmi"
+	if *mimeType != "text/gemini" {
+		ext = ".txt"
+	}
+
+	edited, err := editText(resp.Body, ext)
+	if err != nil {
+		return err
+	}
+	if edited == resp.Body {
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: "no changes, nothing was uploaded", URL: u.String()})
+		return nil
+	}
+
+	up := browser.Upload{Body: []byte(edited), Mime: *mimeType, Token: *token}
+	return upload(b, out, browser.TitanURL(u), up)
+}
+func (_ EditCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"edit"},
+		Desc: "Edit a gemini page, or the current page, in your $EDITOR and upload it over titan when you\n" +
+			"\tare done. Pages that don't exist yet are started empty. The page is uploaded with the type\n" +
+			"\tit was served with, or text/gemini if it is new, unless -mime says otherwise. -token is the\n" +
+			"\tserver's password for uploads, if it has one.\n" +
+			"\tUsage: edit [-mime type] [-token token] [url]",
+	}
+}
+
+// Titan End
+
+// Misc
+func (_ ReprintCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	out.RecvPage(b.S.CurrPage())
+	return nil
+}
+func (_ ReprintCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"reprint", "rp"},
+		Desc:  "Reprint the current page's contents.",
+	}
+}
+
+func (_ PagerCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) == 0 {
+		mode := b.Conf.Pager
+		if mode == "" {
+			mode = config.PagerAuto
+		}
+		out.RecvMsg("pager: " + mode)
+		return nil
+	}
+
+	switch args[0] {
+	case config.PagerAuto, config.PagerAlways, config.PagerOff:
+		b.Conf.Pager = args[0]
+	default:
+		return fmt.Errorf("unknown pager mode '%s'", args[0])
+	}
+
+	err := b.Conf.Save()
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: "pager: " + args[0]})
+	return nil
+}
+func (_ PagerCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"pager"},
+		Desc: "Show or set when pages are shown through $PAGER or the built-in pager.\n" +
+			"\tauto pages anything taller than the terminal.\n" +
+			"\tUsage: pager [auto|always|off]",
+	}
+}
+
+func (_ EditModeCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) == 0 {
+		mode := b.Conf.EditMode
+		if mode == "" {
+			mode = config.EditModeEmacs
+		}
+		out.RecvMsg("edit mode: " + mode)
+		return nil
+	}
+
+	switch args[0] {
+	case config.EditModeEmacs, config.EditModeVi:
+		b.Conf.EditMode = args[0]
+	default:
+		return fmt.Errorf("unknown edit mode '%s'", args[0])
+	}
+
+	err := b.Conf.Save()
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: "edit mode: " + args[0]})
+	return nil
+}
+func (_ EditModeCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"editmode"},
+		Desc:  "Show or set the line editing bindings.\n\tUsage: editmode [emacs|vi]",
+	}
+}
+
+func (_ OpenerCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	table := Table{Header: []string{"scheme", "command"}}
+	switch len(args) {
+	case 0:
+		if _, ok := b.Conf.Openers["*"]; !ok {
+			table.Rows = append(table.Rows, Row{Cells: []string{"*", browser.DefaultOpener()}})
+		}
+		for _, scheme := range slices.Sorted(maps.Keys(b.Conf.Openers)) {
+			table.Rows = append(table.Rows, Row{Cells: []string{scheme, b.Conf.Openers[scheme]}})
+		}
+		out.RecvTable(table)
+		return nil
+	case 1:
+		command := b.Conf.OpenCommand(args[0])
+		if command == "" {
+			command = browser.DefaultOpener()
+		}
+		table.Rows = append(table.Rows, Row{Cells: []string{args[0], command}})
+		out.RecvTable(table)
+		return nil
+	}
+
+	scheme, command := args[0], strings.Join(args[1:], " ")
+	if command == "rm" {
+		if _, ok := b.Conf.Openers[scheme]; !ok {
+			return fmt.Errorf("no opener is set for %s", scheme)
+		}
+		delete(b.Conf.Openers, scheme)
+	} else {
+		if b.Conf.Openers == nil {
+			b.Conf.Openers = make(map[string]string)
+		}
+		b.Conf.Openers[scheme] = command
+	}
+
+	err := b.Conf.Save()
+	if err != nil {
+		return err
+	}
+	if command == "rm" {
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("removed opener for %s", scheme)})
+	} else {
+		out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("%s %s", scheme, command)})
+	}
+	return nil
+}
+func (_ OpenerCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"opener"},
+		Desc: "Show or set the command that opens links gemcat can't fetch itself, like https or mailto,\n" +
+			"\tper scheme or for all of them with '*'. %s is replaced by the link, otherwise it is added\n" +
+			"\tto the end. The default is " + browser.DefaultOpener() + ".\n" +
+			"\tUsage: opener [scheme|*] [command...|rm]",
+	}
+}
+
+func (_ AliasCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) == 0 {
+		if len(b.Conf.Aliases) == 0 {
+			return errors.New("no aliases are defined")
+		}
+		table := Table{Header: []string{"name", "alias"}}
+		for _, name := range slices.Sorted(maps.Keys(b.Conf.Aliases)) {
+			table.Rows = append(table.Rows, Row{Cells: []string{name, b.Conf.Aliases[name]}})
+		}
+		out.RecvTable(table)
+		return nil
+	}
+
+	name := args[0]
+	if len(args) == 1 {
+		alias, ok := b.Conf.Aliases[name]
+		if !ok {
+			return fmt.Errorf("alias '%s' does not exist", name)
+		}
+		out.RecvMsg(fmt.Sprintf("%s = %s", name, alias))
+		return nil
+	}
+
+	// A single argument is a whole line of commands, like the usage example.
+	// Several are quoted again, so that an argument with spaces in it stays
+	// one argument when the alias is run.
+	line := args[1]
+	if len(args) > 2 {
+		line = QuoteArgs(args[1:])
+	}
+	if _, err := Lex(line); err != nil {
+		return err
+	}
+	if isBuiltin(name) {
+		return fmt.Errorf("'%s' is already a command", name)
+	}
+
+	if b.Conf.Aliases == nil {
+		b.Conf.Aliases = make(map[string]string)
+	}
+	b.Conf.Aliases[name] = line
+
+	err := b.Conf.Save()
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("%s = %s", name, b.Conf.Aliases[name])})
+	return nil
+}
+func (_ AliasCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"alias"},
+		Desc: "List, show or define aliases. Arguments given to an alias are added to the end of it.\n" +
+			"\tUsage: alias [name] [commands...], e.g. alias home 'gt example.org; ls'",
+	}
+}
+
+func (_ UnaliasCmd) Do(b *browser.Browser, out ShellOut, args []string) error {
+	if len(args) == 0 {
+		return errors.New("must include an alias")
+	}
+	if _, ok := b.Conf.Aliases[args[0]]; !ok {
+		return fmt.Errorf("alias '%s' does not exist", args[0])
+	}
+
+	delete(b.Conf.Aliases, args[0])
+	err := b.Conf.Save()
+	if err != nil {
+		return err
+	}
+	out.RecvStatus(Status{Kind: StatusInfo, Msg: fmt.Sprintf("removed alias %s", args[0])})
+	return nil
+}
+func (_ UnaliasCmd) Help() HelpInfo {
+	return HelpInfo{
+		Words: []string{"unalias"},
+		Desc:  "Remove an alias.\n\tUsage: unalias [name]",
 	}
 }
 
@@ -0,0 +1,619 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
+	"github.com/krbreyn/gemcat/geminitest"
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+type checkFunc func(t *testing.T, b *browser.Browser, out *Recorder)
+
+func wantPage(u string) checkFunc {
+	return func(t *testing.T, b *browser.Browser, out *Recorder) {
+		t.Helper()
+		if got := lastPage(t, out).URL; got != u {
+			t.Errorf("got page %s, want %s", got, u)
+		}
+	}
+}
+
+func wantMsgs(msgs ...string) checkFunc {
+	return func(t *testing.T, b *browser.Browser, out *Recorder) {
+		t.Helper()
+		if !slices.Equal(out.Msgs, msgs) {
+			t.Errorf("got msgs %q, want %q", out.Msgs, msgs)
+		}
+	}
+}
+
+func wantMsgPrefix(prefix string) checkFunc {
+	return func(t *testing.T, b *browser.Browser, out *Recorder) {
+		t.Helper()
+		if len(out.Msgs) != 1 || !strings.HasPrefix(out.Msgs[0], prefix) {
+			t.Errorf("got msgs %q, want one starting with %q", out.Msgs, prefix)
+		}
+	}
+}
+
+func wantStatus(kind StatusKind, msg string) checkFunc {
+	return func(t *testing.T, b *browser.Browser, out *Recorder) {
+		t.Helper()
+		if len(out.Statuses) == 0 {
+			t.Fatal("no status was received")
+		}
+		s := out.Statuses[len(out.Statuses)-1]
+		if s.Kind != kind || s.Msg != msg {
+			t.Errorf("got status %v %q, want %v %q", s.Kind, s.Msg, kind, msg)
+		}
+	}
+}
+
+// wantRows checks the rows of the only table received, with the cells of
+// each row joined by spaces and the current row marked with "->".
+func wantRows(rows ...string) checkFunc {
+	return func(t *testing.T, b *browser.Browser, out *Recorder) {
+		t.Helper()
+		if len(out.Tables) != 1 {
+			t.Fatalf("got %d tables, want 1", len(out.Tables))
+		}
+		var got []string
+		for _, row := range out.Tables[0].Rows {
+			s := strings.Join(row.Cells, " ")
+			if row.Current {
+				s = "-> " + s
+			}
+			got = append(got, s)
+		}
+		if !slices.Equal(got, rows) {
+			t.Errorf("got rows %q, want %q", got, rows)
+		}
+	}
+}
+
+func TestCmds(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "# Home\n=> /a.gmi A\n=> b.gmi\nfind me\n")
+	s.Page("/a.gmi", "# A\n")
+	s.Page("/b.gmi", "# B\n")
+	s.Page("/broken.gmi", "=> /a.gmi\n=> /nope.gmi\n")
+	s.Handle("/notes.csv", geminitest.Route{Status: 20, Meta: "text/csv", Body: "zebra,stripes\n"})
+	s.Page("/ask.gmi", "=: /hello Your name\n")
+	s.Handle("/hello", geminitest.Route{Func: func(r *geminitest.Request) geminitest.Route {
+		return geminitest.Route{Status: 20, Meta: "text/gemini", Body: "Hello " + r.URL.RawQuery + "\n"}
+	}})
+	var wikiMu sync.Mutex
+	wiki := make(map[string]string)
+	s.Handle("/wiki.gmi", geminitest.Route{Func: func(r *geminitest.Request) geminitest.Route {
+		wikiMu.Lock()
+		defer wikiMu.Unlock()
+		if r.URL.Scheme == "titan" {
+			wiki[r.Params["token"]] = string(r.Body)
+			return geminitest.Route{Status: 30, Meta: s.URL("/wiki.gmi")}
+		}
+		if body, ok := wiki["pw"]; ok {
+			return geminitest.Route{Status: 20, Meta: "text/gemini", Body: body}
+		}
+		return geminitest.Route{Status: 51, Meta: "not found"}
+	}})
+	var notesMime string
+	s.Handle("/notes.txt", geminitest.Route{Func: func(r *geminitest.Request) geminitest.Route {
+		wikiMu.Lock()
+		defer wikiMu.Unlock()
+		if r.URL.Scheme == "titan" {
+			notesMime = r.Params["mime"]
+			return geminitest.Route{Status: 30, Meta: s.URL("/notes.txt")}
+		}
+		return geminitest.Route{Status: 20, Meta: "text/plain", Body: "Uploaded notes\n"}
+	}})
+	wantMime := func(mime string) checkFunc {
+		return func(t *testing.T, b *browser.Browser, out *Recorder) {
+			t.Helper()
+			wikiMu.Lock()
+			defer wikiMu.Unlock()
+			if notesMime != mime {
+				t.Errorf("uploaded %q, want %q", notesMime, mime)
+			}
+		}
+	}
+	upFile := filepath.Join(t.TempDir(), "up.gmi")
+	os.WriteFile(upFile, []byte("# Uploaded\n"), 0644)
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "sed -i s/Uploaded/Edited/")
+
+	su, _ := url.Parse(s.URL("/"))
+	host := su.Host
+	hostsFile := filepath.Join(t.TempDir(), "hosts")
+	opened := filepath.Join(t.TempDir(), "opened")
+	mirrorDir := filepath.Join(t.TempDir(), "mirror")
+	pinned := strings.Repeat("ab", 32)
+	policy, _ := tofu.ParsePolicy("ca+spki")
+
+	steps := []struct {
+		cmd     ShellCmd
+		args    []string
+		wantErr bool
+		check   checkFunc
+	}{
+		{cmd: TestCmd{}, check: wantMsgs("This is a test command!")},
+
+		// Navigation and links
+		{cmd: GotoCmd{}, wantErr: true},
+		{cmd: GotoCmd{}, args: []string{s.URL("/")}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantPage(s.URL("/"))(t, b, out)
+			if len(out.Statuses) != 1 || out.Statuses[0].Kind != StatusConnecting || out.Statuses[0].URL != s.URL("/") {
+				t.Errorf("got statuses %+v", out.Statuses)
+			}
+		}},
+		{cmd: TLSInfoCmd{}, check: wantMsgPrefix("version:")},
+		{cmd: LinkCmd{}, args: []string{"0"}, check: wantMsgs("/a.gmi")},
+		{cmd: LinkCmd{}, args: []string{"9"}, wantErr: true},
+		{cmd: LinksCmd{}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			if len(out.Links) != 1 || len(out.Links[0]) != 2 || out.Links[0][0].Label != "A" {
+				t.Errorf("got links %+v", out.Links)
+			}
+		}},
+		{cmd: LinkCurrentCmd{}, check: wantMsgs(s.URL("/"))},
+		{cmd: LinkGotoCmd{}, args: []string{"1"}, check: wantPage(s.URL("/b.gmi"))},
+		{cmd: BackCmd{}, check: wantPage(s.URL("/"))},
+		{cmd: ForwardCmd{}, check: wantPage(s.URL("/b.gmi"))},
+		{cmd: ForwardCmd{}, wantErr: true},
+		{cmd: BackCmd{}, check: wantPage(s.URL("/"))},
+		{cmd: LinkGotoCmd{}, args: []string{"0"}, check: wantPage(s.URL("/a.gmi"))},
+		{cmd: ReprintCmd{}, check: wantPage(s.URL("/a.gmi"))},
+
+		// Stack
+		{cmd: StackCmd{}, check: wantRows("0 "+s.URL("/"), "-> 1 "+s.URL("/a.gmi"))},
+		{cmd: StackPosCmd{}, check: wantMsgs("1")},
+		{cmd: StackRmCmd{}, check: wantStatus(StatusWarning, "Not implemented!")},
+		{cmd: StackGotoCmd{}, args: []string{"5"}, wantErr: true},
+		{cmd: StackGotoCmd{}, args: []string{"0"}, check: wantPage(s.URL("/"))},
+		{cmd: StackCloseCmd{}, check: wantStatus(StatusInfo, "closed 1 pages")},
+		{cmd: HistoryGotoCmd{}, args: []string{"2"}, check: wantPage(s.URL("/a.gmi"))},
+		{cmd: StackCompressCmd{}, check: wantStatus(StatusInfo, "closed 1 pages")},
+		{cmd: StackEmptyCmd{}, check: wantStatus(StatusInfo, "closed 1 pages")},
+		{cmd: BackCmd{}, wantErr: true},
+
+		// History
+		{cmd: HistoryCmd{}, check: wantRows("0 "+s.URL("/"), "1 "+s.URL("/b.gmi"), "2 "+s.URL("/a.gmi"))},
+		{cmd: HistoryGotoCmd{}, args: []string{"3"}, wantErr: true},
+		{cmd: HistoryRmCmd{}, args: []string{"1"}, check: wantStatus(StatusInfo, "deleting "+s.URL("/b.gmi")+"...")},
+		{cmd: HistoryClearAllCmd{}, check: wantStatus(StatusInfo, "deleted 2 history items")},
+		{cmd: HistoryCmd{}, wantErr: true},
+
+		// Bookmarks
+		{cmd: BookmarksCmd{}, wantErr: true},
+		{cmd: BookmarkAddCurrentCmd{}, wantErr: true},
+		{cmd: GotoCmd{}, args: []string{s.URL("/")}, check: wantPage(s.URL("/"))},
+		{cmd: BookmarkAddCurrentCmd{}, check: wantStatus(StatusInfo, "added "+s.URL("/")+" to bookmarks")},
+		{cmd: BookmarkAddCurrentCmd{}, wantErr: true},
+		{cmd: BookmarkAddLinkCmd{}, args: []string{"0"}, check: wantStatus(StatusInfo, "added "+s.URL("/a.gmi")+" to bookmarks")},
+		{cmd: BookmarkSwapCmd{}, args: []string{"0", "1"}, check: wantStatus(StatusInfo, "swapped 0 and 1")},
+		{cmd: BookmarksCmd{}, check: wantRows("0 "+s.URL("/a.gmi"), "1 "+s.URL("/"))},
+		{cmd: BookmarkGotoCmd{}, args: []string{"0"}, check: wantPage(s.URL("/a.gmi"))},
+		{cmd: BookmarkRmCmd{}, args: []string{"0"}, check: wantStatus(StatusInfo, "deleting "+s.URL("/a.gmi")+" ...")},
+		{cmd: BookmarkClearAllCmd{}, check: wantStatus(StatusInfo, "deleted 1 bookmarks")},
+
+		// Find
+		{cmd: GotoCmd{}, args: []string{s.URL("/")}, check: wantPage(s.URL("/"))},
+		{cmd: FindNextCmd{}, wantErr: true},
+		{cmd: FindCmd{}, args: []string{"nothing"}, wantErr: true},
+		{cmd: FindCmd{}, args: []string{"find", "me"}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantStatus(StatusInfo, "1 matching lines for 'find me'")(t, b, out)
+			if len(out.Msgs) != 1 || !strings.Contains(out.Msgs[0], "find me") {
+				t.Errorf("got msgs %q", out.Msgs)
+			}
+		}},
+		{cmd: FindNextCmd{}, check: wantMsgPrefix("match 1/1\n")},
+		{cmd: FindPrevCmd{}, check: wantMsgPrefix("match 1/1\n")},
+		{cmd: FindCmd{}, check: wantStatus(StatusInfo, "search cleared")},
+
+		// Certs
+		{cmd: CertListCmd{}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			if len(out.Tables) != 1 || len(out.Tables[0].Rows) != 1 || out.Tables[0].Rows[0].Cells[1] != host {
+				t.Errorf("got tables %+v", out.Tables)
+			}
+		}},
+		{cmd: CertShowCmd{}, args: []string{"0"}, check: wantMsgPrefix("host:        " + host)},
+		{cmd: CertShowCmd{}, args: []string{"nowhere"}, wantErr: true},
+		{cmd: CertExportCmd{}, check: wantMsgPrefix(host + " ")},
+		{cmd: CertExportCmd{}, args: []string{hostsFile}, check: wantStatus(StatusInfo, "exported trusted hosts to "+hostsFile)},
+		{cmd: CertForgetCmd{}, args: []string{host}, check: wantStatus(StatusInfo, "forgot "+host)},
+		{cmd: CertListCmd{}, wantErr: true},
+		{cmd: CertImportCmd{}, args: []string{hostsFile}, check: wantStatus(StatusInfo, "imported 1 hosts")},
+		{cmd: CertPinCmd{}, args: []string{"example.org"}, wantErr: true},
+		{cmd: CertPinCmd{}, args: []string{"example.org", pinned}, check: wantStatus(StatusInfo, "pinned example.org")},
+		{cmd: VerifyCmd{}, check: wantRows("* tofu")},
+		{cmd: VerifyCmd{}, args: []string{"example.org", "bogus"}, wantErr: true},
+		{cmd: VerifyCmd{}, args: []string{"example.org", "ca+spki"}, check: wantStatus(StatusInfo, "example.org "+policy.String())},
+		{cmd: VerifyCmd{}, args: []string{"example.org"}, check: wantRows("example.org " + policy.String())},
+		{cmd: VerifyCmd{}, args: []string{"example.org", "rm"}, check: wantStatus(StatusInfo, "example.org tofu")},
+
+		// Mirror
+		{cmd: MirrorCmd{}, args: []string{"-depth", "nope"}, wantErr: true},
+		{cmd: MirrorCmd{}, args: []string{"-depth", "1", "-o", mirrorDir, s.URL("/")}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantStatus(StatusInfo, "mirrored 3 pages and 0 files to "+mirrorDir)(t, b, out)
+			got, err := os.ReadFile(filepath.Join(mirrorDir, "index.gmi"))
+			if err != nil || !strings.Contains(string(got), "=> a.gmi A\n") {
+				t.Errorf("mirrored %q, %v", got, err)
+			}
+		}},
+
+		// Check
+		{cmd: CheckCmd{}, args: []string{"-format", "xml", s.URL("/")}, wantErr: true},
+		{cmd: CheckCmd{}, args: []string{s.URL("/")}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantRows("ok 20 "+s.URL("/a.gmi")+" ", "ok 20 "+s.URL("/b.gmi")+" ")(t, b, out)
+			wantStatus(StatusInfo, "checked 2 links, none are broken")(t, b, out)
+		}},
+		{cmd: CheckCmd{}, args: []string{"-format", "json", s.URL("/broken.gmi")}, wantErr: true},
+
+		// Search
+		{cmd: SearchCmd{}, args: []string{"find", "me"}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			page := lastPage(t, out)
+			if page.URL != "about:search?find+me" || !strings.Contains(page.Content, "=> "+s.URL("/")+" Home\n> find me\n") {
+				t.Errorf("got page %s:\n%s", page.URL, page.Content)
+			}
+		}},
+		// Only gemtext and plain text are indexed when visited.
+		{cmd: GotoCmd{}, args: []string{s.URL("/notes.csv")}, check: wantPage(s.URL("/notes.csv"))},
+		{cmd: SearchCmd{}, args: []string{"zebra"}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			if page := lastPage(t, out); !strings.Contains(page.Content, "Nothing found") {
+				t.Errorf("a csv file was indexed:\n%s", page.Content)
+			}
+		}},
+
+		// Titan
+		{cmd: UploadCmd{}, wantErr: true},
+		{cmd: UploadCmd{}, args: []string{"https://example.org/", upFile}, wantErr: true},
+		{cmd: EditCmd{}, args: []string{"https://example.org/"}, wantErr: true},
+		{cmd: UploadCmd{}, args: []string{"-token", "pw", s.URL("/wiki.gmi"), upFile}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantPage(s.URL("/wiki.gmi"))(t, b, out)
+			if got := lastPage(t, out).Content; got != "# Uploaded\n" {
+				t.Errorf("got page %q", got)
+			}
+		}},
+		{cmd: EditCmd{}, args: []string{"-token", "pw"}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			if got := lastPage(t, out).Content; got != "# Edited\n" {
+				t.Errorf("got page %q", got)
+			}
+		}},
+		{cmd: EditCmd{}, check: wantStatus(StatusInfo, "no changes, nothing was uploaded")},
+		// Edits are uploaded with the type the page was served with.
+		{cmd: EditCmd{}, args: []string{s.URL("/notes.txt")}, check: wantMime("text/plain")},
+		{cmd: EditCmd{}, args: []string{"-mime", "text/markdown", s.URL("/notes.txt")}, check: wantMime("text/markdown")},
+
+		// Misc
+		{cmd: PagerCmd{}, check: wantMsgs("pager: auto")},
+		{cmd: PagerCmd{}, args: []string{"always"}, check: wantStatus(StatusInfo, "pager: always")},
+		{cmd: PagerCmd{}, args: []string{"sometimes"}, wantErr: true},
+		{cmd: EditModeCmd{}, check: wantMsgs("edit mode: emacs")},
+		{cmd: EditModeCmd{}, args: []string{"vi"}, check: wantStatus(StatusInfo, "edit mode: vi")},
+		{cmd: EditModeCmd{}, args: []string{"ed"}, wantErr: true},
+		{cmd: OpenerCmd{}, check: wantRows("* " + browser.DefaultOpener())},
+		{cmd: OpenerCmd{}, args: []string{"https", "echo", ">", opened}, check: wantStatus(StatusInfo, "https echo > "+opened)},
+		{cmd: GotoCmd{}, args: []string{"https://example.org/"}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantStatus(StatusInfo, "opened https://example.org/ with echo > "+opened)(t, b, out)
+			got, err := os.ReadFile(opened)
+			if err != nil || string(got) != "https://example.org/\n" {
+				t.Errorf("opener wrote %q, %v", got, err)
+			}
+		}},
+		{cmd: OpenerCmd{}, args: []string{"https"}, check: wantRows("https echo > " + opened)},
+		{cmd: OpenerCmd{}, args: []string{"https", "rm"}, check: wantStatus(StatusInfo, "removed opener for https")},
+		{cmd: OpenerCmd{}, args: []string{"https", "rm"}, wantErr: true},
+		{cmd: AliasCmd{}, wantErr: true},
+		{cmd: AliasCmd{}, args: []string{"h", "gt", "x"}, check: wantStatus(StatusInfo, "h = gt x")},
+		{cmd: AliasCmd{}, args: []string{"h"}, check: wantMsgs("h = gt x")},
+		{cmd: AliasCmd{}, check: wantRows("h gt x")},
+		{cmd: UnaliasCmd{}, args: []string{"h"}, check: wantStatus(StatusInfo, "removed alias h")},
+		{cmd: UnaliasCmd{}, args: []string{"h"}, wantErr: true},
+
+		// Prompt links
+		{cmd: GotoCmd{}, args: []string{s.URL("/ask.gmi")}, check: wantPage(s.URL("/ask.gmi"))},
+		{cmd: LinkGotoCmd{}, args: []string{"0"}, check: func(t *testing.T, b *browser.Browser, out *Recorder) {
+			wantPage(s.URL("/hello?Ada+Lovelace"))(t, b, out)
+			if !slices.Equal(out.Prompts, []string{"Your name: "}) {
+				t.Errorf("got prompts %q", out.Prompts)
+			}
+		}},
+		{cmd: BackCmd{}, check: wantPage(s.URL("/ask.gmi"))},
+		{cmd: LinkGotoCmd{}, args: []string{"0"}, wantErr: true},
+	}
+
+	// Automated fetches are spaced out, which only slows the tests down.
+	b := &browser.Browser{Conf: config.Config{PoliteDelayMs: -1}}
+	out := &Recorder{Inputs: []string{"Ada Lovelace"}}
+	for i, step := range steps {
+		out.Reset()
+		err := step.cmd.Do(b, out, step.args)
+		if step.wantErr {
+			if err == nil {
+				t.Fatalf("step %d %T %q: expected an error", i, step.cmd, step.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d %T %q: %v", i, step.cmd, step.args, err)
+		}
+		if step.check != nil {
+			t.Run(fmt.Sprintf("%d/%s", i, step.cmd.Help().Words[0]), func(t *testing.T) {
+				step.check(t, b, out)
+			})
+		}
+	}
+
+	out.Reset()
+	err := ExitCmd{}.Do(b, out, nil)
+	if !errors.Is(err, ErrExit) {
+		t.Errorf("exit returned %v", err)
+	}
+	wantStatus(StatusInfo, "Goodbye!")(t, b, out)
+}
+
+func TestRunLineExit(t *testing.T) {
+	sh := NewShell(&Recorder{})
+	out := sh.Out.(*Recorder)
+	b := &browser.Browser{}
+
+	if !sh.HandleLine(b, "nope; exit; test") {
+		t.Error("HandleLine did not report exit")
+	}
+	if len(out.Msgs) != 0 {
+		t.Errorf("commands after exit were run: %q", out.Msgs)
+	}
+	if len(out.Errors) != 1 {
+		t.Errorf("got errors %v, want only the unknown command", out.Errors)
+	}
+
+	out.Reset()
+	if sh.HandleLine(b, "test 'oops") {
+		t.Error("HandleLine reported exit")
+	}
+	var lerr *LexError
+	if len(out.Errors) != 1 || !errors.As(out.Errors[0], &lerr) || lerr.Line != "test 'oops" {
+		t.Errorf("got errors %v, want a LexError", out.Errors)
+	}
+}
+
+func TestSubCmd(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	log := "# My Log\n=> 2026-01-01-a.gmi 2026-01-01 - First\n"
+	s.Page("/log.gmi", log)
+	s.Page("/2026-02-01-b.gmi", "# Second\n")
+
+	// Automated fetches are spaced out, which only slows the tests down.
+	b := &browser.Browser{Conf: config.Config{PoliteDelayMs: -1}}
+	out := &Recorder{}
+	run := func(cmd ShellCmd, args ...string) error {
+		t.Helper()
+		out.Reset()
+		return cmd.Do(b, out, args)
+	}
+
+	if err := run(SubCmd{}); err == nil {
+		t.Error("listing no subscriptions succeeded")
+	}
+	if err := run(SubCmd{}, "add", s.URL("/log.gmi")); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "subscribed to My Log (gemfeed)")(t, b, out)
+	if err := run(SubCmd{}, "add", s.URL("/log.gmi")); err == nil {
+		t.Error("subscribing twice succeeded")
+	}
+
+	s.Page("/log.gmi", log+"=> 2026-02-01-b.gmi 2026-02-01 Second\n")
+	if err := run(SubCmd{}, "refresh"); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "refreshed 1 subscriptions, 1 new entries")(t, b, out)
+	if len(out.Progress) != 2 || out.Progress[1].Done != 1 {
+		t.Errorf("got progress %+v", out.Progress)
+	}
+
+	if err := run(SubCmd{}, "ls"); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Tables) != 1 || len(out.Tables[0].Rows) != 1 || out.Tables[0].Rows[0].Cells[2] != "1" {
+		t.Errorf("got tables %+v", out.Tables)
+	}
+
+	if err := run(FeedsCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	wantPage("about:feeds")(t, b, out)
+	want := "=> " + s.URL("/2026-02-01-b.gmi") + " 2026-02-01 My Log - Second (new)\n" +
+		"=> " + s.URL("/2026-01-01-a.gmi") + " 2026-01-01 My Log - First\n"
+	if got := lastPage(t, out).Content; !strings.Contains(got, want) {
+		t.Errorf("got feeds page:\n%s\nwant it to contain:\n%s", got, want)
+	}
+
+	// Opening an entry marks it read.
+	if err := run(LinkGotoCmd{}, "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(FeedsCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastPage(t, out).Content; strings.Contains(got, "(new)") {
+		t.Errorf("an entry is still new after reading it:\n%s", got)
+	}
+
+	if err := run(SubCmd{}, "rm", "1"); err == nil {
+		t.Error("removing a missing subscription succeeded")
+	}
+	if err := run(SubCmd{}, "rm", s.URL("/log.gmi")); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "unsubscribed from My Log")(t, b, out)
+	if err := run(SubCmd{}, "list"); err == nil {
+		t.Error("listing no subscriptions succeeded")
+	}
+}
+
+func TestCertCmds(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "# Home\n")
+	su, _ := url.Parse(s.URL("/"))
+	host := su.Host
+	pinned := strings.Repeat("ab", 32)
+	exported := filepath.Join(t.TempDir(), "hosts")
+
+	b := &browser.Browser{}
+	out := &Recorder{}
+	run := func(cmd ShellCmd, args ...string) error {
+		t.Helper()
+		out.Reset()
+		return cmd.Do(b, out, args)
+	}
+
+	for _, cmd := range []ShellCmd{CertListCmd{}, CertShowCmd{}, CertForgetCmd{}, CertPinCmd{}, CertImportCmd{}, TLSInfoCmd{}} {
+		if err := run(cmd); err == nil {
+			t.Errorf("%s with nothing to go on succeeded", cmd.Help().Words[0])
+		}
+	}
+	if err := run(CertPinCmd{}, "example.org", "abcd"); err == nil {
+		t.Error("pinned a short fingerprint")
+	}
+
+	// Pinned fingerprints are normalized, and have no certificate until the
+	// host is visited.
+	colons := strings.ToUpper(strings.Join(strings.SplitAfterN(pinned, "ab", 32), ":"))
+	if err := run(CertPinCmd{}, "example.org", colons); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "pinned example.org")(t, b, out)
+	if err := run(CertListCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	wantRows("0 example.org "+pinned+" unknown")(t, b, out)
+	if err := run(CertShowCmd{}, "example.org"); err != nil {
+		t.Fatal(err)
+	}
+	wantMsgs("host:        example.org\nfingerprint: "+pinned+"\n"+
+		"certificate: pinned, not yet seen\nfirst seen:  unknown")(t, b, out)
+
+	if err := run(GotoCmd{}, s.URL("/")); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := tofu.LoadKnownHosts()
+	if err != nil || len(hosts) != 2 {
+		t.Fatalf("got hosts %+v, %v", hosts, err)
+	}
+	fp := hosts[1].Fingerprint
+
+	if err := run(TLSInfoCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Msgs) != 1 || !strings.Contains(out.Msgs[0], "verified by: tofu\ncert 0:\n") ||
+		!strings.Contains(out.Msgs[0], "  fingerprint: "+fp+"\n") {
+		t.Errorf("got tls info %q", out.Msgs)
+	}
+	if err := run(CertShowCmd{}, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Msgs) != 1 || !strings.Contains(out.Msgs[0], "host:        "+host+"\nfingerprint: "+fp+"\nsubject:") {
+		t.Errorf("got cert %q", out.Msgs)
+	}
+	if err := run(CertShowCmd{}, "2"); err == nil {
+		t.Error("showed a host out of range")
+	}
+
+	if err := run(CertExportCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Msgs) != 1 || strings.Count(out.Msgs[0], "\n") != 1 ||
+		!strings.HasPrefix(out.Msgs[0], "example.org "+pinned) {
+		t.Errorf("exported %q", out.Msgs)
+	}
+	if err := run(CertExportCmd{}, exported); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(CertForgetCmd{}, "0"); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "forgot example.org")(t, b, out)
+	if err := run(CertForgetCmd{}, "example.org"); err == nil {
+		t.Error("forgot a host twice")
+	}
+	if err := run(CertImportCmd{}, exported+".nope"); err == nil {
+		t.Error("imported a missing file")
+	}
+	if err := run(CertImportCmd{}, exported); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "imported 2 hosts")(t, b, out)
+	if err := run(CertListCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	if rows := out.Tables[0].Rows; len(rows) != 2 || rows[1].Cells[1] != "example.org" {
+		t.Errorf("got rows %+v", rows)
+	}
+}
+
+func TestSettingCmds(t *testing.T) {
+	geminitest.SetTempDirs(t)
+
+	b := &browser.Browser{}
+	out := &Recorder{}
+	run := func(cmd ShellCmd, args ...string) error {
+		t.Helper()
+		out.Reset()
+		return cmd.Do(b, out, args)
+	}
+
+	if err := run(PagerCmd{}, "never"); err == nil {
+		t.Error("set an unknown pager mode")
+	}
+	if err := run(PagerCmd{}, "off"); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "pager: off")(t, b, out)
+	if err := run(EditModeCmd{}, "vi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(EditModeCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	wantMsgs("edit mode: vi")(t, b, out)
+	if err := run(EditModeCmd{}, "Vi"); err == nil {
+		t.Error("edit modes are case sensitive")
+	}
+
+	if err := run(OpenerCmd{}, "*", "xdg-open"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(OpenerCmd{}, "mailto", "mutt", "%s"); err != nil {
+		t.Fatal(err)
+	}
+	wantStatus(StatusInfo, "mailto mutt %s")(t, b, out)
+	if err := run(OpenerCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	// The default isn't listed once '*' is set.
+	wantRows("* xdg-open", "mailto mutt %s")(t, b, out)
+	if err := run(OpenerCmd{}, "gopher"); err != nil {
+		t.Fatal(err)
+	}
+	wantRows("gopher xdg-open")(t, b, out)
+
+	// Every setting is saved.
+	conf, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Pager != config.PagerOff || conf.EditMode != config.EditModeVi ||
+		conf.Openers["*"] != "xdg-open" || conf.Openers["mailto"] != "mutt %s" {
+		t.Errorf("saved %+v", conf)
+	}
+}
@@ -0,0 +1,116 @@
+package shell
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+// Completion is a candidate for the word being completed. Desc is shown next
+// to it when listing candidates, e.g. the label of a link number.
+type Completion struct {
+	Text string
+	Desc string
+}
+
+// Complete returns candidates for the last word of before, which is the input
+// up to the cursor, along with the byte offset that word starts at.
+func (sh *Shell) Complete(b *browser.Browser, before string) (int, []Completion) {
+	// Only the command after the last ';' or '|' matters.
+	cmdStart := strings.LastIndexAny(before, ";|") + 1
+	wordStart := strings.LastIndexAny(before, " \t") + 1
+	wordStart = max(wordStart, cmdStart)
+
+	word := before[wordStart:]
+	words := strings.Fields(before[cmdStart:wordStart])
+
+	if len(words) == 0 {
+		if cmdStart > 0 && before[cmdStart-1] == '|' {
+			return wordStart, nil
+		}
+		cands := sh.commandCompletions()
+		for _, name := range slices.Sorted(maps.Keys(b.Conf.Aliases)) {
+			cands = append(cands, Completion{Text: name, Desc: b.Conf.Aliases[name]})
+		}
+		return wordStart, filterPrefix(cands, word)
+	}
+
+	if words[0] == "help" {
+		return wordStart, filterPrefix(sh.commandCompletions(), word)
+	}
+
+	cmd, ok := sh.cmd_map[words[0]]
+	if !ok {
+		return wordStart, nil
+	}
+
+	var cands []Completion
+	switch cmd.(type) {
+	case LinkCmd, LinkGotoCmd, BookmarkAddLinkCmd:
+		for _, l := range b.S.CurrPage().Links {
+			desc := l.Label
+			if desc == "" {
+				desc = l.URL
+			}
+			cands = append(cands, Completion{Text: strconv.Itoa(l.No), Desc: desc})
+		}
+	case StackGotoCmd:
+		for i, p := range b.S.Stack {
+			cands = append(cands, Completion{Text: strconv.Itoa(i), Desc: p.URL})
+		}
+	case HistoryRmCmd, HistoryGotoCmd:
+		for i, h := range b.D.History {
+			cands = append(cands, Completion{Text: strconv.Itoa(i), Desc: h})
+		}
+	case BookmarkRmCmd, BookmarkGotoCmd, BookmarkSwapCmd:
+		for i, bm := range b.D.Bookmarks {
+			cands = append(cands, Completion{Text: strconv.Itoa(i), Desc: bm})
+		}
+	case CertShowCmd, CertForgetCmd:
+		hosts, _ := tofu.LoadKnownHosts()
+		for _, h := range hosts {
+			cands = append(cands, Completion{Text: h.Name})
+		}
+	case GotoCmd:
+		for _, u := range slices.Concat(b.D.History, b.D.Bookmarks) {
+			if !slices.ContainsFunc(cands, func(c Completion) bool { return c.Text == u }) {
+				cands = append(cands, Completion{Text: u})
+			}
+		}
+		// Let "gt exa" complete to "gemini://example.org"
+		if !strings.Contains(word, "://") {
+			for i := range cands {
+				if rest, ok := strings.CutPrefix(cands[i].Text, "gemini://"); ok {
+					cands[i].Text = rest
+				}
+			}
+		}
+	}
+
+	return wordStart, filterPrefix(cands, word)
+}
+
+func (sh *Shell) commandCompletions() []Completion {
+	cands := []Completion{{Text: "help"}}
+	for _, hi := range sh.help {
+		for _, w := range hi.Words {
+			cands = append(cands, Completion{Text: w})
+		}
+	}
+	slices.SortFunc(cands, func(a, b Completion) int { return strings.Compare(a.Text, b.Text) })
+	return cands
+}
+
+func filterPrefix(cands []Completion, prefix string) []Completion {
+	var out []Completion
+	for _, c := range cands {
+		if strings.HasPrefix(c.Text, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
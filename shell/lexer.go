@@ -0,0 +1,139 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Command is one command of a line of input. Pipe holds the external
+// programs its output is piped through, in order.
+type Command struct {
+	Args []string
+	Pipe [][]string
+}
+
+type LexError struct {
+	Line string
+	// Col is the 1-based column of the line where lexing failed.
+	Col int
+	Msg string
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Msg, e.Col)
+}
+
+// Caret returns the line with a caret under the column where lexing failed.
+func (e *LexError) Caret() string {
+	return fmt.Sprintf("  %s\n  %s^", e.Line, strings.Repeat(" ", e.Col-1))
+}
+
+// Lex splits a line into commands much like a POSIX shell would. Words are
+// separated by whitespace, single quotes keep everything literal, double
+// quotes allow \" and \\, a backslash outside of quotes escapes the next
+// character, ';' separates commands and '|' pipes a command into programs.
+func Lex(line string) ([]Command, error) {
+	var cmds []Command
+	var stages [][]string
+	var words []string
+	var word strings.Builder
+	var inWord bool
+	var stageCol int
+
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	endStage := func(col int) error {
+		endWord()
+		if len(words) == 0 {
+			return &LexError{Line: line, Col: col, Msg: "missing command before '|'"}
+		}
+		stages = append(stages, words)
+		words = nil
+		return nil
+	}
+
+	endCommand := func() error {
+		endWord()
+		if len(stages) > 0 && len(words) == 0 {
+			return &LexError{Line: line, Col: stageCol, Msg: "missing command after '|'"}
+		}
+		if len(words) > 0 {
+			stages = append(stages, words)
+		}
+		if len(stages) > 0 {
+			cmd := Command{Args: stages[0]}
+			if len(stages) > 1 {
+				cmd.Pipe = stages[1:]
+			}
+			cmds = append(cmds, cmd)
+		}
+		stages = nil
+		words = nil
+		return nil
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		col := i + 1
+
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			endWord()
+		case r == ';':
+			if err := endCommand(); err != nil {
+				return nil, err
+			}
+		case r == '|':
+			if err := endStage(col); err != nil {
+				return nil, err
+			}
+			stageCol = col
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, &LexError{Line: line, Col: col, Msg: "nothing to escape"}
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &LexError{Line: line, Col: col, Msg: "unterminated single quote"}
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			inWord = true
+			i = end
+		case r == '"':
+			start := col
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &LexError{Line: line, Col: start, Msg: "unterminated double quote"}
+			}
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if err := endCommand(); err != nil {
+		return nil, err
+	}
+	return cmds, nil
+}
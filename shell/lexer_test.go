@@ -0,0 +1,68 @@
+package shell
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		line string
+		want []Command
+	}{
+		{"", nil},
+		{"goto example.org", []Command{{Args: []string{"goto", "example.org"}}}},
+		{`find "two words"`, []Command{{Args: []string{"find", "two words"}}}},
+		{`find 'it''s' a\ b`, []Command{{Args: []string{"find", "its", "a b"}}}},
+		{`find "say \"hi\" \n"`, []Command{{Args: []string{"find", `say "hi" \n`}}}},
+		{`bmac ""`, []Command{{Args: []string{"bmac", ""}}}},
+		{"gt a; ; ls ;", []Command{
+			{Args: []string{"gt", "a"}},
+			{Args: []string{"ls"}},
+		}},
+		{"rp | grep 'a b' | wc -l; lc", []Command{
+			{Args: []string{"rp"}, Pipe: [][]string{{"grep", "a b"}, {"wc", "-l"}}},
+			{Args: []string{"lc"}},
+		}},
+		{`find a\|b\;c`, []Command{{Args: []string{"find", "a|b;c"}}}},
+	}
+
+	for _, tt := range tests {
+		got, err := Lex(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %#v, want %#v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		col  int
+	}{
+		{`find "abc`, 6},
+		{`find 'abc`, 6},
+		{`find abc\`, 9},
+		{`| grep a`, 1},
+		{`rp | | grep a`, 6},
+		{`rp |`, 4},
+		{`rp | grep a |; lc`, 13},
+	}
+
+	for _, tt := range tests {
+		_, err := Lex(tt.line)
+		var lerr *LexError
+		if !errors.As(err, &lerr) {
+			t.Errorf("%q: got error %v, want a LexError", tt.line, err)
+			continue
+		}
+		if lerr.Col != tt.col {
+			t.Errorf("%q: got column %d, want %d", tt.line, lerr.Col, tt.col)
+		}
+	}
+}
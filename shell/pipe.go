@@ -0,0 +1,113 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/gemtxt"
+)
+
+// pipeOutput writes a command's output as plain text so that it can be piped
+// into other programs. Errors, statuses, progress and anything interactive
+// still go to the wrapped ShellOut.
+type pipeOutput struct {
+	ShellOut
+	w io.Writer
+}
+
+func (o pipeOutput) RecvMsg(msg string) {
+	fmt.Fprintln(o.w, msg)
+}
+
+func (o pipeOutput) RecvPage(page browser.Page) {
+	for _, l := range gemtxt.Parse(page.Content) {
+		fmt.Fprintln(o.w, l.Text)
+	}
+}
+
+func (o pipeOutput) RecvLinks(links []browser.Link) {
+	for _, l := range links {
+		fmt.Fprintln(o.w, l.No, l.URL)
+	}
+}
+
+// RecvTable writes rows as tab separated fields without the header, which
+// suits cut and awk.
+func (o pipeOutput) RecvTable(table Table) {
+	for _, row := range table.Rows {
+		fmt.Fprintln(o.w, strings.Join(row.Cells, "\t"))
+	}
+}
+
+func (o pipeOutput) ShowHelp(help []HelpInfo) {
+	for _, cmd := range help {
+		fmt.Fprintf(o.w, "%s\n\t%s\n", strings.Join(cmd.Words, ", "), cmd.Desc)
+	}
+}
+
+// runPipeline runs each stage as a program with the output of the previous
+// one as its input, starting with input.
+func runPipeline(stages [][]string, input []byte) error {
+	var cmds []*exec.Cmd
+	var pipes []*os.File
+
+	defer func() {
+		for _, f := range pipes {
+			f.Close()
+		}
+	}()
+
+	for i, stage := range stages {
+		cmd := exec.Command(stage[0], stage[1:]...)
+		cmd.Stderr = os.Stderr
+
+		if i == 0 {
+			cmd.Stdin = bytes.NewReader(input)
+		} else {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			pipes = append(pipes, r, w)
+			cmds[i-1].Stdout = w
+			cmd.Stdin = r
+		}
+		if i == len(stages)-1 {
+			cmd.Stdout = os.Stdout
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	for i, cmd := range cmds {
+		err := cmd.Start()
+		if err != nil {
+			for _, started := range cmds[:i] {
+				started.Process.Kill()
+				started.Wait()
+			}
+			return err
+		}
+	}
+
+	// The children have their own copies of the pipes now, and they won't see
+	// EOF until ours are closed.
+	for _, f := range pipes {
+		f.Close()
+	}
+	pipes = nil
+
+	var firstErr error
+	for _, cmd := range cmds {
+		err := cmd.Wait()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,64 @@
+package shell
+
+import (
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/tofu"
+)
+
+// Recorder is a ShellOut that keeps everything it receives, for testing
+// commands.
+type Recorder struct {
+	Msgs        []string
+	Errors      []error
+	Pages       []browser.Page
+	Links       [][]browser.Link
+	Tables      []Table
+	Progress    []Progress
+	Statuses    []Status
+	Help        [][]HelpInfo
+	CertChanges []tofu.CertChange
+	Prompts     []string
+
+	// Decision is what ConfirmCertChange answers with.
+	Decision tofu.Decision
+	// Inputs are what GetInput answers with, in order. Once they run out it
+	// answers as if cancelled.
+	Inputs []string
+}
+
+func (r *Recorder) RecvMsg(msg string)             { r.Msgs = append(r.Msgs, msg) }
+func (r *Recorder) RecvError(err error)            { r.Errors = append(r.Errors, err) }
+func (r *Recorder) RecvPage(page browser.Page)     { r.Pages = append(r.Pages, page) }
+func (r *Recorder) RecvLinks(links []browser.Link) { r.Links = append(r.Links, links) }
+func (r *Recorder) RecvTable(table Table)          { r.Tables = append(r.Tables, table) }
+func (r *Recorder) RecvProgress(p Progress)        { r.Progress = append(r.Progress, p) }
+func (r *Recorder) RecvStatus(s Status)            { r.Statuses = append(r.Statuses, s) }
+func (r *Recorder) ShowHelp(help []HelpInfo)       { r.Help = append(r.Help, help) }
+
+func (r *Recorder) ConfirmCertChange(c tofu.CertChange) tofu.Decision {
+	r.CertChanges = append(r.CertChanges, c)
+	return r.Decision
+}
+
+func (r *Recorder) GetInput(prompt string) (string, bool) {
+	r.Prompts = append(r.Prompts, prompt)
+	if len(r.Inputs) == 0 {
+		return "", false
+	}
+	input := r.Inputs[0]
+	r.Inputs = r.Inputs[1:]
+	return input, true
+}
+
+// LastPage returns the last page received, if there was one.
+func (r *Recorder) LastPage() (browser.Page, bool) {
+	if len(r.Pages) == 0 {
+		return browser.Page{}, false
+	}
+	return r.Pages[len(r.Pages)-1], true
+}
+
+// Reset forgets everything received so far, but keeps the answers to give.
+func (r *Recorder) Reset() {
+	*r = Recorder{Decision: r.Decision, Inputs: r.Inputs}
+}
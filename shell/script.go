@@ -0,0 +1,100 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/config"
+)
+
+const rc_file = "gemcatrc"
+
+// maxDepth is how deeply aliases and sourced files may nest.
+const maxDepth = 16
+
+// source is run by the shell itself rather than being a ShellCmd, since it
+// needs to run other commands.
+var sourceHelp = HelpInfo{
+	Words: []string{"source", "."},
+	Desc: "Run the commands in a file, one line at a time. Lines starting with # are skipped.\n" +
+		"\tUsage: source [file]",
+}
+
+func isBuiltin(name string) bool {
+	cm, _ := makeCmdMap()
+	_, ok := cm[name]
+	return ok || name == "help" || slices.Contains(sourceHelp.Words, name)
+}
+
+// RCPath is the script that is sourced when the interactive shell starts.
+func RCPath() string {
+	return filepath.Join(config.GetConfigDir(), rc_file)
+}
+
+// Source runs every line of the file at path, carrying on past failing
+// lines. The returned errors are prefixed with the file and line number.
+func (sh *Shell) Source(b *browser.Browser, path string) error {
+	if sh.depth >= maxDepth {
+		return fmt.Errorf("%s: files are sourced too deeply", path)
+	}
+	sh.depth++
+	defer func() { sh.depth-- }()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var errs []error
+	var lineNo int
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		err := sh.RunLine(b, line)
+		if err != nil {
+			errs = append(errs, prefixErrors(fmt.Sprintf("%s:%d", path, lineNo), err)...)
+			if errors.Is(err, ErrExit) {
+				return errors.Join(errs...)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", path, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+func prefixErrors(prefix string, err error) []error {
+	var errs []error
+	for _, err := range SplitErrors(err) {
+		errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+	}
+	return errs
+}
+
+// QuoteArgs joins args into a string that Lex splits back into args.
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n\r;|'\"\\") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
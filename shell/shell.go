@@ -1,19 +1,110 @@
 package shell
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/tofu"
 )
 
+// ShellOut is where the shell sends everything it outputs, so that each
+// frontend can show it in its own way.
 type ShellOut interface {
+	// RecvMsg receives output a command was asked for, like a single URL.
 	RecvMsg(msg string)
+	RecvError(err error)
 	RecvPage(page browser.Page)
+	RecvLinks(links []browser.Link)
+	RecvTable(table Table)
+	RecvProgress(p Progress)
+	// RecvStatus receives notifications about what a command is doing or
+	// has done, as opposed to its output.
+	RecvStatus(s Status)
 	ShowHelp(help []HelpInfo)
-	// GetInput() string
+	ConfirmCertChange(c tofu.CertChange) tofu.Decision
+	// GetInput asks the user for input, like a search query. ok is false if
+	// they cancelled or can't be asked.
+	GetInput(prompt string) (input string, ok bool)
 	// GetCert() *x509.Certificate
 }
 
+// Table is a list of items with the same fields, like the stack or history.
+type Table struct {
+	Header []string
+	Rows   []Row
+}
+
+type Row struct {
+	Cells []string
+	// Current marks where the user is, like their position in the stack.
+	Current bool
+}
+
+// Progress reports how far along a long running command is. Total is 0 if it
+// isn't known yet.
+type Progress struct {
+	Label string
+	Done  int
+	Total int
+}
+
+// WaitProgress shows the waits for hosts that asked to slow down as a
+// countdown, for Browser.OnWait.
+func WaitProgress(out ShellOut) func(host string, left, total time.Duration) {
+	return func(host string, left, total time.Duration) {
+		// Short waits, like the politeness delay, aren't worth mentioning.
+		if total < time.Second {
+			return
+		}
+		secs := int(total.Round(time.Second) / time.Second)
+		leftSecs := int(left.Round(time.Second) / time.Second)
+		out.RecvProgress(Progress{
+			Label: fmt.Sprintf("%s asked to slow down, retrying in %ds...", host, leftSecs),
+			Done:  secs - leftSecs,
+			Total: secs,
+		})
+	}
+}
+
+type StatusKind int
+
+const (
+	// StatusInfo is something a command has done, like adding a bookmark.
+	StatusInfo StatusKind = iota
+	// StatusConnecting is sent before a request is made to URL.
+	StatusConnecting
+	// StatusWarning is something that went wrong without failing the
+	// command.
+	StatusWarning
+)
+
+func (k StatusKind) String() string {
+	switch k {
+	case StatusInfo:
+		return "info"
+	case StatusConnecting:
+		return "connecting"
+	case StatusWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("StatusKind(%d)", int(k))
+}
+
+type Status struct {
+	Kind StatusKind
+	Msg  string
+	URL  string
+}
+
+// ErrExit is returned by the exit command. Nothing after it on the line is
+// run.
+var ErrExit = errors.New("exit")
+
 type HelpInfo struct {
 	Words []string
 	Desc  string
@@ -23,6 +114,9 @@ type Shell struct {
 	Out     ShellOut
 	cmd_map map[string]ShellCmd
 	help    []HelpInfo
+	// depth counts nested aliases and sourced files, to stop them recursing
+	// forever.
+	depth int
 }
 
 type ShellCmd interface {
@@ -39,9 +133,83 @@ func NewShell(out ShellOut) Shell {
 	}
 }
 
+// HandleLine lexes a line of input and runs every command in it, piping
+// output into external programs where asked to. Errors are sent to Out. It
+// returns true if the exit command was run.
+func (sh *Shell) HandleLine(b *browser.Browser, line string) bool {
+	err := sh.RunLine(b, line)
+	sh.recvErrors(err)
+	return errors.Is(err, ErrExit)
+}
+
+// RunLine is like HandleLine, but returns the errors of any commands that
+// failed instead of sending them to Out.
+func (sh *Shell) RunLine(b *browser.Browser, line string) error {
+	cmds, err := Lex(line)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cmd := range cmds {
+		if len(cmd.Pipe) == 0 {
+			if err := sh.Run(b, cmd.Args); err != nil {
+				errs = append(errs, err)
+				if errors.Is(err, ErrExit) {
+					break
+				}
+			}
+			continue
+		}
+
+		var buf bytes.Buffer
+		piped := *sh
+		piped.Out = pipeOutput{ShellOut: sh.Out, w: &buf}
+		if err := piped.Run(b, cmd.Args); err != nil {
+			errs = append(errs, err)
+		}
+
+		err := runPipeline(cmd.Pipe, buf.Bytes())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (sh *Shell) HandleInput(b *browser.Browser, cmd []string) {
+	sh.recvErrors(sh.Run(b, cmd))
+}
+
+// recvErrors sends each of the joined errors in err to Out, leaving out
+// ErrExit since it isn't a failure.
+func (sh *Shell) recvErrors(err error) {
+	for _, err := range SplitErrors(err) {
+		if !errors.Is(err, ErrExit) {
+			sh.Out.RecvError(err)
+		}
+	}
+}
+
+// SplitErrors flattens errors joined by errors.Join into a list.
+func SplitErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, SplitErrors(err)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// Run runs a single command, expanding aliases.
+func (sh *Shell) Run(b *browser.Browser, cmd []string) error {
 	if len(cmd) == 0 {
-		return
+		return nil
 	}
 
 	opt := cmd[0]
@@ -50,27 +218,48 @@ func (sh *Shell) HandleInput(b *browser.Browser, cmd []string) {
 		args = cmd[1:]
 	}
 
+	// Allow "/text" as a shorthand for "/ text"
+	if len(opt) > 1 && strings.HasPrefix(opt, "/") {
+		args = append([]string{opt[1:]}, args...)
+		opt = "/"
+	}
+
 	if opt == "help" {
 		if len(args) != 0 {
 			if cmd, ok := sh.cmd_map[args[0]]; ok {
 				sh.Out.ShowHelp([]HelpInfo{cmd.Help()})
+			} else if slices.Contains(sourceHelp.Words, args[0]) {
+				sh.Out.ShowHelp([]HelpInfo{sourceHelp})
 			} else {
-				fmt.Printf("cmd %s does not exist\n", args[0])
+				return fmt.Errorf("cmd %s does not exist", args[0])
 			}
-			return
+			return nil
 		}
 		sh.Out.ShowHelp(sh.help)
-		return
+		return nil
+	}
+
+	if slices.Contains(sourceHelp.Words, opt) {
+		if len(args) == 0 {
+			return errors.New("must include a file")
+		}
+		return sh.Source(b, args[0])
 	}
 
 	if cmd, ok := sh.cmd_map[opt]; ok {
-		err := cmd.Do(b, sh.Out, args)
-		if err != nil {
-			fmt.Printf("error: %v\n", err)
+		return cmd.Do(b, sh.Out, args)
+	}
+
+	if alias, ok := b.Conf.Aliases[opt]; ok {
+		if sh.depth >= maxDepth {
+			return fmt.Errorf("alias '%s' nests too deeply", opt)
 		}
-	} else {
-		fmt.Printf("error: cmd not recognized: '%s'\n", opt)
+		sh.depth++
+		defer func() { sh.depth-- }()
+		return sh.RunLine(b, alias+" "+QuoteArgs(args))
 	}
+
+	return fmt.Errorf("cmd not recognized: '%s'", opt)
 }
 
 func makeCmdMap() (map[string]ShellCmd, []HelpInfo) {
@@ -109,7 +298,33 @@ func makeCmdMap() (map[string]ShellCmd, []HelpInfo) {
 		BookmarkClearAllCmd{},
 		BookmarkGotoCmd{},
 
+		CertListCmd{},
+		CertShowCmd{},
+		CertForgetCmd{},
+		CertPinCmd{},
+		CertImportCmd{},
+		CertExportCmd{},
+		VerifyCmd{},
+		TLSInfoCmd{},
+
+		FindCmd{},
+		FindNextCmd{},
+		FindPrevCmd{},
+
+		SubCmd{},
+		FeedsCmd{},
+		MirrorCmd{},
+		CheckCmd{},
+		SearchCmd{},
+		UploadCmd{},
+		EditCmd{},
+
 		ReprintCmd{},
+		PagerCmd{},
+		EditModeCmd{},
+		OpenerCmd{},
+		AliasCmd{},
+		UnaliasCmd{},
 	}
 	var help []HelpInfo
 
@@ -120,6 +335,7 @@ func makeCmdMap() (map[string]ShellCmd, []HelpInfo) {
 		}
 		help = append(help, hi)
 	}
+	help = append(help, sourceHelp)
 
 	return cm, help
 }
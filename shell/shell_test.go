@@ -0,0 +1,203 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/krbreyn/gemcat/browser"
+	"github.com/krbreyn/gemcat/geminitest"
+)
+
+func lastPage(t *testing.T, out *Recorder) browser.Page {
+	t.Helper()
+	p, ok := out.LastPage()
+	if !ok {
+		t.Fatal("no page was received")
+	}
+	return p
+}
+
+func TestBrowsing(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "# Home\n=> dir/a.gmi A\n=> /b.gmi B\n")
+	s.Page("/dir/a.gmi", "# A\n=> ../b.gmi B\n")
+	s.Page("/b.gmi", "# B\n")
+
+	b := &browser.Browser{}
+	out := &Recorder{}
+
+	steps := []struct {
+		cmd  ShellCmd
+		args []string
+		want string
+	}{
+		{GotoCmd{}, []string{s.URL("/")}, s.URL("/")},
+		{LinkGotoCmd{}, []string{"0"}, s.URL("/dir/a.gmi")},
+		{LinkGotoCmd{}, []string{"0"}, s.URL("/b.gmi")},
+		{BackCmd{}, nil, s.URL("/dir/a.gmi")},
+		{BackCmd{}, nil, s.URL("/")},
+		{ForwardCmd{}, nil, s.URL("/dir/a.gmi")},
+		{StackGotoCmd{}, []string{"2"}, s.URL("/b.gmi")},
+		{HistoryGotoCmd{}, []string{"0"}, s.URL("/")},
+	}
+
+	for i, step := range steps {
+		err := step.cmd.Do(b, out, step.args)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := lastPage(t, out).URL; got != step.want {
+			t.Fatalf("step %d: got page %s, want %s", i, got, step.want)
+		}
+	}
+
+	if err := (BookmarkAddCurrentCmd{}).Do(b, out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := (BookmarkAddLinkCmd{}).Do(b, out, []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{s.URL("/"), s.URL("/b.gmi")}
+	if !slices.Equal(b.D.Bookmarks, want) {
+		t.Errorf("got bookmarks %v, want %v", b.D.Bookmarks, want)
+	}
+}
+
+func TestGotoCertMismatch(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "hello\n")
+
+	b := &browser.Browser{}
+	out := &Recorder{}
+	b.CertPrompt = out.ConfirmCertChange
+
+	err := GotoCmd{}.Do(b, out, []string{s.URL("/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RotateCert(false)
+	s.Page("/other", "other\n")
+	err = GotoCmd{}.Do(b, out, []string{s.URL("/other")})
+	if err == nil {
+		t.Fatal("expected a certificate mismatch")
+	}
+	if len(out.Pages) != 1 {
+		t.Errorf("got %d pages, want 1", len(out.Pages))
+	}
+}
+
+func TestComplete(t *testing.T) {
+	sh := NewShell(&Recorder{})
+	b := &browser.Browser{}
+	b.D.History = []string{"gemini://example.org/", "gemini://example.com/"}
+	b.S.Stack = []browser.Page{{
+		URL:   "gemini://example.org/",
+		Links: browser.ParseLinks("=> /a A page\n=> /b\n"),
+	}}
+
+	texts := func(cands []Completion) []string {
+		var out []string
+		for _, c := range cands {
+			out = append(out, c.Text)
+		}
+		return out
+	}
+
+	tests := []struct {
+		before string
+		start  int
+		want   []string
+	}{
+		{"bm", 0, []string{"bmac", "bmal", "bmcla", "bmgt", "bml", "bmrm", "bmsw"}},
+		{"help st", 5, []string{"st", "stack", "stcl", "stcmp", "stem", "stgt", "stpos", "strm"}},
+		{"lgt ", 4, []string{"0", "1"}},
+		{"ls; hsgt 1", 9, []string{"1"}},
+		{"gt example.c", 3, []string{"example.com/"}},
+		{"gt gemini://example.o", 3, []string{"gemini://example.org/"}},
+		{"rp | gr", 5, nil},
+	}
+
+	for _, tt := range tests {
+		start, cands := sh.Complete(b, tt.before)
+		if start != tt.start || !slices.Equal(texts(cands), tt.want) {
+			t.Errorf("%q: got %d %v, want %d %v", tt.before, start, texts(cands), tt.start, tt.want)
+		}
+	}
+
+	_, cands := sh.Complete(b, "lgt 0")
+	if len(cands) != 1 || cands[0].Desc != "A page" {
+		t.Errorf("got link completions %+v", cands)
+	}
+}
+
+func TestAliasAndSource(t *testing.T) {
+	s := geminitest.NewTestServer(t)
+	s.Page("/", "# Home\n=> /a.gmi A\n")
+	s.Page("/a.gmi", "# A\n")
+
+	sh := NewShell(&Recorder{})
+	out := sh.Out.(*Recorder)
+	b := &browser.Browser{}
+
+	err := sh.RunLine(b, "alias home 'gt "+s.URL("/")+"; lgt'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.RunLine(b, "alias gt nope"); err == nil {
+		t.Error("alias shadowed a command")
+	}
+
+	dir := filepath.Join(t.TempDir(), "my scripts")
+	err = os.Mkdir(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "home"), []byte("gt "+s.URL("/")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sh.RunLine(b, "alias src source "+QuoteArgs([]string{dir + "/home"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Conf.Aliases["src"], "source '"+dir+"/home'"; got != want {
+		t.Errorf("got alias %q, want %q", got, want)
+	}
+	err = sh.RunLine(b, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lastPage(t, out).URL; got != s.URL("/") {
+		t.Errorf("the alias went to %s", got)
+	}
+
+	script := filepath.Join(t.TempDir(), "script")
+	err = os.WriteFile(script, []byte("# comment\nhome 0\n\nbmac\nnotacmd\nbml\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sh.RunLine(b, "source "+script)
+	want := fmt.Sprintf("%s:5: cmd not recognized: 'notacmd'", script)
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+	if got := lastPage(t, out).URL; got != s.URL("/a.gmi") {
+		t.Errorf("got page %s", got)
+	}
+	if !slices.Equal(b.D.Bookmarks, []string{s.URL("/a.gmi")}) {
+		t.Errorf("got bookmarks %v", b.D.Bookmarks)
+	}
+
+	err = os.WriteFile(script, []byte("source "+script+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sh.RunLine(b, ". "+script); err == nil {
+		t.Error("recursive source did not fail")
+	}
+}
@@ -0,0 +1,286 @@
+package tofu
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const knownHostsFile = ".gemini-known-hosts"
+
+var knownHostsOverride string
+
+// hostsMu is held while the known hosts are loaded, changed and saved, so
+// that concurrent fetches can't lose each other's changes.
+var hostsMu sync.Mutex
+
+// SetKnownHostsPath makes TOFU read and write its known hosts at path
+// instead of in the home directory. Mostly useful for tests.
+func SetKnownHostsPath(path string) {
+	knownHostsOverride = path
+}
+
+// Host is one entry in the known hosts file. Cert is nil for hosts that were
+// pinned by fingerprint and haven't been contacted yet.
+type Host struct {
+	Name        string
+	Fingerprint string
+	Expiry      time.Time
+	FirstSeen   time.Time
+	Cert        *x509.Certificate
+}
+
+func NewHost(hostname string, cert *x509.Certificate) Host {
+	return Host{
+		Name:        hostname,
+		Fingerprint: CertFingerprint(cert),
+		Expiry:      cert.NotAfter,
+		FirstSeen:   time.Now(),
+		Cert:        cert,
+	}
+}
+
+type KnownHosts []Host
+
+func (kh KnownHosts) Index(hostname string) int {
+	for i, h := range kh {
+		if h.Name == hostname {
+			return i
+		}
+	}
+	return -1
+}
+
+func (kh KnownHosts) Get(hostname string) (Host, bool) {
+	i := kh.Index(hostname)
+	if i == -1 {
+		return Host{}, false
+	}
+	return kh[i], true
+}
+
+func knownHostsPath() string {
+	if knownHostsOverride != "" {
+		return knownHostsOverride
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalln("Can't find home directory:", err)
+	}
+	return filepath.Join(home, knownHostsFile)
+}
+
+func LoadKnownHosts() (KnownHosts, error) {
+	f, err := os.Open(knownHostsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadKnownHosts(f)
+}
+
+func SaveKnownHosts(hosts KnownHosts) error {
+	f, err := os.OpenFile(knownHostsPath(), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return WriteKnownHosts(f, hosts)
+}
+
+// Known hosts lines are "hostname fingerprint [expiry [firstseen [cert]]]",
+// with times stored as unix timestamps and the certificate as base64 DER, or
+// "-" if we don't have it. Older files only have the first two fields.
+func ReadKnownHosts(r io.Reader) (KnownHosts, error) {
+	var hosts KnownHosts
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 || strings.HasPrefix(parts[0], "#") {
+			continue
+		}
+
+		h := Host{
+			Name:        parts[0],
+			Fingerprint: parts[1],
+		}
+		if len(parts) > 2 {
+			h.Expiry = parseUnix(parts[2])
+		}
+		if len(parts) > 3 {
+			h.FirstSeen = parseUnix(parts[3])
+		}
+		if len(parts) > 4 && parts[4] != "-" {
+			der, err := base64.StdEncoding.DecodeString(parts[4])
+			if err != nil {
+				return nil, fmt.Errorf("bad certificate for %s: %w", h.Name, err)
+			}
+			h.Cert, err = x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("bad certificate for %s: %w", h.Name, err)
+			}
+		}
+
+		if i := hosts.Index(h.Name); i != -1 {
+			hosts[i] = h
+		} else {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return hosts, scanner.Err()
+}
+
+func WriteKnownHosts(w io.Writer, hosts KnownHosts) error {
+	for _, h := range hosts {
+		cert := "-"
+		if h.Cert != nil {
+			cert = base64.StdEncoding.EncodeToString(h.Cert.Raw)
+		}
+		_, err := fmt.Fprintf(w, "%s %s %d %d %s\n",
+			h.Name, h.Fingerprint, formatUnix(h.Expiry), formatUnix(h.FirstSeen), cert)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseUnix(s string) time.Time {
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || secs == 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0)
+}
+
+func formatUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// Forget removes a host so that its next certificate is trusted on first use
+// again.
+func Forget(hostname string) error {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	hosts, err := LoadKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	i := hosts.Index(hostname)
+	if i == -1 {
+		return fmt.Errorf("%s is not a known host", hostname)
+	}
+
+	return SaveKnownHosts(append(hosts[:i], hosts[i+1:]...))
+}
+
+// Pin trusts fingerprint for hostname, replacing whatever was known before.
+func Pin(hostname, fingerprint string) error {
+	fingerprint, err := NormalizeFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	hosts, err := LoadKnownHosts()
+	if err != nil {
+		return err
+	}
+
+	h := Host{
+		Name:        hostname,
+		Fingerprint: fingerprint,
+	}
+	if i := hosts.Index(hostname); i != -1 {
+		hosts[i] = h
+	} else {
+		hosts = append(hosts, h)
+	}
+
+	return SaveKnownHosts(hosts)
+}
+
+// Import merges the known hosts in r into ours, with imported entries taking
+// precedence. It returns the number of hosts imported.
+func Import(r io.Reader) (int, error) {
+	imported, err := ReadKnownHosts(r)
+	if err != nil {
+		return 0, err
+	}
+
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	hosts, err := LoadKnownHosts()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, h := range imported {
+		h.Fingerprint, err = NormalizeFingerprint(h.Fingerprint)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", h.Name, err)
+		}
+		if i := hosts.Index(h.Name); i != -1 {
+			hosts[i] = h
+		} else {
+			hosts = append(hosts, h)
+		}
+	}
+
+	return len(imported), SaveKnownHosts(hosts)
+}
+
+// Export writes our known hosts to w in the known hosts format.
+func Export(w io.Writer) error {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	hosts, err := LoadKnownHosts()
+	if err != nil {
+		return err
+	}
+	return WriteKnownHosts(w, hosts)
+}
+
+// NormalizeFingerprint accepts a SHA-256 fingerprint in the forms capsules
+// tend to publish it (upper or lower case, optionally colon separated or
+// prefixed with "sha256:") and returns it as lowercase hex.
+func NormalizeFingerprint(fp string) (string, error) {
+	fp = strings.ToLower(strings.TrimSpace(fp))
+	fp = strings.TrimPrefix(fp, "sha256:")
+	fp = strings.ReplaceAll(fp, ":", "")
+
+	b, err := hex.DecodeString(fp)
+	if err != nil || len(b) != 32 {
+		return "", errors.New("fingerprint must be a hex encoded SHA-256 hash")
+	}
+	return fp, nil
+}
@@ -0,0 +1,187 @@
+package tofu
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadKnownHosts(t *testing.T) {
+	cert := newCert(t, newKey(t), time.Unix(2000000000, 0), nil, nil)
+	fp := CertFingerprint(cert)
+	der := base64.StdEncoding.EncodeToString(cert.Raw)
+
+	tests := []struct {
+		name    string
+		line    string
+		want    Host
+		wantErr bool
+	}{
+		{name: "legacy", line: "a.org " + fp, want: Host{Name: "a.org", Fingerprint: fp}},
+		{name: "times", line: "a.org " + fp + " 2000000000 1700000000 -",
+			want: Host{Name: "a.org", Fingerprint: fp, Expiry: time.Unix(2000000000, 0), FirstSeen: time.Unix(1700000000, 0)}},
+		{name: "zero times", line: "a.org " + fp + " 0 0 -", want: Host{Name: "a.org", Fingerprint: fp}},
+		{name: "cert", line: "a.org:1966 " + fp + " 2000000000 1700000000 " + der,
+			want: Host{Name: "a.org:1966", Fingerprint: fp, Expiry: time.Unix(2000000000, 0), FirstSeen: time.Unix(1700000000, 0), Cert: cert}},
+		{name: "bad base64", line: "a.org " + fp + " 0 0 !!!", wantErr: true},
+		{name: "bad cert", line: "a.org " + fp + " 0 0 " + base64.StdEncoding.EncodeToString([]byte("nope")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		hosts, err := ReadKnownHosts(strings.NewReader("# comment\n\nstray\n" + tt.line + "\n"))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(hosts) != 1 {
+			t.Errorf("%s: got hosts %+v", tt.name, hosts)
+			continue
+		}
+		h := hosts[0]
+		if h.Name != tt.want.Name || h.Fingerprint != tt.want.Fingerprint ||
+			!h.Expiry.Equal(tt.want.Expiry) || !h.FirstSeen.Equal(tt.want.FirstSeen) ||
+			(h.Cert == nil) != (tt.want.Cert == nil) || (h.Cert != nil && !h.Cert.Equal(tt.want.Cert)) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, h, tt.want)
+		}
+	}
+
+	// Later lines for a host replace earlier ones, and everything survives
+	// being written back out.
+	in := "a.org " + fp + "\nb.org " + fp + " 2000000000 1700000000 " + der + "\na.org " + strings.Repeat("0", 64) + "\n"
+	hosts, err := ReadKnownHosts(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[0].Fingerprint != strings.Repeat("0", 64) {
+		t.Fatalf("got hosts %+v", hosts)
+	}
+	var buf bytes.Buffer
+	err = WriteKnownHosts(&buf, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadKnownHosts(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 2 || again[1].Cert == nil || !again[1].Expiry.Equal(hosts[1].Expiry) || again[0].Cert != nil {
+		t.Errorf("got %+v after a round trip", again)
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	hex := strings.Repeat("ab", 32)
+	colons := strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: hex, want: hex},
+		{in: strings.ToUpper(hex), want: hex},
+		{in: colons, want: hex},
+		{in: " SHA256:" + colons + "\n", want: hex},
+		{in: hex[:62], wantErr: true},
+		{in: strings.Repeat("zz", 32), wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeFingerprint(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%q: got %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestPin(t *testing.T) {
+	setTestHosts(t)
+	cert := newCert(t, newKey(t), time.Now().Add(time.Hour), nil, nil)
+	other := newCert(t, newKey(t), time.Now().Add(time.Hour), nil, nil)
+
+	err := Pin("example.org", "x")
+	if err == nil {
+		t.Error("pinned a bad fingerprint")
+	}
+	err = Pin("example.org", strings.ToUpper(CertFingerprint(other)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pinning again replaces the pin.
+	err = Pin("example.org", strings.ToUpper(CertFingerprint(cert)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := knownHost(t, "example.org")
+	if h.Fingerprint != CertFingerprint(cert) || h.Cert != nil || !h.Expiry.IsZero() {
+		t.Errorf("got pinned host %+v", h)
+	}
+
+	// A pinned host is checked on first contact, and then filled in.
+	err = HandleTOFU([][]byte{other.Raw}, "example.org", nil)
+	if err == nil {
+		t.Error("a certificate that doesn't match the pin was trusted")
+	}
+	err = HandleTOFU([][]byte{cert.Raw}, "example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = knownHost(t, "example.org")
+	if h.Cert == nil || !h.Expiry.Equal(cert.NotAfter) {
+		t.Errorf("the pinned host wasn't filled in: %+v", h)
+	}
+
+	err = Forget("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Forget("example.org"); err == nil {
+		t.Error("forgot a host twice")
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	setTestHosts(t)
+	a, b := strings.Repeat("aa", 32), strings.Repeat("bb", 32)
+
+	err := Pin("keep.org", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Pin("replace.org", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Import(strings.NewReader("new.org nothex\n"))
+	if err == nil {
+		t.Error("imported a bad fingerprint")
+	}
+
+	n, err := Import(strings.NewReader("replace.org " + strings.ToUpper(b) + "\nnew.org sha256:" + b + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("imported %d hosts", n)
+	}
+
+	var buf bytes.Buffer
+	err = Export(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "keep.org " + a + " 0 0 -\n" +
+		"replace.org " + b + " 0 0 -\n" +
+		"new.org " + b + " 0 0 -\n"
+	if buf.String() != want {
+		t.Errorf("exported:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
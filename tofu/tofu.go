@@ -5,76 +5,125 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"strings"
+	"time"
 )
 
-const knownHostsFile = ".gemini-known-hosts"
+type Decision int
+
+const (
+	Abort Decision = iota
+	TrustOnce
+	TrustAlways
+)
+
+// CertChange describes a host presenting a different certificate than the
+// one we have on record. OldExpiry is zero if the known hosts entry predates
+// expiry tracking or was pinned by hand.
+type CertChange struct {
+	Host           string
+	OldFingerprint string
+	OldExpiry      time.Time
+	NewFingerprint string
+	NewNotBefore   time.Time
+	NewNotAfter    time.Time
+}
+
+func (c CertChange) OldExpired() bool {
+	return !c.OldExpiry.IsZero() && time.Now().After(c.OldExpiry)
+}
+
+// PromptFunc asks the user what to do about a changed certificate. A nil
+// PromptFunc aborts on every mismatch.
+type PromptFunc func(c CertChange) Decision
+
+// HandleTOFU trusts a host's whole certificate on first use.
+func HandleTOFU(rawCerts [][]byte, hostname string, prompt PromptFunc) error {
+	return handle(rawCerts, hostname, prompt, false)
+}
+
+// HandleSPKI trusts a host's public key on first use, quietly accepting new
+// certificates that keep the same key.
+func HandleSPKI(rawCerts [][]byte, hostname string, prompt PromptFunc) error {
+	return handle(rawCerts, hostname, prompt, true)
+}
+
+func handle(rawCerts [][]byte, hostname string, prompt PromptFunc, matchKey bool) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("[TOFU] %s presented no certificate", hostname)
+	}
 
-func HandleTOFU(rawCerts [][]byte, hostname string) error {
 	cert, err := x509.ParseCertificate(rawCerts[0])
 	if err != nil {
 		return err
 	}
 
-	fingerprint := certFingerprint(cert)
-	known, err := readKnownFingerprint(hostname)
-	if err != nil && !os.IsNotExist(err) {
+	// Held across the prompt too, so only one change is asked about at once.
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	hosts, err := LoadKnownHosts()
+	if err != nil {
 		return err
 	}
 
-	if known == "" {
+	fingerprint := CertFingerprint(cert)
+	i := hosts.Index(hostname)
+
+	if i == -1 {
 		//fmt.Println("[TOFU] First time seeing", hostname, "- trusting cert:", fingerprint)
-		return saveFingerprint(hostname, fingerprint)
+		hosts = append(hosts, NewHost(hostname, cert))
+		return SaveKnownHosts(hosts)
 	}
 
-	if known != fingerprint {
-		return fmt.Errorf("[TOFU] Certificate mismatch for %s! Expected %s, got %s", hostname, known, fingerprint)
+	known := hosts[i]
+	if known.Fingerprint == fingerprint {
+		// Pinned ahead of first contact, so fill in what we now know.
+		if known.Cert == nil {
+			hosts[i] = NewHost(hostname, cert)
+			return SaveKnownHosts(hosts)
+		}
+		return nil
 	}
 
-	return nil
-}
-
-func certFingerprint(cert *x509.Certificate) string {
-	sum := sha256.Sum256(cert.Raw)
-	return hex.EncodeToString(sum[:])
-}
+	if matchKey && known.Cert != nil && SPKIFingerprint(known.Cert) == SPKIFingerprint(cert) {
+		hosts[i] = NewHost(hostname, cert)
+		hosts[i].FirstSeen = known.FirstSeen
+		return SaveKnownHosts(hosts)
+	}
 
-func knownHostsPath() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalln("Can't find home directory:", err)
+	change := CertChange{
+		Host:           hostname,
+		OldFingerprint: known.Fingerprint,
+		OldExpiry:      known.Expiry,
+		NewFingerprint: fingerprint,
+		NewNotBefore:   cert.NotBefore,
+		NewNotAfter:    cert.NotAfter,
 	}
-	return filepath.Join(home, knownHostsFile)
-}
 
-func readKnownFingerprint(hostname string) (string, error) {
-	file := knownHostsPath()
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return "", err
+	// An expired certificate is expected to be replaced, so there is nothing
+	// to ask the user about.
+	if change.OldExpired() {
+		hosts[i] = NewHost(hostname, cert)
+		return SaveKnownHosts(hosts)
 	}
 
-	lines := strings.SplitSeq(string(data), "\n")
-	for line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) == 2 && parts[0] == hostname {
-			return parts[1], nil
-		}
+	decision := Abort
+	if prompt != nil {
+		decision = prompt(change)
 	}
-	return "", nil
-}
 
-func saveFingerprint(hostname, fingerprint string) error {
-	file := knownHostsPath()
-	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return err
+	switch decision {
+	case TrustOnce:
+		return nil
+	case TrustAlways:
+		hosts[i] = NewHost(hostname, cert)
+		return SaveKnownHosts(hosts)
+	default:
+		return fmt.Errorf("[TOFU] Certificate mismatch for %s! Expected %s, got %s", hostname, known.Fingerprint, fingerprint)
 	}
-	defer f.Close()
+}
 
-	_, err = fmt.Fprintf(f, "%s %s\n", hostname, fingerprint)
-	return err
+func CertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
 }
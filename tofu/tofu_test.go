@@ -0,0 +1,175 @@
+package tofu
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// setTestHosts keeps the known hosts file of a test in a temporary home.
+func setTestHosts(t *testing.T) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var serial int64
+
+// newCert makes a certificate for example.org with key that expires at
+// notAfter. It is signed by parent, or self-signed if parent is nil.
+func newCert(t *testing.T, key *ecdsa.PrivateKey, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.org"},
+		DNSNames:     []string{"example.org"},
+		NotBefore:    notAfter.Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func knownHost(t *testing.T, name string) Host {
+	t.Helper()
+	hosts, err := LoadKnownHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, ok := hosts.Get(name)
+	if !ok {
+		t.Fatalf("%s is not a known host", name)
+	}
+	return h
+}
+
+func TestHandleTOFU(t *testing.T) {
+	setTestHosts(t)
+	later := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	a := newCert(t, newKey(t), later, nil, nil)
+	b := newCert(t, newKey(t), later, nil, nil)
+
+	steps := []struct {
+		name       string
+		cert       *x509.Certificate
+		decision   Decision
+		noPrompt   bool
+		wantErr    bool
+		wantPrompt bool
+		// want is the certificate trusted afterwards.
+		want *x509.Certificate
+	}{
+		{name: "first use", cert: a, want: a},
+		{name: "same cert", cert: a, want: a},
+		{name: "change aborted", cert: b, decision: Abort, wantErr: true, wantPrompt: true, want: a},
+		{name: "change without a prompt", cert: b, noPrompt: true, wantErr: true, want: a},
+		{name: "trusted once", cert: b, decision: TrustOnce, wantPrompt: true, want: a},
+		{name: "trusted always", cert: b, decision: TrustAlways, wantPrompt: true, want: b},
+		{name: "back to the old one", cert: a, decision: Abort, wantErr: true, wantPrompt: true, want: b},
+	}
+
+	var firstSeen time.Time
+	for _, step := range steps {
+		var changes []CertChange
+		prompt := func(c CertChange) Decision {
+			changes = append(changes, c)
+			return step.decision
+		}
+		if step.noPrompt {
+			prompt = nil
+		}
+
+		err := HandleTOFU([][]byte{step.cert.Raw}, "example.org", prompt)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: got error %v", step.name, err)
+		}
+		if (len(changes) == 1) != step.wantPrompt || len(changes) > 1 {
+			t.Errorf("%s: got prompts %+v", step.name, changes)
+		}
+		if len(changes) == 1 {
+			c := changes[0]
+			if c.Host != "example.org" || c.NewFingerprint != CertFingerprint(step.cert) ||
+				c.OldFingerprint == c.NewFingerprint || !c.OldExpiry.Equal(later) || !c.NewNotAfter.Equal(later) {
+				t.Errorf("%s: got change %+v", step.name, c)
+			}
+		}
+
+		h := knownHost(t, "example.org")
+		if h.Fingerprint != CertFingerprint(step.want) || h.Cert == nil || !h.Expiry.Equal(later) {
+			t.Errorf("%s: got host %+v", step.name, h)
+		}
+		if firstSeen.IsZero() {
+			firstSeen = h.FirstSeen
+			if time.Since(firstSeen) > time.Minute {
+				t.Errorf("%s: got first seen %s", step.name, firstSeen)
+			}
+		}
+	}
+}
+
+func TestHandleTOFUExpired(t *testing.T) {
+	setTestHosts(t)
+	old := newCert(t, newKey(t), time.Now().Add(-time.Hour), nil, nil)
+	renewed := newCert(t, newKey(t), time.Now().Add(24*time.Hour), nil, nil)
+
+	err := SaveKnownHosts(KnownHosts{NewHost("example.org", old)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replacing an expired certificate is expected, so nobody is asked.
+	err = HandleTOFU([][]byte{renewed.Raw}, "example.org", func(c CertChange) Decision {
+		t.Errorf("asked about %+v", c)
+		return Abort
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := knownHost(t, "example.org"); h.Fingerprint != CertFingerprint(renewed) {
+		t.Errorf("got host %+v", h)
+	}
+
+	err = HandleTOFU(nil, "example.org", nil)
+	if err == nil {
+		t.Error("a host without a certificate was trusted")
+	}
+}
+
+func TestCertChangeOldExpired(t *testing.T) {
+	tests := []struct {
+		expiry time.Time
+		want   bool
+	}{
+		{time.Time{}, false},
+		{time.Now().Add(-time.Minute), true},
+		{time.Now().Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		if got := (CertChange{OldExpiry: tt.expiry}).OldExpired(); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.expiry, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package tofu
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Policy is a set of checks made against a server's certificate. Policies can
+// be combined, e.g. PolicyCA|PolicySPKI requires a valid chain for the host
+// and that the key stays the same.
+type Policy int
+
+const (
+	// PolicyTOFU trusts the whole certificate on first use.
+	PolicyTOFU Policy = 1 << iota
+	// PolicySPKI trusts the certificate's public key on first use, so a host
+	// can re-issue its certificate with the same key without a mismatch.
+	PolicySPKI
+	// PolicyCA requires a chain to a system root and a matching hostname.
+	PolicyCA
+)
+
+const DefaultPolicy = PolicyTOFU
+
+var policyNames = []struct {
+	p    Policy
+	name string
+}{
+	{PolicyTOFU, "tofu"},
+	{PolicySPKI, "spki"},
+	{PolicyCA, "ca"},
+}
+
+// ParsePolicy parses policies such as "tofu", "spki", "ca" and "ca+spki".
+func ParsePolicy(s string) (Policy, error) {
+	var p Policy
+	for part := range strings.SplitSeq(strings.ToLower(s), "+") {
+		found := false
+		for _, pn := range policyNames {
+			if part == pn.name {
+				p |= pn.p
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown verification policy '%s'", part)
+		}
+	}
+	return p, nil
+}
+
+func (p Policy) String() string {
+	var names []string
+	for _, pn := range policyNames {
+		if p&pn.p != 0 {
+			names = append(names, pn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "+")
+}
+
+// Verify checks the server certificates of an established connection
+// according to policy. The hostname may include a port, which keeps hosts
+// serving on several ports apart in the known hosts file.
+func Verify(state tls.ConnectionState, hostname string, policy Policy, prompt PromptFunc) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("[TOFU] %s presented no certificate", hostname)
+	}
+
+	if policy&PolicyCA != 0 {
+		err := verifyChain(state.PeerCertificates, hostname)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rawCerts [][]byte
+	for _, cert := range state.PeerCertificates {
+		rawCerts = append(rawCerts, cert.Raw)
+	}
+
+	switch {
+	case policy&PolicySPKI != 0:
+		return HandleSPKI(rawCerts, hostname, prompt)
+	case policy&PolicyTOFU != 0:
+		return HandleTOFU(rawCerts, hostname, prompt)
+	case policy == 0:
+		return errors.New("no certificate verification policy set")
+	}
+	return nil
+}
+
+// rootCAs are the roots PolicyCA trusts. nil is the system's roots, which
+// is what everything but tests uses.
+var rootCAs *x509.CertPool
+
+func verifyChain(certs []*x509.Certificate, hostname string) error {
+	if host, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = host
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       hostname,
+		Intermediates: intermediates,
+		Roots:         rootCAs,
+	})
+	if err != nil {
+		return fmt.Errorf("[CA] %w", err)
+	}
+	return nil
+}
+
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,167 @@
+package tofu
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Policy
+		str     string
+		wantErr bool
+	}{
+		{in: "tofu", want: PolicyTOFU, str: "tofu"},
+		{in: "SPKI", want: PolicySPKI, str: "spki"},
+		{in: "ca", want: PolicyCA, str: "ca"},
+		{in: "ca+spki", want: PolicyCA | PolicySPKI, str: "spki+ca"},
+		{in: "spki+ca+tofu", want: PolicyCA | PolicySPKI | PolicyTOFU, str: "tofu+spki+ca"},
+		{in: "", wantErr: true},
+		{in: "ca+", wantErr: true},
+		{in: "pinned", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.in)
+			}
+			continue
+		}
+		if err != nil || got != tt.want || got.String() != tt.str {
+			t.Errorf("%q: got %v (%s), %v", tt.in, int(got), got, err)
+		}
+	}
+	if Policy(0).String() != "none" {
+		t.Errorf("got %q for no policy", Policy(0))
+	}
+}
+
+func state(certs ...*x509.Certificate) tls.ConnectionState {
+	return tls.ConnectionState{PeerCertificates: certs}
+}
+
+func TestVerifySPKI(t *testing.T) {
+	setTestHosts(t)
+	key := newKey(t)
+	first := newCert(t, key, time.Now().Add(time.Hour), nil, nil)
+	reissued := newCert(t, key, time.Now().Add(48*time.Hour), nil, nil)
+	rekeyed := newCert(t, newKey(t), time.Now().Add(48*time.Hour), nil, nil)
+
+	steps := []struct {
+		name    string
+		policy  Policy
+		cert    *x509.Certificate
+		wantErr bool
+		want    *x509.Certificate
+	}{
+		{name: "first use", policy: PolicySPKI, cert: first, want: first},
+		// The whole certificate changed, which TOFU asks about.
+		{name: "tofu reissue", policy: PolicyTOFU, cert: reissued, wantErr: true, want: first},
+		{name: "spki reissue", policy: PolicySPKI, cert: reissued, want: reissued},
+		{name: "new key", policy: PolicySPKI, cert: rekeyed, wantErr: true, want: reissued},
+		{name: "no policy", policy: 0, cert: reissued, wantErr: true, want: reissued},
+	}
+
+	var firstSeen time.Time
+	for _, step := range steps {
+		err := Verify(state(step.cert), "example.org", step.policy, nil)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: got error %v", step.name, err)
+		}
+		h := knownHost(t, "example.org")
+		if h.Fingerprint != CertFingerprint(step.want) {
+			t.Errorf("%s: trusting %s, want %s", step.name, h.Fingerprint, CertFingerprint(step.want))
+		}
+		// Re-issuing with the same key doesn't make the host new.
+		if firstSeen.IsZero() {
+			firstSeen = h.FirstSeen
+		} else if !h.FirstSeen.Equal(firstSeen) {
+			t.Errorf("%s: first seen moved from %s to %s", step.name, firstSeen, h.FirstSeen)
+		}
+	}
+
+	if err := Verify(state(), "example.org", PolicyTOFU, nil); err == nil {
+		t.Error("a host without a certificate was trusted")
+	}
+}
+
+// newCA makes a self-signed certificate that can sign others.
+func newCA(t *testing.T, key *ecdsa.PrivateKey, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1000),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             notAfter.Add(-48 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestVerifyCA(t *testing.T) {
+	setTestHosts(t)
+	later := time.Now().Add(time.Hour)
+	caKey := newKey(t)
+	ca := newCA(t, caKey, later)
+	leaf := newCert(t, newKey(t), later, ca, caKey)
+	selfSigned := newCert(t, newKey(t), later, nil, nil)
+
+	rootCAs = x509.NewCertPool()
+	rootCAs.AddCert(ca)
+	t.Cleanup(func() { rootCAs = nil })
+
+	tests := []struct {
+		name    string
+		host    string
+		policy  Policy
+		certs   []*x509.Certificate
+		wantErr string
+	}{
+		{name: "signed", host: "example.org", policy: PolicyCA, certs: []*x509.Certificate{leaf}},
+		{name: "port", host: "example.org:1966", policy: PolicyCA | PolicyTOFU, certs: []*x509.Certificate{leaf}},
+		{name: "self-signed", host: "other.example.org", policy: PolicyCA, certs: []*x509.Certificate{selfSigned}, wantErr: "[CA]"},
+		{name: "wrong host", host: "example.com", policy: PolicyCA, certs: []*x509.Certificate{leaf}, wantErr: "[CA]"},
+		// Without CA checks a self-signed certificate is fine.
+		{name: "tofu only", host: "self.example.org", policy: PolicyTOFU, certs: []*x509.Certificate{selfSigned}},
+	}
+	for _, tt := range tests {
+		err := Verify(state(tt.certs...), tt.host, tt.policy, nil)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: got %v, want an error starting with %s", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// A failed CA check doesn't trust the host on first use either.
+	hosts, err := LoadKnownHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hosts.Get("other.example.org"); ok {
+		t.Error("a host that failed the CA check is known")
+	}
+	if _, ok := hosts.Get("example.org:1966"); !ok {
+		t.Error("ca+tofu didn't remember the host")
+	}
+}